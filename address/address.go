@@ -0,0 +1,202 @@
+// Package address stores the address book of users.
+//
+// Users keep up to `ADDRESS_LIMIT` labeled addresses. One address can be the
+// default shipping address and one the default billing address: the first
+// address of a user becomes both, making another address a default clears the
+// flag on the others and deleting a default moves it to the most recently
+// updated address left. Fields are normalized and checked against the rules
+// of the country of the address.
+package address
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/braswelljr/axxxe/database"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/model"
+)
+
+// default flags of an address
+const (
+	defaultShipping = "default_shipping"
+	defaultBilling  = "default_billing"
+)
+
+var (
+	collection = database.OpenCollection(database.Client, "addresses")
+
+	ErrNotFound     = errors.New("address not found")
+	ErrLimitReached = errors.New("address book is full")
+)
+
+func init() {
+	database.CreateIndexes(collection,
+		mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "updated_at", Value: -1}}},
+	)
+}
+
+// List - gets the addresses of a user, most recently updated first
+func List(ctx context.Context, userId string) ([]model.Address, error) {
+	cursor, err := collection.Find(ctx, bson.M{"user_id": userId}, options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	list := []model.Address{}
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// Find - gets an address of a user
+func Find(ctx context.Context, userId string, addressId primitive.ObjectID) (*model.Address, error) {
+	a := &model.Address{}
+	err := collection.FindOne(ctx, bson.M{"_id": addressId, "user_id": userId}).Decode(a)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Create - adds a normalized and checked address to the address book of a user
+func Create(ctx context.Context, userId string, params *model.AddressParams) (*model.Address, error) {
+	count, err := collection.CountDocuments(ctx, bson.M{"user_id": userId})
+	if err != nil {
+		return nil, err
+	}
+	if count >= int64(helper.GetEnvInt("ADDRESS_LIMIT", 20)) {
+		return nil, ErrLimitReached
+	}
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	a := &model.Address{
+		Id:        primitive.NewObjectID(),
+		UserId:    userId,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	fill(a, params)
+
+	// the first address is the default one
+	if count == 0 {
+		a.DefaultShipping, a.DefaultBilling = true, true
+	}
+
+	if _, err := collection.InsertOne(ctx, a); err != nil {
+		return nil, err
+	}
+	if err := clearDefaults(ctx, a); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Update - replaces the fields of an address of a user with normalized and
+// checked ones. A default address stays the default until another one is.
+func Update(ctx context.Context, userId string, addressId primitive.ObjectID, params *model.AddressParams) (*model.Address, error) {
+	a, err := Find(ctx, userId, addressId)
+	if err != nil {
+		return nil, err
+	}
+
+	shipping, billing := a.DefaultShipping, a.DefaultBilling
+	fill(a, params)
+	a.DefaultShipping = a.DefaultShipping || shipping
+	a.DefaultBilling = a.DefaultBilling || billing
+	a.UpdatedAt = primitive.NewDateTimeFromTime(time.Now())
+
+	result, err := collection.ReplaceOne(ctx, bson.M{"_id": a.Id, "user_id": userId}, a)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, ErrNotFound
+	}
+	if err := clearDefaults(ctx, a); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Delete - removes an address of a user, its default flags move to the most
+// recently updated address left
+func Delete(ctx context.Context, userId string, addressId primitive.ObjectID) error {
+	a := &model.Address{}
+	err := collection.FindOneAndDelete(ctx, bson.M{"_id": addressId, "user_id": userId}).Decode(a)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	for flag, wasDefault := range map[string]bool{defaultShipping: a.DefaultShipping, defaultBilling: a.DefaultBilling} {
+		if !wasDefault {
+			continue
+		}
+		if err := collection.FindOneAndUpdate(
+			ctx,
+			bson.M{"user_id": userId},
+			bson.M{"$set": bson.M{flag: true}},
+			options.FindOneAndUpdate().SetSort(bson.D{{Key: "updated_at", Value: -1}}),
+		).Err(); err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteAll - deletes every address of a user
+func DeleteAll(ctx context.Context, userId string) error {
+	_, err := collection.DeleteMany(ctx, bson.M{"user_id": userId})
+	return err
+}
+
+// fill - sets the fields of an address from params
+func fill(a *model.Address, params *model.AddressParams) {
+	a.Label = params.Label
+	a.Name = params.Name
+	a.Line1 = params.Line1
+	a.Line2 = params.Line2
+	a.City = params.City
+	a.Region = params.Region
+	a.PostalCode = params.PostalCode
+	a.Country = params.Country
+	a.Phone = params.Phone
+	a.DefaultShipping = params.DefaultShipping
+	a.DefaultBilling = params.DefaultBilling
+}
+
+// clearDefaults - clears the default flags of an address on the other addresses of its user
+func clearDefaults(ctx context.Context, a *model.Address) error {
+	for flag, isDefault := range map[string]bool{defaultShipping: a.DefaultShipping, defaultBilling: a.DefaultBilling} {
+		if !isDefault {
+			continue
+		}
+		if _, err := collection.UpdateMany(
+			ctx,
+			bson.M{"user_id": a.UserId, "_id": bson.M{"$ne": a.Id}, flag: true},
+			bson.M{"$set": bson.M{flag: false}},
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
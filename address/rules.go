@@ -0,0 +1,95 @@
+package address
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/braswelljr/axxxe/model"
+)
+
+// Rule - how addresses are written in a country
+type Rule struct {
+	// PostalCode - format of postal codes, nil when the country has none
+	PostalCode *regexp.Regexp
+	// PostalCodeRequired - addresses must have a postal code
+	PostalCodeRequired bool
+	// RegionRequired - addresses must have a region, e.g. a state or province
+	RegionRequired bool
+	// RegionCodes - regions are written as upper case codes, e.g. `CA` or `ON`
+	RegionCodes bool
+}
+
+// rules - countries with known address formats, other countries only need the
+// common fields
+var rules = map[string]Rule{
+	"AU": {PostalCode: regexp.MustCompile(`^\d{4}$`), PostalCodeRequired: true, RegionRequired: true, RegionCodes: true},
+	"BR": {PostalCode: regexp.MustCompile(`^\d{5}-?\d{3}$`), PostalCodeRequired: true, RegionRequired: true, RegionCodes: true},
+	"CA": {PostalCode: regexp.MustCompile(`^[A-Z]\d[A-Z] ?\d[A-Z]\d$`), PostalCodeRequired: true, RegionRequired: true, RegionCodes: true},
+	"DE": {PostalCode: regexp.MustCompile(`^\d{5}$`), PostalCodeRequired: true},
+	"ES": {PostalCode: regexp.MustCompile(`^\d{5}$`), PostalCodeRequired: true},
+	"FR": {PostalCode: regexp.MustCompile(`^\d{5}$`), PostalCodeRequired: true},
+	"GB": {PostalCode: regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}$`), PostalCodeRequired: true},
+	"GH": {PostalCode: regexp.MustCompile(`^[A-Z]{2}-?\d{3,4}-?\d{4}$`), RegionRequired: true},
+	"IE": {PostalCode: regexp.MustCompile(`^[A-Z]\d[\dW] ?[A-Z\d]{4}$`)},
+	"IN": {PostalCode: regexp.MustCompile(`^\d{6}$`), PostalCodeRequired: true, RegionRequired: true},
+	"IT": {PostalCode: regexp.MustCompile(`^\d{5}$`), PostalCodeRequired: true},
+	"JP": {PostalCode: regexp.MustCompile(`^\d{3}-?\d{4}$`), PostalCodeRequired: true, RegionRequired: true},
+	"KE": {PostalCode: regexp.MustCompile(`^\d{5}$`)},
+	"NG": {PostalCode: regexp.MustCompile(`^\d{6}$`), RegionRequired: true},
+	"NL": {PostalCode: regexp.MustCompile(`^\d{4} ?[A-Z]{2}$`), PostalCodeRequired: true},
+	"US": {PostalCode: regexp.MustCompile(`^\d{5}(-\d{4})?$`), PostalCodeRequired: true, RegionRequired: true, RegionCodes: true},
+	"ZA": {PostalCode: regexp.MustCompile(`^\d{4}$`), PostalCodeRequired: true},
+}
+
+// Error - the fields of an address breaking the rules of its country
+type Error struct {
+	Violations []string
+}
+
+// Error - describes the violations
+func (e *Error) Error() string {
+	return "address " + strings.Join(e.Violations, ", ")
+}
+
+// Normalize - trims and collapses the whitespace of the fields of an address and
+// upper cases its country, postal code and region codes
+func Normalize(params *model.AddressParams) {
+	for _, field := range []*string{
+		&params.Label, &params.Name, &params.Line1, &params.Line2, &params.City,
+		&params.Region, &params.PostalCode, &params.Country, &params.Phone,
+	} {
+		*field = strings.Join(strings.Fields(*field), " ")
+	}
+
+	params.Country = strings.ToUpper(params.Country)
+	params.PostalCode = strings.ToUpper(params.PostalCode)
+	if rules[params.Country].RegionCodes {
+		params.Region = strings.ToUpper(params.Region)
+	}
+}
+
+// Check - checks a normalized and validated address against the rules of its
+// country, returns an *Error listing every broken rule
+func Check(params *model.AddressParams) error {
+	violations := []string{}
+	rule := rules[params.Country]
+
+	// postal code
+	switch {
+	case params.PostalCode == "" && rule.PostalCodeRequired:
+		violations = append(violations, "postal code is required in "+params.Country)
+	case params.PostalCode != "" && rule.PostalCode != nil && !rule.PostalCode.MatchString(params.PostalCode):
+		violations = append(violations, "postal code is not a valid postal code of "+params.Country)
+	}
+
+	// region
+	if params.Region == "" && rule.RegionRequired {
+		violations = append(violations, "region is required in "+params.Country)
+	}
+
+	if len(violations) > 0 {
+		return &Error{Violations: violations}
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package address
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/braswelljr/axxxe/model"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name   string
+		params model.AddressParams
+		want   model.AddressParams
+	}{
+		{
+			name:   "whitespace",
+			params: model.AddressParams{Name: "  Jane   Doe ", Line1: "1  Main\tStreet", City: " Accra\n", Country: " gh "},
+			want:   model.AddressParams{Name: "Jane Doe", Line1: "1 Main Street", City: "Accra", Country: "GH"},
+		},
+		{
+			name:   "postal code and region code",
+			params: model.AddressParams{Region: "ca", PostalCode: "k1a 0b1", Country: "ca"},
+			want:   model.AddressParams{Region: "CA", PostalCode: "K1A 0B1", Country: "CA"},
+		},
+		{
+			name:   "region names keep their case",
+			params: model.AddressParams{Region: "Greater Accra", PostalCode: "ga-184-4455", Country: "gh"},
+			want:   model.AddressParams{Region: "Greater Accra", PostalCode: "GA-184-4455", Country: "GH"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := tt.params
+			Normalize(&params)
+			if params != tt.want {
+				t.Errorf("Normalize() = %+v, want %+v", params, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		country    string
+		postalCode string
+		region     string
+		violations []string
+	}{
+		{name: "US zip", country: "US", postalCode: "94105", region: "CA"},
+		{name: "US zip+4", country: "US", postalCode: "94105-1234", region: "CA"},
+		{name: "US invalid zip", country: "US", postalCode: "9410", region: "CA", violations: []string{"postal code is not a valid postal code of US"}},
+		{name: "US without region", country: "US", postalCode: "94105", violations: []string{"region is required in US"}},
+		{
+			name:       "US without postal code or region",
+			country:    "US",
+			violations: []string{"postal code is required in US", "region is required in US"},
+		},
+		{name: "CA postal code", country: "CA", postalCode: "K1A 0B1", region: "ON"},
+		{name: "CA postal code without space", country: "CA", postalCode: "K1A0B1", region: "ON"},
+		{name: "GB postcode", country: "GB", postalCode: "SW1A 1AA"},
+		{name: "GB short postcode", country: "GB", postalCode: "M1 1AE"},
+		{name: "GB invalid postcode", country: "GB", postalCode: "12345", violations: []string{"postal code is not a valid postal code of GB"}},
+		{name: "NL postcode", country: "NL", postalCode: "1012 AB"},
+		{name: "BR CEP", country: "BR", postalCode: "01310-100", region: "SP"},
+		{name: "JP postal code", country: "JP", postalCode: "100-0001", region: "Tokyo"},
+		{name: "DE without postal code", country: "DE", violations: []string{"postal code is required in DE"}},
+		{name: "GH digital address", country: "GH", postalCode: "GA-184-4455", region: "Greater Accra"},
+		{name: "GH without postal code", country: "GH", region: "Greater Accra"},
+		{name: "GH without region", country: "GH", violations: []string{"region is required in GH"}},
+		{name: "IE without eircode", country: "IE"},
+		{name: "IE eircode", country: "IE", postalCode: "D02 X285"},
+		{name: "IE invalid eircode", country: "IE", postalCode: "D02", violations: []string{"postal code is not a valid postal code of IE"}},
+		{name: "country without rules", country: "BE"},
+		{name: "country without rules and a postal code", country: "BE", postalCode: "anything 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check(&model.AddressParams{
+				Name:       "Jane Doe",
+				Line1:      "1 Main Street",
+				City:       "City",
+				Country:    tt.country,
+				PostalCode: tt.postalCode,
+				Region:     tt.region,
+			})
+			if tt.violations == nil {
+				if err != nil {
+					t.Errorf("Check() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var addressErr *Error
+			if !errors.As(err, &addressErr) {
+				t.Fatalf("Check() error = %v, want an *Error", err)
+			}
+			if !reflect.DeepEqual(addressErr.Violations, tt.violations) {
+				t.Errorf("Check() violations = %q, want %q", addressErr.Violations, tt.violations)
+			}
+		})
+	}
+}
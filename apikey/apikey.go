@@ -0,0 +1,187 @@
+// Package apikey stores the api keys services authenticate with.
+//
+// Keys look like `axk_<prefix>_<secret>`: the prefix identifies the key and
+// is stored in clear, only a SHA-256 hash of the whole key is stored.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/braswelljr/axxxe/database"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/model"
+)
+
+const (
+	// KeyPrefix - every api key starts with it
+	KeyPrefix = "axk_"
+	// prefixLength - length of the identifying part, `axk_` and 8 hex characters
+	prefixLength = len(KeyPrefix) + 8
+	// lastUsedPrecision - last use is only written when older than this
+	lastUsedPrecision = time.Minute
+)
+
+var (
+	collection = database.OpenCollection(database.Client, "api_keys")
+
+	ErrInvalidKey = errors.New("invalid api key")
+)
+
+func init() {
+	database.CreateIndexes(collection,
+		mongo.IndexModel{Keys: bson.D{{Key: "prefix", Value: 1}}, Options: options.Index().SetUnique(true)},
+	)
+}
+
+// unscopedPermissions - permissions api keys can never be scoped to, a leaked
+// key could otherwise mint more keys, act as any user or give any user any role
+var unscopedPermissions = []string{model.PermissionAPIKeysManage, model.PermissionUsersImpersonate, model.PermissionUsersManageRoles}
+
+// Scopable - checks if api keys can be scoped to a permission
+func Scopable(permission string) bool {
+	for _, unscoped := range unscopedPermissions {
+		if unscoped == permission {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Permissions - the scopes of a key it can use, scopes keys can no longer be
+// given are dropped from older keys
+func Permissions(apiKey *model.APIKey) []string {
+	permissions := []string{}
+	for _, scope := range apiKey.Scopes {
+		if Scopable(scope) {
+			permissions = append(permissions, scope)
+		}
+	}
+
+	return permissions
+}
+
+// IsKey - checks if a credential looks like an api key
+func IsKey(credential string) bool {
+	return strings.HasPrefix(credential, KeyPrefix)
+}
+
+// Create - creates an api key and returns the raw key, which can not be recovered later
+func Create(ctx context.Context, name string, scopes []string, ttl time.Duration, createdBy string) (string, *model.APIKey, error) {
+	// identifying prefix
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+	prefix := KeyPrefix + hex.EncodeToString(id)
+
+	// secret
+	secret, err := helper.RandomString(32)
+	if err != nil {
+		return "", nil, err
+	}
+	key := prefix + "_" + secret
+
+	now := time.Now()
+	apiKey := &model.APIKey{
+		Id:        primitive.NewObjectID(),
+		Name:      name,
+		Prefix:    prefix,
+		Hash:      helper.HashToken(key),
+		Scopes:    scopes,
+		CreatedBy: createdBy,
+		CreatedAt: primitive.NewDateTimeFromTime(now),
+		ExpiresAt: primitive.NewDateTimeFromTime(now.Add(ttl)),
+	}
+
+	if _, err := collection.InsertOne(ctx, apiKey); err != nil {
+		return "", nil, err
+	}
+
+	return key, apiKey, nil
+}
+
+// Authenticate - gets the active api key matching a raw key and records its use
+func Authenticate(ctx context.Context, key string) (*model.APIKey, error) {
+	if len(key) <= prefixLength || key[prefixLength] != '_' {
+		return nil, ErrInvalidKey
+	}
+
+	// find the key by its prefix
+	apiKey := &model.APIKey{}
+	if err := collection.FindOne(ctx, bson.M{"prefix": key[:prefixLength]}).Decode(apiKey); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrInvalidKey
+		}
+		return nil, err
+	}
+
+	// check the secret, revocation and expiry
+	now := time.Now()
+	if subtle.ConstantTimeCompare([]byte(apiKey.Hash), []byte(helper.HashToken(key))) != 1 ||
+		apiKey.RevokedAt != 0 ||
+		!apiKey.ExpiresAt.Time().After(now) {
+		return nil, ErrInvalidKey
+	}
+
+	// record the use, at most once per minute
+	if apiKey.LastUsedAt == 0 || now.Sub(apiKey.LastUsedAt.Time()) >= lastUsedPrecision {
+		if _, err := collection.UpdateOne(
+			ctx,
+			bson.M{"_id": apiKey.Id},
+			bson.M{"$set": bson.M{"last_used_at": primitive.NewDateTimeFromTime(now)}},
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	return apiKey, nil
+}
+
+// List - gets every api key, newest first
+func List(ctx context.Context) ([]model.APIKey, error) {
+	cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	apiKeys := []model.APIKey{}
+	if err := cursor.All(ctx, &apiKeys); err != nil {
+		return nil, err
+	}
+
+	return apiKeys, nil
+}
+
+// Revoke - revokes an api key, returns mongo.ErrNoDocuments when the key does not exist
+func Revoke(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return mongo.ErrNoDocuments
+	}
+
+	result, err := collection.UpdateOne(
+		ctx,
+		bson.M{"_id": oid, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": primitive.NewDateTimeFromTime(time.Now())}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/braswelljr/axxxe/database/databasetest"
+	"github.com/braswelljr/axxxe/model"
+)
+
+func TestScopable(t *testing.T) {
+	tests := []struct {
+		permission string
+		want       bool
+	}{
+		{permission: model.PermissionUsersRead, want: true},
+		{permission: model.PermissionUsersInvite, want: true},
+		{permission: model.PermissionAPIKeysManage},
+		{permission: model.PermissionUsersImpersonate},
+		{permission: model.PermissionUsersManageRoles},
+	}
+
+	for _, tt := range tests {
+		if got := Scopable(tt.permission); got != tt.want {
+			t.Errorf("Scopable(%q) = %v, want %v", tt.permission, got, tt.want)
+		}
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	apiKey := &model.APIKey{Scopes: []string{
+		model.PermissionUsersRead,
+		model.PermissionUsersManageRoles,
+		model.PermissionUsersInvite,
+		model.PermissionAPIKeysManage,
+	}}
+
+	want := []string{model.PermissionUsersRead, model.PermissionUsersInvite}
+	if got := Permissions(apiKey); !reflect.DeepEqual(got, want) {
+		t.Errorf("Permissions() = %v, want %v", got, want)
+	}
+}
+
+func TestIsKey(t *testing.T) {
+	if !IsKey("axk_1a2b3c4d_secret") {
+		t.Error("IsKey() = false for an api key")
+	}
+	if IsKey("eyJhbGciOiJSUzI1NiJ9.e30.sig") {
+		t.Error("IsKey() = true for a token")
+	}
+}
+
+func TestAuthenticateMalformed(t *testing.T) {
+	for _, key := range []string{"axk_", "axk_1a2b3c4d", "axk_1a2b3c4dxsecret"} {
+		if _, err := Authenticate(context.Background(), key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Authenticate(%q) = %v, want %v", key, err, ErrInvalidKey)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	server := databasetest.Start(t)
+	ctx := context.Background()
+
+	key, apiKey, err := Create(ctx, "billing", []string{model.PermissionUsersRead}, time.Hour, "637f1b2c9a1e4b3d2c1a0f9e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsKey(key) || strings.Contains(apiKey.Hash, key) {
+		t.Fatalf("expected a key only stored hashed, got %q", key)
+	}
+
+	// the key authenticates and its use is recorded
+	authenticated, err := Authenticate(ctx, key)
+	if err != nil || authenticated.Id != apiKey.Id {
+		t.Fatalf("Authenticate() = %v, %v, want the key", authenticated, err)
+	}
+	stored := &model.APIKey{}
+	if !server.FindOne(t, "api_keys", bson.M{"_id": apiKey.Id}, stored) || stored.LastUsedAt == 0 {
+		t.Errorf("expected the use of the key to be recorded")
+	}
+
+	// a wrong secret with the prefix of the key does not
+	if _, err := Authenticate(ctx, key[:len(key)-1]+"x"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("wrong secret error = %v, want %v", err, ErrInvalidKey)
+	}
+
+	// expired keys do not
+	expired, _, err := Create(ctx, "expired", nil, -time.Minute, "637f1b2c9a1e4b3d2c1a0f9e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Authenticate(ctx, expired); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expired key error = %v, want %v", err, ErrInvalidKey)
+	}
+
+	// nor do revoked keys
+	if err := Revoke(ctx, apiKey.Id.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Authenticate(ctx, key); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("revoked key error = %v, want %v", err, ErrInvalidKey)
+	}
+	if err := Revoke(ctx, apiKey.Id.Hex()); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Errorf("revoking twice error = %v, want %v", err, mongo.ErrNoDocuments)
+	}
+}
@@ -0,0 +1,212 @@
+// Package audit stores the append-only audit log of security relevant events:
+// signups, logins, logouts, password and role changes, token refreshes, admin
+// actions and the requests admins make while impersonating users.
+//
+// Entries are only ever inserted and never removed. Details never hold raw
+// emails, only their HashEmail. The entries of deleted accounts are scrubbed
+// with Anonymize.
+package audit
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/braswelljr/axxxe/database"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/model"
+)
+
+var entries = database.OpenCollection(database.Client, "audit_log")
+
+func init() {
+	database.CreateIndexes(entries,
+		mongo.IndexModel{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "_id", Value: -1}}},
+		mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "_id", Value: -1}}},
+		mongo.IndexModel{Keys: bson.D{{Key: "action", Value: 1}, {Key: "_id", Value: -1}}},
+		mongo.IndexModel{Keys: bson.D{{Key: "session_id", Value: 1}}},
+	)
+}
+
+// DeletedUser - actor and user of the entries of deleted accounts
+const DeletedUser = "deleted"
+
+// Filter - selects entries of the audit log, zero fields match everything
+type Filter struct {
+	Actions []string
+	ActorId string
+	UserId  string
+	IP      string
+	From    time.Time
+	To      time.Time
+	// Before - only entries older than this entry, the cursor of the next page
+	Before primitive.ObjectID
+	// Limit - maximum number of entries, zero for no limit
+	Limit int64
+}
+
+// Record - adds an entry to the audit log
+func Record(ctx context.Context, entry *model.AuditEntry) error {
+	if entry.Id.IsZero() {
+		entry.Id = primitive.NewObjectID()
+	}
+	if entry.CreatedAt == 0 {
+		entry.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+	}
+
+	_, err := entries.InsertOne(ctx, entry)
+
+	return err
+}
+
+// Log - records an action of a request on a user. The actor is the
+// impersonator, the api key or the user making the request, and for
+// unauthenticated requests the user acted upon. Failures are only logged so
+// they never fail the request.
+func Log(ctx *fiber.Ctx, action, userId string, details map[string]string) {
+	// context
+	contxt, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	actorId := Actor(ctx)
+	if actorId == "" {
+		actorId = userId
+	}
+	sessionId, _ := ctx.Locals("session_id").(string)
+
+	if err := Record(contxt, &model.AuditEntry{
+		Action:    action,
+		ActorId:   actorId,
+		UserId:    userId,
+		SessionId: sessionId,
+		Method:    ctx.Method(),
+		Path:      ctx.Path(),
+		IP:        ctx.IP(),
+		UserAgent: ctx.Get(fiber.HeaderUserAgent),
+		Details:   details,
+	}); err != nil {
+		log.Printf("Oops! could not audit %s of %s: %v\n", action, userId, err)
+	}
+}
+
+// Actor - who makes a request: the impersonator of impersonated requests,
+// `api_key:<id>` for api keys or the authenticated user
+func Actor(ctx *fiber.Ctx) string {
+	if impersonator := helper.CurrentImpersonator(ctx); impersonator != nil {
+		return impersonator.UserId
+	}
+	if keyId, _ := ctx.Locals("api_key_id").(string); keyId != "" {
+		return "api_key:" + keyId
+	}
+
+	return helper.CurrentUserId(ctx)
+}
+
+// HashEmail - the hash of an email recorded in details instead of the email,
+// the entries of an address can still be found but the address can not be read
+func HashEmail(email string) string {
+	return helper.HashToken(helper.NormalizeEmail(email))
+}
+
+// Anonymize - scrubs the entries of a deleted user: the user is replaced with
+// DeletedUser as actor and as the user acted upon, and the details, ip address
+// and user agent of the entries are removed
+func Anonymize(ctx context.Context, userId string) error {
+	for _, field := range []string{"actor_id", "user_id"} {
+		if _, err := entries.UpdateMany(
+			ctx,
+			bson.M{field: userId},
+			bson.M{
+				"$set":   bson.M{field: DeletedUser},
+				"$unset": bson.M{"details": "", "ip": "", "user_agent": ""},
+			},
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Find - gets the entries matching the filter, newest first
+func Find(ctx context.Context, filter Filter) ([]model.AuditEntry, error) {
+	list := []model.AuditEntry{}
+	err := Each(ctx, filter, func(entry *model.AuditEntry) error {
+		list = append(list, *entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// Each - calls fn with every entry matching the filter, newest first, without
+// loading them all in memory
+func Each(ctx context.Context, filter Filter, fn func(entry *model.AuditEntry) error) error {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(filter.Limit)
+	}
+
+	cursor, err := entries.Find(ctx, filter.query(), opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		entry := &model.AuditEntry{}
+		if err := cursor.Decode(entry); err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+// query - the mongo filter of the filter
+func (f Filter) query() bson.M {
+	query := bson.M{}
+	if len(f.Actions) > 0 {
+		query["action"] = bson.M{"$in": f.Actions}
+	}
+	if f.ActorId != "" {
+		query["actor_id"] = f.ActorId
+	}
+	if f.UserId != "" {
+		query["user_id"] = f.UserId
+	}
+	if f.IP != "" {
+		query["ip"] = f.IP
+	}
+
+	// time range
+	createdAt := bson.M{}
+	if !f.From.IsZero() {
+		createdAt["$gte"] = primitive.NewDateTimeFromTime(f.From)
+	}
+	if !f.To.IsZero() {
+		createdAt["$lt"] = primitive.NewDateTimeFromTime(f.To)
+	}
+	if len(createdAt) > 0 {
+		query["created_at"] = createdAt
+	}
+
+	// next page
+	if !f.Before.IsZero() {
+		query["_id"] = bson.M{"$lt": f.Before}
+	}
+
+	return query
+}
@@ -0,0 +1,218 @@
+// Package avatar processes and stores the profile images of users.
+//
+// Uploaded images (JPEG, PNG or GIF, up to `AVATAR_MAX_SIZE` bytes and
+// `maxPixels` pixels) are decoded, cropped to a centered square and re-encoded
+// as JPEG in each of the Sizes, which also drops their metadata. Every upload
+// is stored under a new version, so the urls of an avatar never change and can
+// be cached forever.
+package avatar
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"net/http"
+	"strconv"
+
+	// decoders of the accepted image types
+	_ "image/gif"
+	_ "image/png"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/storage"
+)
+
+// Sizes - widths in pixels of the stored square images
+var Sizes = []int{64, 128, 512}
+
+// maxPixels - largest image decoded, bigger images are refused before decoding.
+// A decoded image takes 4 bytes a pixel, 64MB at most.
+const maxPixels = 4096 * 4096
+
+// acceptedTypes - content types of the accepted images
+var acceptedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+var (
+	ErrTooLarge        = errors.New("image is too large")
+	ErrUnsupportedType = errors.New("image must be a JPEG, PNG or GIF")
+	ErrInvalidSize     = errors.New("unknown avatar size")
+)
+
+// MaxSize - largest accepted upload in bytes
+func MaxSize() int {
+	return helper.GetEnvInt("AVATAR_MAX_SIZE", 2<<20)
+}
+
+// Save - processes an uploaded image and stores it as a new version of the avatar
+// of a user, returns the version
+func Save(ctx context.Context, userId string, data []byte) (string, error) {
+	images, err := Process(data)
+	if err != nil {
+		return "", err
+	}
+
+	version := primitive.NewObjectID().Hex()
+	for size, encoded := range images {
+		if err := storage.Default().Put(ctx, Key(userId, version, size), "image/jpeg", encoded); err != nil {
+			return "", err
+		}
+	}
+
+	return version, nil
+}
+
+// Delete - removes a version of the avatar of a user
+func Delete(ctx context.Context, userId, version string) error {
+	for _, size := range Sizes {
+		if err := storage.Default().Delete(ctx, Key(userId, version, size)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Open - gets an image of a version of the avatar of a user
+func Open(ctx context.Context, userId, version string, size int) (*storage.Blob, error) {
+	if !validSize(size) {
+		return nil, ErrInvalidSize
+	}
+
+	return storage.Default().Get(ctx, Key(userId, version, size))
+}
+
+// Key - the blob key of an image of an avatar
+func Key(userId, version string, size int) string {
+	return "avatars/" + userId + "/" + version + "/" + strconv.Itoa(size) + ".jpg"
+}
+
+// URLs - the urls of the images of an avatar by size, nil without an avatar
+func URLs(userId, version string) map[string]string {
+	if version == "" {
+		return nil
+	}
+
+	base := helper.GetEnv("AVATAR_URL", "/api/v1/avatars")
+	urls := map[string]string{}
+	for _, size := range Sizes {
+		urls[strconv.Itoa(size)] = base + "/" + userId + "/" + version + "/" + strconv.Itoa(size) + ".jpg"
+	}
+
+	return urls
+}
+
+// Process - checks an uploaded image and re-encodes it in each of the Sizes
+func Process(data []byte) (map[int][]byte, error) {
+	if len(data) > MaxSize() {
+		return nil, ErrTooLarge
+	}
+
+	// the content decides the type, not the name or headers of the upload
+	if !acceptedTypes[http.DetectContentType(data)] {
+		return nil, ErrUnsupportedType
+	}
+
+	// refuse huge images before decoding them
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+
+	source, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+	square := crop(source)
+
+	images := map[int][]byte{}
+	for _, size := range Sizes {
+		var encoded bytes.Buffer
+		if err := jpeg.Encode(&encoded, resize(square, size), &jpeg.Options{Quality: 85}); err != nil {
+			return nil, err
+		}
+		images[size] = encoded.Bytes()
+	}
+
+	return images, nil
+}
+
+// crop - the centered square of an image, drawn on white so transparent pixels
+// stay light once encoded as JPEG
+func crop(source image.Image) *image.RGBA {
+	bounds := source.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	origin := image.Pt(bounds.Min.X+(bounds.Dx()-side)/2, bounds.Min.Y+(bounds.Dy()-side)/2)
+
+	square := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(square, square.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(square, square.Bounds(), source, origin, draw.Over)
+
+	return square
+}
+
+// resize - scales a square image to size pixels, averaging the source pixels
+// covered by each target pixel when shrinking
+func resize(source *image.RGBA, size int) *image.RGBA {
+	side := source.Bounds().Dx()
+	target := image.NewRGBA(image.Rect(0, 0, size, size))
+
+	for y := 0; y < size; y++ {
+		y0, y1 := y*side/size, (y+1)*side/size
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < size; x++ {
+			x0, x1 := x*side/size, (x+1)*side/size
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					offset := source.PixOffset(sx, sy)
+					r += int(source.Pix[offset])
+					g += int(source.Pix[offset+1])
+					b += int(source.Pix[offset+2])
+					a += int(source.Pix[offset+3])
+					n++
+				}
+			}
+
+			offset := target.PixOffset(x, y)
+			target.Pix[offset] = uint8(r / n)
+			target.Pix[offset+1] = uint8(g / n)
+			target.Pix[offset+2] = uint8(b / n)
+			target.Pix[offset+3] = uint8(a / n)
+		}
+	}
+
+	return target
+}
+
+// validSize - checks if a size is one of the Sizes
+func validSize(size int) bool {
+	for _, s := range Sizes {
+		if s == size {
+			return true
+		}
+	}
+
+	return false
+}
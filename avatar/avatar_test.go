@@ -0,0 +1,114 @@
+package avatar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// encode - an image of width by height pixels in a format
+func encode(t *testing.T, format string, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// resized - a png declaring other dimensions in its header, without the pixels
+func resized(t *testing.T, width, height uint32) []byte {
+	t.Helper()
+
+	data := encode(t, "png", 1, 1)
+	// the IHDR chunk follows the 8 byte signature, its data starts at 16
+	binary.BigEndian.PutUint32(data[16:], width)
+	binary.BigEndian.PutUint32(data[20:], height)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+
+	return data
+}
+
+func TestProcess(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{name: "png", data: encode(t, "png", 300, 200)},
+		{name: "jpeg", data: encode(t, "jpeg", 100, 400)},
+		{name: "gif", data: encode(t, "gif", 64, 64)},
+		{name: "smaller than the sizes", data: encode(t, "png", 10, 10)},
+		{name: "text", data: []byte("not an image"), err: ErrUnsupportedType},
+		{name: "svg", data: []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), err: ErrUnsupportedType},
+		{name: "truncated png", data: encode(t, "png", 50, 50)[:40], err: ErrUnsupportedType},
+		{name: "too many pixels", data: resized(t, 4097, 4096), err: ErrTooLarge},
+		{name: "too many bytes", data: append(encode(t, "png", 1, 1), make([]byte, MaxSize())...), err: ErrTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			images, err := Process(tt.data)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Process() error = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+
+			if len(images) != len(Sizes) {
+				t.Fatalf("Process() returned %d images, want %d", len(images), len(Sizes))
+			}
+			for _, size := range Sizes {
+				config, format, err := image.DecodeConfig(bytes.NewReader(images[size]))
+				if err != nil {
+					t.Fatalf("image %d: %v", size, err)
+				}
+				if format != "jpeg" || config.Width != size || config.Height != size {
+					t.Errorf("image %d is a %dx%d %s, want a %dx%d jpeg", size, config.Width, config.Height, format, size, size)
+				}
+			}
+		})
+	}
+}
+
+func TestURLs(t *testing.T) {
+	t.Setenv("AVATAR_URL", "https://cdn.example.com/avatars")
+
+	if urls := URLs("user", ""); urls != nil {
+		t.Errorf("URLs() without a version = %v, want nil", urls)
+	}
+
+	urls := URLs("user", "v1")
+	for _, size := range []string{"64", "128", "512"} {
+		want := "https://cdn.example.com/avatars/user/v1/" + size + ".jpg"
+		if urls[size] != want {
+			t.Errorf("URLs()[%s] = %q, want %q", size, urls[size], want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Command createadmin creates the first admin, other admins and privileged
+// users are then invited from the api. It refuses to run once an admin exists
+// unless `-force` is given.
+//
+//	go run ./cmd/createadmin -email admin@example.com -username admin
+//
+// The password is read from `ADMIN_PASSWORD`, or prompted for without echoing
+// it, or read from the standard input when it is not a terminal.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/term"
+
+	"github.com/braswelljr/axxxe/database"
+	"github.com/braswelljr/axxxe/hasher"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/model"
+	"github.com/braswelljr/axxxe/passwordpolicy"
+)
+
+func main() {
+	email := flag.String("email", "", "email of the admin")
+	username := flag.String("username", "admin", "username of the admin")
+	phone := flag.String("phone", "", "phone of the admin")
+	gender := flag.String("gender", "", "gender of the admin (FEMALE or MALE)")
+	force := flag.Bool("force", false, "create the admin even if an admin exists")
+	flag.Parse()
+
+	if *email == "" {
+		log.Fatal("-email is required")
+	}
+	*email = helper.NormalizeEmail(*email)
+
+	// context
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+	collection := database.OpenCollection(database.Client, "users")
+
+	// only bootstrap once
+	if !*force {
+		if count, err := collection.CountDocuments(ctx, bson.M{"role": model.RoleAdmin}); err != nil {
+			log.Fatal(err)
+		} else if count > 0 {
+			log.Fatal("An admin already exists, invite admins from the api or use -force")
+		}
+	}
+	if err := collection.FindOne(ctx, bson.M{"email": *email}).Err(); err == nil {
+		log.Fatal("User already exists")
+	}
+
+	// the admin
+	now := primitive.NewDateTimeFromTime(time.Now())
+	user := &model.User{
+		Id:         primitive.NewObjectID(),
+		Username:   *username,
+		Email:      *email,
+		Phone:      *phone,
+		Gender:     *gender,
+		Role:       model.RoleAdmin,
+		Status:     model.UserStatusActive,
+		VerifiedAt: now,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		LastLogin:  now,
+	}
+	user.UserId = user.Id.Hex()
+
+	// password
+	password := os.Getenv("ADMIN_PASSWORD")
+	if password == "" {
+		password = readPassword()
+	}
+	if err := passwordpolicy.Check(password, user); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := hasher.Load(); err != nil {
+		log.Fatal(err)
+	}
+	hash, err := hasher.Hash(password)
+	if err != nil {
+		log.Fatal(err)
+	}
+	user.Password = hash
+
+	if _, err := collection.InsertOne(ctx, user); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Admin %s created with id %s\n", user.Email, user.UserId)
+}
+
+// readPassword - prompts for the password without echoing it, or reads the
+// first line of the standard input when it is not a terminal
+func readPassword() string {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			log.Fatal(err)
+		}
+		return strings.TrimRight(line, "\r\n")
+	}
+
+	fmt.Print("Password: ")
+	password, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return string(password)
+}
@@ -0,0 +1,46 @@
+// Command mockidp runs a local OpenID Connect identity provider to try social
+// login without a real provider. Every login is approved for the configured user.
+//
+//	go run ./cmd/mockidp -email jane@example.com
+//
+// and configure the api with
+//
+//	OIDC_PROVIDERS=mock
+//	OIDC_MOCK_ISSUER=http://localhost:9000
+//	OIDC_MOCK_CLIENT_ID=axxxe
+//	OIDC_MOCK_CLIENT_SECRET=secret
+//	OIDC_MOCK_REDIRECT_URL=http://localhost:5050/api/v1/users/oidc/mock/callback
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/braswelljr/axxxe/oidc/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "address to listen on")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL, where the provider is reachable")
+	clientId := flag.String("client-id", "axxxe", "client id")
+	clientSecret := flag.String("client-secret", "secret", "client secret")
+	subject := flag.String("subject", "mock-user", "subject of the user")
+	email := flag.String("email", "jane@example.com", "email of the user")
+	verified := flag.Bool("email-verified", true, "whether the email of the user is verified")
+	name := flag.String("name", "Jane Doe", "name of the user")
+	flag.Parse()
+
+	server, err := oidctest.New(*issuer, *clientId, *clientSecret, oidctest.User{
+		Subject:       *subject,
+		Email:         *email,
+		EmailVerified: *verified,
+		Name:          *name,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Mock identity provider %s listening on %s\n", *issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, server))
+}
@@ -0,0 +1,202 @@
+package address
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/braswelljr/axxxe/address"
+	"github.com/braswelljr/axxxe/model"
+)
+
+var validate = validator.New()
+
+// GetAddresses - gets the addresses of a user, most recently updated first
+func GetAddresses() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		list, err := address.List(contxt, ctx.Params("user_id"))
+		if err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Addresses",
+			"payload": list,
+			"status":  fiber.StatusOK,
+		})
+	}
+}
+
+// GetAddress - gets an address of a user
+func GetAddress() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		addressId, err := primitive.ObjectIDFromHex(ctx.Params("address_id"))
+		if err != nil {
+			return addressNotFound(ctx)
+		}
+
+		found, err := address.Find(contxt, ctx.Params("user_id"), addressId)
+		if err != nil {
+			return addressError(ctx, err)
+		}
+
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Address",
+			"payload": found,
+			"status":  fiber.StatusOK,
+		})
+	}
+}
+
+// CreateAddress - adds an address to the address book of a user. The first
+// address is the default shipping and billing address.
+func CreateAddress() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		params, failed := parseAddress(ctx)
+		if params == nil {
+			return failed
+		}
+
+		created, err := address.Create(contxt, ctx.Params("user_id"), params)
+		if err != nil {
+			return addressError(ctx, err)
+		}
+
+		return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"message": "Address created",
+			"payload": created,
+			"status":  fiber.StatusCreated,
+		})
+	}
+}
+
+// UpdateAddress - replaces an address of a user
+func UpdateAddress() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		addressId, err := primitive.ObjectIDFromHex(ctx.Params("address_id"))
+		if err != nil {
+			return addressNotFound(ctx)
+		}
+
+		params, failed := parseAddress(ctx)
+		if params == nil {
+			return failed
+		}
+
+		updated, err := address.Update(contxt, ctx.Params("user_id"), addressId, params)
+		if err != nil {
+			return addressError(ctx, err)
+		}
+
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Address updated",
+			"payload": updated,
+			"status":  fiber.StatusOK,
+		})
+	}
+}
+
+// DeleteAddress - removes an address of a user
+func DeleteAddress() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		addressId, err := primitive.ObjectIDFromHex(ctx.Params("address_id"))
+		if err != nil {
+			return addressNotFound(ctx)
+		}
+
+		if err := address.Delete(contxt, ctx.Params("user_id"), addressId); err != nil {
+			return addressError(ctx, err)
+		}
+
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Address deleted",
+			"status":  fiber.StatusOK,
+		})
+	}
+}
+
+// parseAddress - decodes, normalizes and checks the address in the request body.
+// On failure the params are nil and the error is the written response.
+func parseAddress(ctx *fiber.Ctx) (*model.AddressParams, error) {
+	params := &model.AddressParams{}
+
+	// decode the request body into the params struct
+	if err := ctx.BodyParser(params); err != nil {
+		return nil, ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  err.Error(),
+			"status": fiber.StatusBadRequest,
+		})
+	}
+
+	// normalize then validate the params and the rules of the country
+	address.Normalize(params)
+	if err := validate.Struct(params); err != nil {
+		return nil, ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  err.Error(),
+			"status": fiber.StatusBadRequest,
+		})
+	}
+	var addressErr *address.Error
+	if err := address.Check(params); errors.As(err, &addressErr) {
+		return nil, ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":      addressErr.Error(),
+			"violations": addressErr.Violations,
+			"status":     fiber.StatusBadRequest,
+		})
+	}
+
+	return params, nil
+}
+
+// addressNotFound - responds to an unknown address
+func addressNotFound(ctx *fiber.Ctx) error {
+	return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+		"error":  address.ErrNotFound.Error(),
+		"status": fiber.StatusNotFound,
+	})
+}
+
+// addressError - responds to a failed address book operation
+func addressError(ctx *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, address.ErrNotFound):
+		return addressNotFound(ctx)
+	case errors.Is(err, address.ErrLimitReached):
+		return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":  err.Error(),
+			"status": fiber.StatusConflict,
+		})
+	}
+
+	return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error":  err.Error(),
+		"status": fiber.StatusInternalServerError,
+	})
+}
@@ -0,0 +1,45 @@
+package address
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "null", body: "null", status: fiber.StatusBadRequest},
+		{name: "empty", body: "{}", status: fiber.StatusBadRequest},
+		{name: "country rules", body: `{"name":"Jane Doe","line1":"1 Main St","city":"Springfield","country":"us","postal_code":"ABCDE"}`, status: fiber.StatusBadRequest},
+		{name: "valid", body: `{"name":"Jane Doe","line1":"1 Main St","city":"Springfield","region":"IL","country":"us","postal_code":"62701"}`, status: fiber.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Post("/", func(ctx *fiber.Ctx) error {
+				params, err := parseAddress(ctx)
+				if params == nil {
+					return err
+				}
+				return ctx.SendStatus(fiber.StatusOK)
+			})
+
+			req := httptest.NewRequest(fiber.MethodPost, "/", strings.NewReader(tt.body))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", res.StatusCode, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/braswelljr/axxxe/apikey"
+	"github.com/braswelljr/axxxe/audit"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/model"
+)
+
+var validate = validator.New()
+
+// CreateAPIKey - creates an api key scoped to permissions the creator has.
+// The key is only returned once. Keys can only be created by users, not by
+// other keys.
+func CreateAPIKey() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		// keys can not create keys
+		if helper.IsAPIKey(ctx) {
+			return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":  "API keys can not create API keys",
+				"status": fiber.StatusForbidden,
+			})
+		}
+		// params
+		params := &model.APIKeyParams{}
+
+		// decode the request body into the params struct
+		if err := ctx.BodyParser(params); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// validate the params
+		if err := validate.Struct(params); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// scopes must be known permissions the creator has
+		for _, scope := range params.Scopes {
+			if !validScope(scope) {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error":  "Unknown scope " + scope,
+					"status": fiber.StatusBadRequest,
+				})
+			}
+			if !apikey.Scopable(scope) {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error":  "API keys can not be scoped to " + scope,
+					"status": fiber.StatusBadRequest,
+				})
+			}
+			if !helper.Can(ctx, scope) {
+				return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error":  "Unauthorised to grant scope " + scope,
+					"status": fiber.StatusForbidden,
+				})
+			}
+		}
+
+		// expiry
+		days := params.ExpiresInDays
+		if days == 0 {
+			days = 90
+		}
+
+		// create the key
+		key, apiKey, err := apikey.Create(contxt, params.Name, params.Scopes, time.Duration(days)*24*time.Hour, helper.CurrentUserId(ctx))
+		if err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		audit.Log(ctx, model.AuditAPIKeyCreated, "", map[string]string{"key_id": apiKey.Id.Hex(), "scopes": strings.Join(apiKey.Scopes, ",")})
+
+		return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"message": "API key created, store the key now as it can not be shown again",
+			"payload": fiber.Map{
+				"key":     key,
+				"api_key": apiKey,
+			},
+			"status": fiber.StatusCreated,
+		})
+	}
+}
+
+// GetAllAPIKeys - lists the api keys without their secrets
+func GetAllAPIKeys() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		apiKeys, err := apikey.List(contxt)
+		if err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "API keys found",
+			"payload": apiKeys,
+			"status":  fiber.StatusOK,
+		})
+	}
+}
+
+// RevokeAPIKey - revokes an api key by id
+func RevokeAPIKey() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := apikey.Revoke(contxt, ctx.Params("key_id")); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error":  "API key not found",
+					"status": fiber.StatusNotFound,
+				})
+			}
+
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		audit.Log(ctx, model.AuditAPIKeyRevoked, "", map[string]string{"key_id": ctx.Params("key_id")})
+
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "API key revoked",
+			"status":  fiber.StatusOK,
+		})
+	}
+}
+
+// validScope - checks if a scope is a known permission
+func validScope(scope string) bool {
+	for _, permission := range model.Permissions {
+		if permission == scope {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,55 @@
+package apikey
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/braswelljr/axxxe/model"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	admin := func(ctx *fiber.Ctx) error {
+		ctx.Locals("user_id", "637f1b2c9a1e4b3d2c1a0f9e")
+		ctx.Locals("role", model.RoleAdmin)
+		return ctx.Next()
+	}
+	key := func(ctx *fiber.Ctx) error {
+		ctx.Locals("api_key_id", "637f1b2c9a1e4b3d2c1a0f9f")
+		ctx.Locals("permissions", []string{model.PermissionUsersRead})
+		return ctx.Next()
+	}
+
+	tests := []struct {
+		name   string
+		caller fiber.Handler
+		body   string
+		status int
+	}{
+		{name: "null", caller: admin, body: "null", status: fiber.StatusBadRequest},
+		{name: "unknown scope", caller: admin, body: `{"name":"sync","scopes":["users:everything"]}`, status: fiber.StatusBadRequest},
+		{name: "manage keys", caller: admin, body: `{"name":"sync","scopes":["apikeys:manage"]}`, status: fiber.StatusBadRequest},
+		{name: "impersonate", caller: admin, body: `{"name":"sync","scopes":["users:impersonate"]}`, status: fiber.StatusBadRequest},
+		{name: "manage roles", caller: admin, body: `{"name":"sync","scopes":["users:read","users:manage-roles"]}`, status: fiber.StatusBadRequest},
+		{name: "created by a key", caller: key, body: `{"name":"sync","scopes":["users:read"]}`, status: fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Post("/", tt.caller, CreateAPIKey())
+
+			req := httptest.NewRequest(fiber.MethodPost, "/", strings.NewReader(tt.body))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", res.StatusCode, tt.status)
+			}
+		})
+	}
+}
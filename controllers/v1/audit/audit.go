@@ -0,0 +1,156 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/braswelljr/axxxe/audit"
+	"github.com/braswelljr/axxxe/model"
+)
+
+const (
+	// defaultLimit - entries per page when no limit is asked for
+	defaultLimit = 50
+	// maxLimit - most entries per page
+	maxLimit = 500
+)
+
+// GetAuditLog - gets a page of the audit log, newest first. Entries are filtered
+// with the `action` (comma separated), `actor_id`, `user_id`, `ip`, `from` and
+// `to` (RFC 3339) query params, the next page is read with `before` set to the
+// `next` cursor of the previous page.
+func GetAuditLog() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		// filter
+		filter, err := auditFilter(ctx)
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// page size
+		filter.Limit = defaultLimit
+		if limit := ctx.Query("limit"); limit != "" {
+			if filter.Limit, err = strconv.ParseInt(limit, 10, 64); err != nil || filter.Limit < 1 || filter.Limit > maxLimit {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error":  "limit must be between 1 and " + strconv.Itoa(maxLimit),
+					"status": fiber.StatusBadRequest,
+				})
+			}
+		}
+
+		// get the entries
+		entries, err := audit.Find(contxt, filter)
+		if err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		// a full page may be followed by another one
+		next := ""
+		if int64(len(entries)) == filter.Limit {
+			next = entries[len(entries)-1].Id.Hex()
+		}
+
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Audit log retrieved successfully",
+			"payload": fiber.Map{
+				"entries": entries,
+				"next":    next,
+			},
+			"status": fiber.StatusOK,
+		})
+	}
+}
+
+// ExportAuditLog - downloads the entries of the audit log matching the filters
+// of GetAuditLog as newline delimited JSON, streamed without a page limit
+func ExportAuditLog() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// filter
+		filter, err := auditFilter(ctx)
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		audit.Log(ctx, model.AuditLogExport, "", map[string]string{"query": string(ctx.Request().URI().QueryString())})
+
+		// stream the entries, the request context is gone once the handler returns
+		ctx.Attachment("audit-log-" + time.Now().UTC().Format("20060102T150405Z") + ".ndjson")
+		ctx.Set(fiber.HeaderContentType, "application/x-ndjson")
+		ctx.Status(fiber.StatusOK).Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			// context
+			contxt, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+			defer cancel()
+
+			encoder := json.NewEncoder(w)
+			if err := audit.Each(contxt, filter, func(entry *model.AuditEntry) error {
+				return encoder.Encode(entry)
+			}); err != nil {
+				log.Printf("Oops! could not export the audit log: %v\n", err)
+			}
+			if err := w.Flush(); err != nil {
+				log.Printf("Oops! could not export the audit log: %v\n", err)
+			}
+		})
+
+		return nil
+	}
+}
+
+// auditFilter - the audit log filter of the query params of a request
+func auditFilter(ctx *fiber.Ctx) (audit.Filter, error) {
+	filter := audit.Filter{
+		ActorId: ctx.Query("actor_id"),
+		UserId:  ctx.Query("user_id"),
+		IP:      ctx.Query("ip"),
+	}
+
+	// actions
+	for _, action := range strings.Split(ctx.Query("action"), ",") {
+		if action = strings.TrimSpace(action); action != "" {
+			filter.Actions = append(filter.Actions, action)
+		}
+	}
+
+	// time range
+	var err error
+	if from := ctx.Query("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return filter, fiber.NewError(fiber.StatusBadRequest, "from must be an RFC 3339 time")
+		}
+	}
+	if to := ctx.Query("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return filter, fiber.NewError(fiber.StatusBadRequest, "to must be an RFC 3339 time")
+		}
+	}
+
+	// cursor
+	if before := ctx.Query("before"); before != "" {
+		if filter.Before, err = primitive.ObjectIDFromHex(before); err != nil {
+			return filter, fiber.NewError(fiber.StatusBadRequest, "before must be the cursor of a page")
+		}
+	}
+
+	return filter, nil
+}
@@ -2,16 +2,23 @@ package authentication
 
 import (
 	"context"
+	"log"
 	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 
+	"github.com/braswelljr/axxxe/audit"
 	"github.com/braswelljr/axxxe/database"
+	"github.com/braswelljr/axxxe/hasher"
 	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/lockout"
 	"github.com/braswelljr/axxxe/model"
+	"github.com/braswelljr/axxxe/passwordpolicy"
+	"github.com/braswelljr/axxxe/session"
 )
 
 var (
@@ -25,27 +32,47 @@ func Signup() fiber.Handler {
 		// context
 		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
-		// create a new user
-		user := &model.User{}
+		// params
+		params := &model.SignupParams{}
 
-		// decode the request body into the user struct
-		if err := ctx.BodyParser(&user); err != nil {
+		// decode the request body into the params struct
+		if err := ctx.BodyParser(params); err != nil {
 			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error":  err.Error(),
 				"status": fiber.StatusBadRequest,
 			})
 		}
 
-		// validate the user
-		if err := validate.Struct(user); err != nil {
+		// emails are stored and looked up trimmed and lowercased
+		params.Email = helper.NormalizeEmail(params.Email)
+
+		// validate the params
+		if err := validate.Struct(params); err != nil {
 			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error":  err.Error(),
 				"status": fiber.StatusBadRequest,
 			})
 		}
 
+		// create a new user, public signups are always users, other roles are
+		// given by invitation
+		user := &model.User{
+			Username:  params.Username,
+			Firstname: params.Firstname,
+			Lastname:  params.Lastname,
+			Email:     params.Email,
+			Phone:     params.Phone,
+			Gender:    params.Gender,
+			Role:      model.RoleUser,
+		}
+
+		// check the password against the password policy
+		if err := passwordpolicy.Check(params.Password, user); err != nil {
+			return passwordPolicyError(ctx, err)
+		}
+
 		// hash the user's password
-		password, err := HashPassword(user.Password)
+		password, err := HashPassword(params.Password)
 		if err != nil {
 			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error":  err.Error(),
@@ -60,6 +87,9 @@ func Signup() fiber.Handler {
 		user.UpdatedAt = primitive.NewDateTimeFromTime(time.Now())
 		user.LastLogin = primitive.NewDateTimeFromTime(time.Now())
 		user.UserId = user.Id.Hex()
+		user.Status = model.UserStatusUnverified
+		user.VerifiedAt = 0
+		user.VerificationSentAt = primitive.NewDateTimeFromTime(time.Now())
 
 		// check if the user already exists
 		err = collection.FindOne(contxt, bson.M{"email": user.Email}).Decode(&model.User{})
@@ -70,20 +100,15 @@ func Signup() fiber.Handler {
 			})
 		}
 
-		// params to be tokenized
-		tokenParams := &model.TokenizedUserParams{
-			Username:  user.Username,
-			Firstname: user.Firstname,
-			Lastname:  user.Lastname,
-			Email:     user.Password,
-			Phone:     user.Phone,
-			Gender:    user.Gender,
-			Role:      user.Role,
-			UserId:    user.UserId,
+		// insert the user into the database, the unique email index refuses a
+		// signup with the same email made in the meantime
+		_, err = collection.InsertOne(contxt, user)
+		if mongo.IsDuplicateKeyError(err) {
+			return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":  "User already exists",
+				"status": fiber.StatusConflict,
+			})
 		}
-
-		// get tokens
-		token, refreshToken, err := helper.GetAllTokens(*tokenParams)
 		if err != nil {
 			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error":  err.Error(),
@@ -91,12 +116,24 @@ func Signup() fiber.Handler {
 			})
 		}
 
-		// set user token
-		user.Token = token
-		user.RefreshToken = refreshToken
+		audit.Log(ctx, model.AuditSignup, user.UserId, nil)
 
-		// insert the user into the database
-		_, err = collection.InsertOne(contxt, user)
+		// send the verification email
+		if err := sendVerificationEmail(contxt, user); err != nil {
+			log.Printf("Oops! could not send verification email to %s: %v\n", user.UserId, err)
+		}
+
+		// start a session
+		token, refreshToken, err := issueTokens(ctx, contxt, user)
+		if err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		// tokens in the body or in cookies
+		payload, err := tokensPayload(ctx, user.UserId, token, refreshToken)
 		if err != nil {
 			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error":  err.Error(),
@@ -107,12 +144,8 @@ func Signup() fiber.Handler {
 		// return the user
 		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
 			"message": "Signup successful",
-			"payload": fiber.Map{
-				"user_id":      user.UserId,
-				"token":        token,
-				"refreshToken": refreshToken,
-			},
-			"status": fiber.StatusOK,
+			"payload": payload,
+			"status":  fiber.StatusOK,
 		})
 	}
 }
@@ -125,17 +158,20 @@ func Login() fiber.Handler {
 		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 		// get user params for login
-		var user *model.LoginDetails
+		user := &model.LoginDetails{}
 		foundUser := &model.User{}
 
 		// decode the request body into the user struct
-		if err := ctx.BodyParser(&user); err != nil {
+		if err := ctx.BodyParser(user); err != nil {
 			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error":  err.Error(),
 				"status": fiber.StatusBadRequest,
 			})
 		}
 
+		// emails are stored and looked up trimmed and lowercased
+		user.Email = helper.NormalizeEmail(user.Email)
+
 		// validate the user
 		if err := validate.Struct(user); err != nil {
 			return ctx.Status(fiber.StatusExpectationFailed).JSON(fiber.Map{
@@ -144,126 +180,221 @@ func Login() fiber.Handler {
 			})
 		}
 
-		// check if the user exists
+		// throttle failed attempts on the account and from the ip address
+		attemptKeys := []string{lockout.AccountKey(user.Email), lockout.IPKey(ctx.IP())}
+		if blocked, err := checkLockout(ctx, contxt, attemptKeys...); blocked {
+			return err
+		}
+
+		// check if the user exists, unknown emails take as long as wrong passwords
 		err := collection.FindOne(contxt, bson.M{"email": user.Email}).Decode(&foundUser)
 		if err != nil {
-			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"error":  "Invalid email",
-				"status": fiber.StatusNotFound,
-			})
+			_ = ComparePasswords(user.Password, dummyPasswordHash())
+			audit.Log(ctx, model.AuditLoginFailed, "", map[string]string{"email_hash": audit.HashEmail(user.Email), "reason": "unknown email"})
+			return invalidCredentials(ctx, contxt, attemptKeys...)
 		}
 
 		// check if the password is correct
-		err = ComparePasswords(user.Password, foundUser.Password)
-		if err != nil {
-			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":  "Invalid Credentials",
-				"status": fiber.StatusUnauthorized,
-			})
+		if err := ComparePasswords(user.Password, foundUser.Password); err != nil {
+			audit.Log(ctx, model.AuditLoginFailed, foundUser.UserId, map[string]string{"reason": "invalid password"})
+			return invalidCredentials(ctx, contxt, attemptKeys...)
 		}
 
-		// params to be tokenized
-		tokenParams := &model.TokenizedUserParams{
-			Username:  foundUser.Username,
-			Firstname: foundUser.Firstname,
-			Lastname:  foundUser.Lastname,
-			Email:     foundUser.Password,
-			Phone:     foundUser.Phone,
-			Gender:    foundUser.Gender,
-			Role:      foundUser.Role,
-			UserId:    foundUser.UserId,
+		// upgrade the hash of the password to the current hashing policy
+		if hasher.NeedsRehash(foundUser.Password) {
+			if err := rehashPassword(contxt, foundUser, user.Password); err != nil {
+				log.Printf("Oops! could not rehash the password of %s: %v\n", foundUser.UserId, err)
+			}
 		}
 
-		// get tokens
-		token, refreshToken, _ := helper.GetAllTokens(*tokenParams)
-
-		// update token in database
-		_, err = collection.UpdateOne(
-			contxt,
-			bson.M{"user_id": foundUser.UserId},
-			bson.M{
-				"$set": bson.M{
-					"token":         token,
-					"refresh_token": refreshToken,
-					"updated_at":    primitive.NewDateTimeFromTime(time.Now()),
-					"last_login":    primitive.NewDateTimeFromTime(time.Now()),
-				},
-			},
-		)
-		if err != nil {
+		// forget the failed attempts on the account
+		if err := lockout.Reset(contxt, lockout.AccountKey(user.Email)); err != nil {
 			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error":  err.Error(),
 				"status": fiber.StatusInternalServerError,
 			})
 		}
 
-		// return the user
-		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
-			"message": "Login successful",
-			"payload": fiber.Map{
-				"user_id":      foundUser.UserId,
-				"token":        token,
-				"refreshToken": refreshToken,
-			},
-			"status": fiber.StatusOK,
-		})
+		// issue the tokens or a two-factor challenge
+		return completeLogin(ctx, contxt, foundUser)
 	}
 }
 
 // Logout to clear the session
+// Revokes the session of the token used for the request
 func Logout() fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		// context
 		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
-		// get user params for logout
-		user := struct {
-			UserId string `json:"user_id" bson:"user_id" validate:"required"`
-		}{}
+		// get the session of the authenticated user
+		userId, _ := ctx.Locals("user_id").(string)
+		sessionId, _ := ctx.Locals("session_id").(string)
 
-		// decode the request body into the user struct
-		if err := ctx.BodyParser(&user); err != nil {
-			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		// revoke the session
+		if err := session.Revoke(contxt, sessionId, userId); err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error":  err.Error(),
-				"status": fiber.StatusBadRequest,
+				"status": fiber.StatusInternalServerError,
 			})
 		}
+		audit.Log(ctx, model.AuditLogout, userId, nil)
 
-		// validate the user
-		if err := validate.Struct(user); err != nil {
-			return ctx.Status(fiber.StatusExpectationFailed).JSON(fiber.Map{
-				"error":  err.Error(),
-				"status": fiber.StatusExpectationFailed,
-			})
-		}
+		// remove the session cookies
+		helper.ClearSessionCookies(ctx)
 
-		// update token in database
-		_, err := collection.UpdateOne(
-			contxt,
-			bson.M{"user_id": user.UserId},
-			bson.M{
-				"$set": bson.M{
-					"token":         "",
-					"refresh_token": "",
-					"updated_at":    primitive.NewDateTimeFromTime(time.Now()),
-				},
+		// return the user
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Logout successful",
+			"payload": fiber.Map{
+				"user_id": userId,
 			},
-		)
+			"status": fiber.StatusOK,
+		})
+	}
+}
 
-		if err != nil {
+// LogoutAll to clear every session of the user - log out everywhere
+func LogoutAll() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		// get the authenticated user
+		userId, _ := ctx.Locals("user_id").(string)
+
+		// revoke every session of the user
+		if err := session.RevokeAll(contxt, userId); err != nil {
 			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error":  err.Error(),
 				"status": fiber.StatusInternalServerError,
 			})
 		}
+		audit.Log(ctx, model.AuditLogoutAll, userId, nil)
+
+		// remove the session cookies
+		helper.ClearSessionCookies(ctx)
 
 		// return the user
 		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
-			"message": "Logout successful",
+			"message": "Logged out of all sessions",
 			"payload": fiber.Map{
-				"user_id": user.UserId,
+				"user_id": userId,
 			},
 			"status": fiber.StatusOK,
 		})
 	}
 }
+
+// completeLogin - finishes the login of a user whose password has been checked.
+// Users with two-factor authentication get a challenge to complete with a TOTP
+// code, users required to use it by policy get an enrollment challenge, and
+// everyone else gets their tokens.
+func completeLogin(ctx *fiber.Ctx, contxt context.Context, user *model.User) error {
+	switch {
+	case user.TwoFactor.Enabled:
+		return twoFactorChallenge(ctx, user, helper.TwoFactorChallengeToken, "Two-factor authentication required")
+	case twoFactorRequired(user):
+		return twoFactorChallenge(ctx, user, helper.TwoFactorEnrollmentToken, "Two-factor authentication enrollment required")
+	}
+
+	return issueLoginTokens(ctx, contxt, user, nil)
+}
+
+// issueTokens - starts a new session for a user on the device making the request.
+// Clients can name the device with the `X-Device-Name` header, otherwise it is
+// named after the user agent.
+func issueTokens(ctx *fiber.Ctx, contxt context.Context, user *model.User) (string, string, error) {
+	// new session
+	sessionId, err := session.NewSessionId()
+	if err != nil {
+		return "", "", err
+	}
+
+	// get tokens
+	token, refreshToken, err := helper.GetFamilyTokens(tokenParams(user), sessionId)
+	if err != nil {
+		return "", "", err
+	}
+
+	// store the session
+	if _, err := session.Start(contxt, sessionId, user.UserId, refreshToken, ctx.IP(), ctx.Get(fiber.HeaderUserAgent), ctx.Get("X-Device-Name")); err != nil {
+		return "", "", err
+	}
+
+	// update the last login
+	_, err = collection.UpdateOne(
+		contxt,
+		bson.M{"user_id": user.UserId},
+		bson.M{
+			"$set": bson.M{
+				"updated_at": primitive.NewDateTimeFromTime(time.Now()),
+				"last_login": primitive.NewDateTimeFromTime(time.Now()),
+			},
+		},
+	)
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, refreshToken, nil
+}
+
+// rehashPassword - hashes the password of a user again with the current hashing
+// policy, unless the password was changed in the meantime
+func rehashPassword(contxt context.Context, user *model.User, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.UpdateOne(
+		contxt,
+		bson.M{"user_id": user.UserId, "password": user.Password},
+		bson.M{"$set": bson.M{"password": hash}},
+	)
+	if err != nil {
+		return err
+	}
+
+	user.Password = hash
+	return nil
+}
+
+// tokensPayload - the response payload of newly issued tokens. In cookie session
+// mode (`?mode=cookie`) the tokens are set in HttpOnly cookies and only the csrf
+// token is returned.
+func tokensPayload(ctx *fiber.Ctx, userId, token, refreshToken string) (fiber.Map, error) {
+	if !helper.CookieSessionRequested(ctx) {
+		return fiber.Map{
+			"user_id":      userId,
+			"token":        token,
+			"refreshToken": refreshToken,
+		}, nil
+	}
+
+	csrfToken, err := helper.SetSessionCookies(ctx, token, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return fiber.Map{
+		"user_id":    userId,
+		"csrf_token": csrfToken,
+	}, nil
+}
+
+// tokenParams - params of a user to be tokenized
+func tokenParams(user *model.User) model.TokenizedUserParams {
+	return model.TokenizedUserParams{
+		Username:  user.Username,
+		Firstname: user.Firstname,
+		Lastname:  user.Lastname,
+		Email:     user.Email,
+		Phone:     user.Phone,
+		Gender:    user.Gender,
+		Role:      user.Role,
+		UserId:    user.UserId,
+		Verified:  user.IsVerified(),
+	}
+}
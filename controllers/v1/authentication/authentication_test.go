@@ -0,0 +1,245 @@
+package authentication
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/braswelljr/axxxe/database/databasetest"
+	"github.com/braswelljr/axxxe/middleware"
+	"github.com/braswelljr/axxxe/model"
+)
+
+const testPassword = "correct-horse-battery-staple"
+
+// testUser - stores a verified user with the test password
+func testUser(t *testing.T, server *databasetest.Server, role string) *model.User {
+	t.Helper()
+
+	hash, err := HashPassword(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := primitive.NewObjectID()
+	now := primitive.NewDateTimeFromTime(time.Now())
+	user := &model.User{
+		Id:         id,
+		Username:   "jane" + id.Hex()[18:],
+		Email:      "jane." + id.Hex() + "@example.com",
+		Password:   hash,
+		Role:       role,
+		UserId:     id.Hex(),
+		Status:     model.UserStatusActive,
+		VerifiedAt: now,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	server.Insert(t, "users", user)
+
+	return user
+}
+
+// testRequest - sends a request to an app and decodes the response body
+func testRequest(t *testing.T, app *fiber.App, req *http.Request) (*http.Response, fiber.Map) {
+	t.Helper()
+
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	res, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := fiber.Map{}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	return res, body
+}
+
+// testLogin - logs a user in and gets the payload of the tokens
+func testLogin(t *testing.T, user *model.User, query string) (*http.Response, fiber.Map) {
+	t.Helper()
+
+	app := fiber.New()
+	app.Post("/login", Login())
+
+	res, body := testRequest(t, app, httptest.NewRequest(
+		fiber.MethodPost,
+		"/login"+query,
+		strings.NewReader(`{"email":"`+user.Email+`","password":"`+testPassword+`"}`),
+	))
+	if res.StatusCode != fiber.StatusOK {
+		t.Fatalf("login status = %d, want %d: %v", res.StatusCode, fiber.StatusOK, body)
+	}
+	payload, _ := body["payload"].(map[string]interface{})
+
+	return res, payload
+}
+
+func TestNullBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler fiber.Handler
+	}{
+		{name: "signup", handler: Signup()},
+		{name: "login", handler: Login()},
+		{name: "forgot password", handler: ForgotPassword()},
+		{name: "magic link", handler: RequestMagicLink()},
+		{name: "invite user", handler: InviteUser()},
+		{name: "email change", handler: RequestEmailChange()},
+		{name: "confirm email change", handler: ConfirmEmailChange()},
+		{name: "revert email change", handler: RevertEmailChange()},
+		{name: "reset password", handler: ResetPassword()},
+		{name: "accept invitation", handler: AcceptInvitation()},
+		{name: "confirm two-factor", handler: ConfirmTwoFactor()},
+		{name: "disable two-factor", handler: DisableTwoFactor()},
+		{name: "recovery codes", handler: RegenerateRecoveryCodes()},
+		{name: "two-factor login", handler: LoginTwoFactor()},
+		{name: "two-factor enrollment login", handler: LoginEnrollTwoFactor()},
+		{name: "two-factor confirmation login", handler: LoginConfirmTwoFactor()},
+		{name: "magic link login", handler: LoginMagicLink()},
+		{name: "refresh", handler: Refresh()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Post("/", tt.handler)
+
+			req := httptest.NewRequest(fiber.MethodPost, "/", strings.NewReader("null"))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode < 400 || res.StatusCode >= 500 {
+				t.Errorf("status = %d, want a client error", res.StatusCode)
+			}
+		})
+	}
+}
+
+func TestInviteUserRoles(t *testing.T) {
+	tests := []struct {
+		name   string
+		locals map[string]interface{}
+	}{
+		{
+			name:   "support",
+			locals: map[string]interface{}{"user_id": "637f1b2c9a1e4b3d2c1a0f9e", "role": model.RoleSupport},
+		},
+		{
+			name:   "api key",
+			locals: map[string]interface{}{"api_key_id": "637f1b2c9a1e4b3d2c1a0f9f", "permissions": []string{model.PermissionUsersInvite, model.PermissionUsersManageRoles}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Post("/", func(ctx *fiber.Ctx) error {
+				for key, value := range tt.locals {
+					ctx.Locals(key, value)
+				}
+				return ctx.Next()
+			}, InviteUser())
+
+			req := httptest.NewRequest(fiber.MethodPost, "/", strings.NewReader(`{"email":"Jane@Example.com","role":"ADMIN"}`))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != fiber.StatusForbidden {
+				t.Errorf("status = %d, want %d", res.StatusCode, fiber.StatusForbidden)
+			}
+		})
+	}
+}
+
+// testSessionApp - an app authenticating requests to /me, /logout and /logout-all
+func testSessionApp() *fiber.App {
+	app := fiber.New()
+	app.Get("/me", middleware.Authenticate(), func(ctx *fiber.Ctx) error {
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"status": fiber.StatusOK})
+	})
+	app.Post("/logout", middleware.Authenticate(), Logout())
+	app.Post("/logout-all", middleware.Authenticate(), LogoutAll())
+
+	return app
+}
+
+// testAuthenticated - the status of a request to /me with an access token
+func testAuthenticated(t *testing.T, app *fiber.App, method, path, token string) int {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	res, _ := testRequest(t, app, req)
+
+	return res.StatusCode
+}
+
+func TestLogout(t *testing.T) {
+	server := databasetest.Start(t)
+	user := testUser(t, server, model.RoleUser)
+	_, first := testLogin(t, user, "")
+	_, second := testLogin(t, user, "")
+	app := testSessionApp()
+
+	if status := testAuthenticated(t, app, fiber.MethodPost, "/logout", first["token"].(string)); status != fiber.StatusOK {
+		t.Fatalf("logout status = %d, want %d", status, fiber.StatusOK)
+	}
+
+	// only the session logged out of is revoked
+	if status := testAuthenticated(t, app, fiber.MethodGet, "/me", first["token"].(string)); status != fiber.StatusUnauthorized {
+		t.Errorf("logged out token status = %d, want %d", status, fiber.StatusUnauthorized)
+	}
+	if res, _ := testRefresh(t, first["refreshToken"].(string)); res.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("logged out refresh token status = %d, want %d", res.StatusCode, fiber.StatusUnauthorized)
+	}
+	if status := testAuthenticated(t, app, fiber.MethodGet, "/me", second["token"].(string)); status != fiber.StatusOK {
+		t.Errorf("other session status = %d, want %d", status, fiber.StatusOK)
+	}
+}
+
+func TestLogoutAll(t *testing.T) {
+	server := databasetest.Start(t)
+	user := testUser(t, server, model.RoleUser)
+	other := testUser(t, server, model.RoleUser)
+	_, first := testLogin(t, user, "")
+	_, second := testLogin(t, user, "")
+	_, others := testLogin(t, other, "")
+	app := testSessionApp()
+
+	if status := testAuthenticated(t, app, fiber.MethodPost, "/logout-all", first["token"].(string)); status != fiber.StatusOK {
+		t.Fatalf("logout everywhere status = %d, want %d", status, fiber.StatusOK)
+	}
+
+	// every session of the user is revoked, tokens issued in the same second included
+	for _, payload := range []fiber.Map{first, second} {
+		if status := testAuthenticated(t, app, fiber.MethodGet, "/me", payload["token"].(string)); status != fiber.StatusUnauthorized {
+			t.Errorf("revoked token status = %d, want %d", status, fiber.StatusUnauthorized)
+		}
+		if res, _ := testRefresh(t, payload["refreshToken"].(string)); res.StatusCode != fiber.StatusUnauthorized {
+			t.Errorf("revoked refresh token status = %d, want %d", res.StatusCode, fiber.StatusUnauthorized)
+		}
+	}
+
+	// other users and later logins are not
+	if status := testAuthenticated(t, app, fiber.MethodGet, "/me", others["token"].(string)); status != fiber.StatusOK {
+		t.Errorf("other user status = %d, want %d", status, fiber.StatusOK)
+	}
+	_, later := testLogin(t, user, "")
+	if status := testAuthenticated(t, app, fiber.MethodGet, "/me", later["token"].(string)); status != fiber.StatusOK {
+		t.Errorf("later login status = %d, want %d", status, fiber.StatusOK)
+	}
+}
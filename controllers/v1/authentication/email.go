@@ -0,0 +1,320 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/braswelljr/axxxe/audit"
+	"github.com/braswelljr/axxxe/hasher"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/mailer"
+	"github.com/braswelljr/axxxe/model"
+	"github.com/braswelljr/axxxe/session"
+	"github.com/braswelljr/axxxe/ticket"
+)
+
+// RequestEmailChange - starts the change of the email of a user. A confirmation
+// link is sent to the new email and the current email is notified, the email
+// only changes once the link is used.
+func RequestEmailChange() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		// params
+		params := &model.EmailChangeParams{}
+
+		// decode the request body into the params struct
+		if err := ctx.BodyParser(params); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// emails are stored and looked up trimmed and lowercased
+		params.Email = helper.NormalizeEmail(params.Email)
+
+		// validate the params
+		if err := validate.Struct(params); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// get the user
+		foundUser := &model.User{}
+		if err := collection.FindOne(contxt, bson.M{"user_id": ctx.Params("user_id")}).Decode(foundUser); err != nil {
+			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":  "User not found",
+				"status": fiber.StatusNotFound,
+			})
+		}
+
+		// confirm with the password, when the user has one
+		if foundUser.Password != "" && hasher.Verify(params.Password, foundUser.Password) != nil {
+			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":  "Invalid password",
+				"status": fiber.StatusUnauthorized,
+			})
+		}
+
+		// the new email must be free
+		if params.Email == foundUser.Email {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  "The new email is the current email",
+				"status": fiber.StatusBadRequest,
+			})
+		}
+		if err := collection.FindOne(contxt, bson.M{"email": params.Email}).Err(); err == nil {
+			return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":  "Email already exists",
+				"status": fiber.StatusConflict,
+			})
+		}
+
+		// send the confirmation link to the new email, previous links stop working
+		if err := sendEmailChange(contxt, foundUser, params.Email); err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+		audit.Log(ctx, model.AuditEmailChangeRequested, foundUser.UserId, map[string]string{"email_hash": audit.HashEmail(params.Email)})
+
+		// let the current email know
+		if err := mailer.Send(
+			contxt,
+			foundUser.Email,
+			"Your email is being changed",
+			fmt.Sprintf("Hi %s,\n\nA change of the email of your axxxe account to %s was requested. It changes once the link sent to the new email is used.\n\nIf you did not ask for this change, change your password.\n", foundUser.Username, params.Email),
+		); err != nil {
+			log.Printf("Oops! could not send email change notice to %s: %v\n", foundUser.UserId, err)
+		}
+
+		return ctx.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message": "A confirmation link has been sent to the new email",
+			"status":  fiber.StatusAccepted,
+		})
+	}
+}
+
+// ConfirmEmailChange - changes the email of a user with the token of the link
+// sent to the new email. The previous email is sent a link to revert the change.
+func ConfirmEmailChange() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		// use the link
+		changeTicket, err := redeemEmailTicket(ctx, contxt, ticket.EmailChange)
+		if changeTicket == nil {
+			return err
+		}
+		oldEmail, newEmail := changeTicket.Data["old_email"], changeTicket.Data["email"]
+
+		// swap the email, only if it has not changed since the request
+		now := primitive.NewDateTimeFromTime(time.Now())
+		foundUser, err := swapEmail(contxt, changeTicket.UserId, oldEmail, newEmail, bson.M{"verified_at": now, "updated_at": now})
+		if err != nil {
+			return emailSwapError(ctx, err)
+		}
+		audit.Log(ctx, model.AuditEmailChanged, foundUser.UserId, map[string]string{"from_hash": audit.HashEmail(oldEmail), "to_hash": audit.HashEmail(newEmail)})
+
+		// the previous email can revert the change
+		if err := sendEmailRevert(contxt, foundUser, oldEmail); err != nil {
+			log.Printf("Oops! could not send email revert link to %s: %v\n", foundUser.UserId, err)
+		}
+
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Email changed",
+			"payload": fiber.Map{
+				"user_id": foundUser.UserId,
+				"email":   foundUser.Email,
+			},
+			"status": fiber.StatusOK,
+		})
+	}
+}
+
+// RevertEmailChange - restores the previous email of a user with the token of the
+// link sent to it. Every session of the user is revoked, as the change may have
+// been made by someone else.
+func RevertEmailChange() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		// use the link
+		revertTicket, err := redeemEmailTicket(ctx, contxt, ticket.EmailRevert)
+		if revertTicket == nil {
+			return err
+		}
+		oldEmail, newEmail := revertTicket.Data["old_email"], revertTicket.Data["email"]
+
+		// swap the email back, only if it has not changed again since
+		now := primitive.NewDateTimeFromTime(time.Now())
+		foundUser, err := swapEmail(contxt, revertTicket.UserId, newEmail, oldEmail, bson.M{"updated_at": now})
+		if err != nil {
+			return emailSwapError(ctx, err)
+		}
+
+		// log the user out everywhere and drop pending changes
+		if err := session.RevokeAll(contxt, foundUser.UserId); err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+		if err := ticket.Revoke(contxt, ticket.EmailChange, foundUser.UserId); err != nil {
+			log.Printf("Oops! could not revoke email changes of %s: %v\n", foundUser.UserId, err)
+		}
+		audit.Log(ctx, model.AuditEmailReverted, foundUser.UserId, map[string]string{"from_hash": audit.HashEmail(newEmail), "to_hash": audit.HashEmail(oldEmail)})
+
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Email restored, log in again and change your password",
+			"payload": fiber.Map{
+				"user_id": foundUser.UserId,
+				"email":   foundUser.Email,
+			},
+			"status": fiber.StatusOK,
+		})
+	}
+}
+
+var errEmailChanged = errors.New("the email has changed since the link was sent")
+
+// redeemEmailTicket - uses the email change or revert ticket in the request body.
+// On failure the ticket is nil and the error is the written response.
+func redeemEmailTicket(ctx *fiber.Ctx, contxt context.Context, purpose string) (*model.Ticket, error) {
+	params := &model.EmailChangeTokenParams{}
+
+	// decode the request body into the params struct
+	if err := ctx.BodyParser(params); err != nil {
+		return nil, ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  err.Error(),
+			"status": fiber.StatusBadRequest,
+		})
+	}
+
+	// validate the params
+	if err := validate.Struct(params); err != nil {
+		return nil, ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  err.Error(),
+			"status": fiber.StatusBadRequest,
+		})
+	}
+
+	// use the token
+	emailTicket, err := ticket.Redeem(contxt, purpose, params.Token)
+	if errors.Is(err, ticket.ErrInvalidTicket) {
+		return nil, ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  err.Error(),
+			"status": fiber.StatusBadRequest,
+		})
+	}
+	if err != nil {
+		return nil, ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":  err.Error(),
+			"status": fiber.StatusInternalServerError,
+		})
+	}
+
+	return emailTicket, nil
+}
+
+// swapEmail - replaces the email of a user if it is still the expected one, the
+// unique email index refuses emails taken in the meantime
+func swapEmail(contxt context.Context, userId, from, to string, set bson.M) (*model.User, error) {
+	set["email"] = to
+
+	foundUser := &model.User{}
+	err := collection.FindOneAndUpdate(
+		contxt,
+		bson.M{"user_id": userId, "email": from},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(foundUser)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, errEmailChanged
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return foundUser, nil
+}
+
+// emailSwapError - responds to a failed email swap
+func emailSwapError(ctx *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errEmailChanged):
+		return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":  err.Error(),
+			"status": fiber.StatusConflict,
+		})
+	case mongo.IsDuplicateKeyError(err):
+		return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":  "Email already exists",
+			"status": fiber.StatusConflict,
+		})
+	}
+
+	return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error":  err.Error(),
+		"status": fiber.StatusInternalServerError,
+	})
+}
+
+// sendEmailChange - issues an email change token and mails the confirmation link to the new email
+func sendEmailChange(contxt context.Context, user *model.User, email string) error {
+	ttl := helper.GetEnvDuration("EMAIL_CHANGE_TTL", 24*time.Hour)
+
+	// issue the change token
+	token, err := ticket.Issue(contxt, ticket.EmailChange, user.UserId, ttl, map[string]string{"email": email, "old_email": user.Email})
+	if err != nil {
+		return err
+	}
+
+	link := helper.GetEnv("EMAIL_CHANGE_URL", "http://localhost:5050/confirm-email") + "?token=" + url.QueryEscape(token)
+
+	return mailer.Send(
+		contxt,
+		email,
+		"Confirm your new email",
+		fmt.Sprintf("Hi %s,\n\nUse the link below to make this the email of your axxxe account, it expires in %s.\n\n%s\n\nIf you did not ask for this change you can ignore this email.\n", user.Username, ttl, link),
+	)
+}
+
+// sendEmailRevert - issues an email revert token and mails the revert link to the previous email
+func sendEmailRevert(contxt context.Context, user *model.User, oldEmail string) error {
+	ttl := helper.GetEnvDuration("EMAIL_REVERT_TTL", 7*24*time.Hour)
+
+	// issue the revert token
+	token, err := ticket.Issue(contxt, ticket.EmailRevert, user.UserId, ttl, map[string]string{"email": user.Email, "old_email": oldEmail})
+	if err != nil {
+		return err
+	}
+
+	link := helper.GetEnv("EMAIL_REVERT_URL", "http://localhost:5050/revert-email") + "?token=" + url.QueryEscape(token)
+
+	return mailer.Send(
+		contxt,
+		oldEmail,
+		"Your email was changed",
+		fmt.Sprintf("Hi %s,\n\nThe email of your axxxe account was changed to %s.\n\nIf you did not make this change, use the link below to restore this email and log out everywhere, it expires in %s.\n\n%s\n", user.Username, user.Email, ttl, link),
+	)
+}
@@ -0,0 +1,141 @@
+package authentication
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/braswelljr/axxxe/audit"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/model"
+	"github.com/braswelljr/axxxe/session"
+)
+
+// Impersonate - issues a short lived access token letting the authenticated user
+// act as another user, e.g. for support to see the store as a customer does.
+// The token carries the identity of both users, sensitive routes are blocked
+// while impersonating and every impersonated request is audited.
+func Impersonate() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		// params
+		params := &model.ImpersonationParams{}
+
+		// decode the request body into the params struct
+		if len(ctx.Body()) > 0 {
+			if err := ctx.BodyParser(params); err != nil {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error":  err.Error(),
+					"status": fiber.StatusBadRequest,
+				})
+			}
+		}
+
+		// validate the params
+		if err := validate.Struct(params); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// only users can impersonate, api keys act for services
+		impersonatorId := helper.CurrentUserId(ctx)
+		if impersonatorId == "" {
+			return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":  "Only users can impersonate other users",
+				"status": fiber.StatusForbidden,
+			})
+		}
+		if impersonatorId == ctx.Params("user_id") {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  "You can not impersonate yourself",
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// get the user to impersonate
+		foundUser := &model.User{}
+		if err := collection.FindOne(contxt, bson.M{"user_id": ctx.Params("user_id")}).Decode(foundUser); err != nil {
+			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":  "User not found",
+				"status": fiber.StatusNotFound,
+			})
+		}
+
+		// users who can impersonate can not be impersonated, so nobody gains permissions
+		if helper.HasPermission(foundUser.Role, model.PermissionUsersImpersonate) {
+			return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":  "Unauthorised to impersonate users with the role " + foundUser.Role,
+				"status": fiber.StatusForbidden,
+			})
+		}
+
+		// the impersonator
+		email, _ := ctx.Locals("email").(string)
+		sessionId, _ := ctx.Locals("session_id").(string)
+		impersonator := model.Impersonator{
+			UserId:    impersonatorId,
+			Email:     email,
+			Role:      helper.CurrentRole(ctx),
+			SessionId: sessionId,
+		}
+
+		// the impersonation has its own session id, logging out with the token ends it
+		impersonationId, err := session.NewSessionId()
+		if err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		// sign the token
+		ttl := helper.GetEnvDuration("IMPERSONATION_TTL", 15*time.Minute)
+		token, err := helper.GetImpersonationToken(tokenParams(foundUser), impersonator, impersonationId, ttl)
+		if err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		// no impersonation without an audit trail
+		details := map[string]string{"impersonator_session_id": sessionId}
+		if params.Reason != "" {
+			details["reason"] = params.Reason
+		}
+		if err := audit.Record(contxt, &model.AuditEntry{
+			Action:    model.AuditImpersonationStart,
+			ActorId:   impersonatorId,
+			UserId:    foundUser.UserId,
+			SessionId: impersonationId,
+			Method:    ctx.Method(),
+			Path:      ctx.Path(),
+			Status:    fiber.StatusCreated,
+			IP:        ctx.IP(),
+			UserAgent: ctx.Get(fiber.HeaderUserAgent),
+			Details:   details,
+		}); err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"message": "Impersonation started",
+			"payload": fiber.Map{
+				"token":        token,
+				"expires_in":   int(ttl.Seconds()),
+				"user_id":      foundUser.UserId,
+				"impersonator": impersonator,
+			},
+			"status": fiber.StatusCreated,
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package authentication
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/braswelljr/axxxe/database/databasetest"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/middleware"
+	"github.com/braswelljr/axxxe/model"
+)
+
+func TestImpersonate(t *testing.T) {
+	server := databasetest.Start(t)
+	admin := testUser(t, server, model.RoleAdmin)
+	otherAdmin := testUser(t, server, model.RoleAdmin)
+	support := testUser(t, server, model.RoleSupport)
+	customer := testUser(t, server, model.RoleUser)
+	_, adminLogin := testLogin(t, admin, "")
+	_, supportLogin := testLogin(t, support, "")
+	adminToken := adminLogin["token"].(string)
+
+	app := fiber.New()
+	users := app.Group("/api/v1/users", middleware.Authenticate(), middleware.BlockImpersonation())
+	users.Post("/logout", Logout())
+	users.Get("/:user_id", func(ctx *fiber.Ctx) error {
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"user_id": helper.CurrentUserId(ctx)})
+	})
+	users.Get("/:user_id/export", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(fiber.StatusOK)
+	})
+	users.Post("/:user_id/impersonate", middleware.RequirePermission(model.PermissionUsersImpersonate), Impersonate())
+
+	impersonate := func(token, userId string) (int, string) {
+		t.Helper()
+
+		req := httptest.NewRequest(fiber.MethodPost, "/api/v1/users/"+userId+"/impersonate", strings.NewReader(`{"reason":"ticket 42"}`))
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+		res, body := testRequest(t, app, req)
+		payload, _ := body["payload"].(map[string]interface{})
+		impersonationToken, _ := payload["token"].(string)
+
+		return res.StatusCode, impersonationToken
+	}
+
+	// only users allowed to, and not of themselves or of users who can impersonate
+	tests := []struct {
+		name   string
+		token  string
+		userId string
+		status int
+	}{
+		{name: "support", token: supportLogin["token"].(string), userId: customer.UserId, status: fiber.StatusForbidden},
+		{name: "self", token: adminToken, userId: admin.UserId, status: fiber.StatusBadRequest},
+		{name: "admin", token: adminToken, userId: otherAdmin.UserId, status: fiber.StatusForbidden},
+		{name: "unknown user", token: adminToken, userId: "637f1b2c9a1e4b3d2c1a0f9e", status: fiber.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, _ := impersonate(tt.token, tt.userId); status != tt.status {
+				t.Errorf("status = %d, want %d", status, tt.status)
+			}
+		})
+	}
+
+	// admins act as the customer, with an audit trail
+	status, token := impersonate(adminToken, customer.UserId)
+	if status != fiber.StatusCreated || token == "" {
+		t.Fatalf("impersonate status = %d, want %d", status, fiber.StatusCreated)
+	}
+	if len(server.Find(t, "audit_log", bson.M{"action": model.AuditImpersonationStart, "actor_id": admin.UserId, "user_id": customer.UserId})) != 1 {
+		t.Errorf("expected the impersonation to be audited")
+	}
+
+	req := httptest.NewRequest(fiber.MethodGet, "/api/v1/users/"+customer.UserId, nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	res, body := testRequest(t, app, req)
+	if res.StatusCode != fiber.StatusOK || body["user_id"] != customer.UserId {
+		t.Fatalf("impersonated request = %d %v, want the customer", res.StatusCode, body)
+	}
+	if len(server.Find(t, "audit_log", bson.M{"action": model.AuditImpersonatedRequest, "actor_id": admin.UserId, "user_id": customer.UserId})) != 1 {
+		t.Errorf("expected the impersonated request to be audited")
+	}
+
+	// sensitive routes are blocked, impersonating included
+	if status := testAuthenticated(t, app, fiber.MethodGet, "/api/v1/users/"+customer.UserId+"/export", token); status != fiber.StatusForbidden {
+		t.Errorf("blocked route status = %d, want %d", status, fiber.StatusForbidden)
+	}
+	if status, _ := impersonate(token, support.UserId); status != fiber.StatusForbidden {
+		t.Errorf("impersonating while impersonating status = %d, want %d", status, fiber.StatusForbidden)
+	}
+
+	// the impersonation ends with the session of the admin
+	if status := testAuthenticated(t, app, fiber.MethodPost, "/api/v1/users/logout", adminToken); status != fiber.StatusOK {
+		t.Fatalf("logout status = %d, want %d", status, fiber.StatusOK)
+	}
+	if status := testAuthenticated(t, app, fiber.MethodGet, "/api/v1/users/"+customer.UserId, token); status != fiber.StatusUnauthorized {
+		t.Errorf("impersonation after logout status = %d, want %d", status, fiber.StatusUnauthorized)
+	}
+}
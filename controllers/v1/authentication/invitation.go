@@ -0,0 +1,284 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/braswelljr/axxxe/audit"
+	"github.com/braswelljr/axxxe/database"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/mailer"
+	"github.com/braswelljr/axxxe/model"
+	"github.com/braswelljr/axxxe/passwordpolicy"
+)
+
+var invitations = database.OpenCollection(database.Client, "invitations")
+
+func init() {
+	database.CreateIndexes(invitations,
+		mongo.IndexModel{Keys: bson.D{{Key: "email", Value: 1}}},
+	)
+}
+
+// InviteUser - invites a person to create an account with a role. Pending
+// invitations of the email are revoked and a signed invitation link is mailed.
+func InviteUser() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		// params
+		params := &model.InvitationParams{}
+
+		// decode the request body into the params struct
+		if err := ctx.BodyParser(params); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// emails are stored and looked up trimmed and lowercased
+		params.Email = helper.NormalizeEmail(params.Email)
+
+		// validate the params
+		if err := validate.Struct(params); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// only users managing roles can invite to roles other than USER, api
+		// keys only invite users
+		if params.Role != model.RoleUser && (helper.IsAPIKey(ctx) || !helper.Can(ctx, model.PermissionUsersManageRoles)) {
+			return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":  "Unauthorised to invite users with the role " + params.Role,
+				"status": fiber.StatusForbidden,
+			})
+		}
+
+		// check if the user already exists
+		if err := collection.FindOne(contxt, bson.M{"email": params.Email}).Decode(&model.User{}); err == nil {
+			return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":  "User already exists",
+				"status": fiber.StatusConflict,
+			})
+		}
+
+		// revoke the pending invitations of the email
+		now := time.Now()
+		if _, err := invitations.UpdateMany(
+			contxt,
+			bson.M{
+				"email":       params.Email,
+				"accepted_at": bson.M{"$exists": false},
+				"revoked_at":  bson.M{"$exists": false},
+			},
+			bson.M{"$set": bson.M{"revoked_at": primitive.NewDateTimeFromTime(now)}},
+		); err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		// create the invitation
+		ttl := helper.GetEnvDuration("INVITATION_TTL", 72*time.Hour)
+		invitation := &model.Invitation{
+			Id:        primitive.NewObjectID(),
+			Email:     params.Email,
+			Role:      params.Role,
+			InvitedBy: helper.CurrentUserId(ctx),
+			CreatedAt: primitive.NewDateTimeFromTime(now),
+			ExpiresAt: primitive.NewDateTimeFromTime(now.Add(ttl)),
+		}
+		if _, err := invitations.InsertOne(contxt, invitation); err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		// send the invitation
+		if err := sendInvitation(contxt, invitation, ttl); err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+		audit.Log(ctx, model.AuditInvitationSent, "", map[string]string{"invitation_id": invitation.Id.Hex(), "email_hash": audit.HashEmail(invitation.Email), "role": invitation.Role})
+
+		return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"message": "Invitation sent",
+			"payload": invitation,
+			"status":  fiber.StatusCreated,
+		})
+	}
+}
+
+// AcceptInvitation - creates the account of an invited person with the role of
+// the invitation and logs them in. An invitation can only be accepted once.
+func AcceptInvitation() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		// params
+		params := &model.AcceptInvitationParams{}
+
+		// decode the request body into the params struct
+		if err := ctx.BodyParser(params); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// validate the params
+		if err := validate.Struct(params); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// verify the invitation token
+		claims, err := helper.ValidateActionToken(helper.InvitationToken, params.Token)
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  "Invalid or expired invitation",
+				"status": fiber.StatusBadRequest,
+			})
+		}
+		invitationId, err := primitive.ObjectIDFromHex(claims.Subject)
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  "Invalid or expired invitation",
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// the user to create
+		now := primitive.NewDateTimeFromTime(time.Now())
+		user := &model.User{
+			Id:         primitive.NewObjectID(),
+			Username:   params.Username,
+			Firstname:  params.Firstname,
+			Lastname:   params.Lastname,
+			Email:      claims.User.Email,
+			Phone:      params.Phone,
+			Gender:     params.Gender,
+			Role:       claims.User.Role,
+			Status:     model.UserStatusActive,
+			VerifiedAt: now,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+			LastLogin:  now,
+		}
+		user.UserId = user.Id.Hex()
+
+		// check the password against the password policy
+		if err := passwordpolicy.Check(params.Password, user); err != nil {
+			return passwordPolicyError(ctx, err)
+		}
+
+		// check if the user already exists
+		if err := collection.FindOne(contxt, bson.M{"email": user.Email}).Decode(&model.User{}); err == nil {
+			return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":  "User already exists",
+				"status": fiber.StatusConflict,
+			})
+		}
+
+		// hash the user's password
+		if user.Password, err = HashPassword(params.Password); err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		// accept the invitation, once
+		err = invitations.FindOneAndUpdate(
+			contxt,
+			bson.M{
+				"_id":         invitationId,
+				"email":       user.Email,
+				"accepted_at": bson.M{"$exists": false},
+				"revoked_at":  bson.M{"$exists": false},
+				"expires_at":  bson.M{"$gt": now},
+			},
+			bson.M{"$set": bson.M{"accepted_at": now, "user_id": user.UserId}},
+		).Err()
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  "Invalid or expired invitation",
+				"status": fiber.StatusBadRequest,
+			})
+		}
+		if err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		// insert the user into the database, the invitation stays usable when it fails
+		if _, err := collection.InsertOne(contxt, user); err != nil {
+			if _, rollbackErr := invitations.UpdateOne(
+				contxt,
+				bson.M{"_id": invitationId, "user_id": user.UserId},
+				bson.M{"$unset": bson.M{"accepted_at": "", "user_id": ""}},
+			); rollbackErr != nil {
+				log.Printf("Oops! could not reopen invitation %s: %v\n", invitationId.Hex(), rollbackErr)
+			}
+			if mongo.IsDuplicateKeyError(err) {
+				return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error":  "User already exists",
+					"status": fiber.StatusConflict,
+				})
+			}
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		audit.Log(ctx, model.AuditInvitationAccepted, user.UserId, map[string]string{"invitation_id": invitationId.Hex(), "role": user.Role})
+
+		// issue the tokens or a two-factor challenge
+		return completeLogin(ctx, contxt, user)
+	}
+}
+
+// sendInvitation - mails a signed invitation link
+func sendInvitation(contxt context.Context, invitation *model.Invitation, ttl time.Duration) error {
+	// sign the invitation token
+	token, err := helper.GetActionToken(helper.InvitationToken, model.TokenizedUserParams{
+		Email:  invitation.Email,
+		Role:   invitation.Role,
+		UserId: invitation.Id.Hex(),
+	}, ttl)
+	if err != nil {
+		return err
+	}
+
+	link := helper.GetEnv("INVITATION_URL", "http://localhost:5050/accept-invite") + "?token=" + url.QueryEscape(token)
+
+	return mailer.Send(
+		contxt,
+		invitation.Email,
+		"You are invited to axxxe",
+		fmt.Sprintf("Hi,\n\nYou have been invited to join axxxe. Create your account using the link below, it expires in %s.\n\n%s\n", ttl, link),
+	)
+}
@@ -0,0 +1,25 @@
+package authentication
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/braswelljr/axxxe/helper"
+)
+
+// JWKS - publishes the public keys tokens can be verified with
+func JWKS() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		jwks, err := helper.JWKS()
+		if err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		// keys change rarely, let verifiers cache them for a while
+		ctx.Set(fiber.HeaderCacheControl, "public, max-age=300")
+
+		return ctx.Status(fiber.StatusOK).JSON(jwks)
+	}
+}
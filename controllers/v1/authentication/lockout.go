@@ -0,0 +1,110 @@
+package authentication
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/braswelljr/axxxe/audit"
+	"github.com/braswelljr/axxxe/lockout"
+	"github.com/braswelljr/axxxe/model"
+)
+
+var (
+	dummyHash     string
+	dummyHashOnce sync.Once
+)
+
+func init() {
+	// compute the dummy hash ahead of the first login
+	go dummyPasswordHash()
+}
+
+// UnlockUser - clears the failed login attempts of a user, unlocking their account
+func UnlockUser() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		// get the user
+		foundUser := &model.User{}
+		if err := collection.FindOne(contxt, bson.M{"user_id": ctx.Params("user_id")}).Decode(foundUser); err != nil {
+			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":  "User not found",
+				"status": fiber.StatusNotFound,
+			})
+		}
+
+		// clear the attempts
+		if err := lockout.Reset(contxt, lockout.AccountKey(foundUser.Email)); err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+		audit.Log(ctx, model.AuditUserUnlocked, foundUser.UserId, nil)
+
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "User unlocked",
+			"payload": fiber.Map{
+				"user_id": foundUser.UserId,
+			},
+			"status": fiber.StatusOK,
+		})
+	}
+}
+
+// checkLockout - checks if login attempts for any of the keys are locked or
+// backing off and responds with an error if so. Returns false when an attempt
+// can be made, the response must be returned otherwise.
+func checkLockout(ctx *fiber.Ctx, contxt context.Context, keys ...string) (bool, error) {
+	wait, err := lockout.Check(contxt, keys...)
+	if err != nil {
+		return true, ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":  err.Error(),
+			"status": fiber.StatusInternalServerError,
+		})
+	}
+
+	if wait <= 0 {
+		return false, nil
+	}
+
+	ctx.Set(fiber.HeaderRetryAfter, fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+	return true, ctx.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"error":  "Too many failed login attempts, please try again later",
+		"status": fiber.StatusTooManyRequests,
+	})
+}
+
+// invalidCredentials - records a failed login attempt for the keys and responds
+// with the same error whether the email or the password is wrong
+func invalidCredentials(ctx *fiber.Ctx, contxt context.Context, keys ...string) error {
+	if err := lockout.Fail(contxt, keys...); err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":  err.Error(),
+			"status": fiber.StatusInternalServerError,
+		})
+	}
+
+	return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"error":  "Invalid Credentials",
+		"status": fiber.StatusUnauthorized,
+	})
+}
+
+// dummyPasswordHash - a password hash compared against for unknown emails so they
+// take as long to reject as wrong passwords
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = HashPassword("axxxe-dummy-password")
+	})
+
+	return dummyHash
+}
@@ -0,0 +1,74 @@
+package authentication
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/braswelljr/axxxe/database/databasetest"
+	"github.com/braswelljr/axxxe/model"
+)
+
+func TestLoginLockout(t *testing.T) {
+	server := databasetest.Start(t)
+	t.Setenv("LOGIN_BACKOFF_AFTER", "100")
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "2")
+	user := testUser(t, server, model.RoleUser)
+	admin := testUser(t, server, model.RoleAdmin)
+
+	app := fiber.New()
+	app.Post("/login", Login())
+	app.Post("/users/:user_id/unlock", func(ctx *fiber.Ctx) error {
+		ctx.Locals("user_id", admin.UserId)
+		ctx.Locals("role", admin.Role)
+		return ctx.Next()
+	}, UnlockUser())
+
+	login := func(email, password string) *http.Response {
+		t.Helper()
+
+		res, _ := testRequest(t, app, httptest.NewRequest(
+			fiber.MethodPost,
+			"/login",
+			strings.NewReader(`{"email":"`+email+`","password":"`+password+`"}`),
+		))
+
+		return res
+	}
+
+	// wrong passwords fail until the account is locked
+	for i := 0; i < 2; i++ {
+		if got := login(user.Email, "wrong-password").StatusCode; got != fiber.StatusUnauthorized {
+			t.Fatalf("failure %d status = %d, want %d", i+1, got, fiber.StatusUnauthorized)
+		}
+	}
+
+	// the right password is refused while locked, whatever the case of the email
+	locked := login(strings.ToUpper(user.Email), testPassword)
+	if got := locked.StatusCode; got != fiber.StatusTooManyRequests {
+		t.Fatalf("locked status = %d, want %d", got, fiber.StatusTooManyRequests)
+	}
+	if locked.Header.Get(fiber.HeaderRetryAfter) == "" {
+		t.Errorf("expected a Retry-After header")
+	}
+
+	// other accounts from the same ip address are not locked
+	if got := login(admin.Email, testPassword).StatusCode; got != fiber.StatusOK {
+		t.Fatalf("other account status = %d, want %d", got, fiber.StatusOK)
+	}
+
+	// unlocking lets the user log in
+	res, _ := testRequest(t, app, httptest.NewRequest(fiber.MethodPost, "/users/"+user.UserId+"/unlock", nil))
+	if res.StatusCode != fiber.StatusOK {
+		t.Fatalf("unlock status = %d, want %d", res.StatusCode, fiber.StatusOK)
+	}
+	if got := login(user.Email, testPassword).StatusCode; got != fiber.StatusOK {
+		t.Fatalf("unlocked status = %d, want %d", got, fiber.StatusOK)
+	}
+	if len(server.Find(t, "audit_log", map[string]string{"action": model.AuditUserUnlocked, "user_id": user.UserId})) != 1 {
+		t.Errorf("expected the unlock to be audited")
+	}
+}
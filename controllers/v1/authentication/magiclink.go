@@ -0,0 +1,209 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/braswelljr/axxxe/audit"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/lockout"
+	"github.com/braswelljr/axxxe/mailer"
+	"github.com/braswelljr/axxxe/model"
+	"github.com/braswelljr/axxxe/ticket"
+)
+
+// RequestMagicLink - sends a one-time sign-in link to the email of a user.
+// The response is the same, and as fast, whether the email exists or not.
+func RequestMagicLink() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		// params
+		params := &model.MagicLinkParams{}
+
+		// decode the request body into the params struct
+		if err := ctx.BodyParser(params); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// emails are stored and looked up trimmed and lowercased
+		params.Email = helper.NormalizeEmail(params.Email)
+
+		// validate the params
+		if err := validate.Struct(params); err != nil {
+			return ctx.Status(fiber.StatusExpectationFailed).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusExpectationFailed,
+			})
+		}
+
+		// locked accounts can not login with a link either
+		if blocked, err := checkLockout(ctx, contxt, lockout.AccountKey(params.Email), lockout.IPKey(ctx.IP())); blocked {
+			return err
+		}
+
+		// send the link if the user exists, in the background so the response
+		// takes as long for unknown emails
+		foundUser := &model.User{}
+		if err := collection.FindOne(contxt, bson.M{"email": params.Email}).Decode(foundUser); err == nil {
+			go func() {
+				// context, outliving the request
+				contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+				defer cancel()
+
+				if err := sendMagicLink(contxt, foundUser); err != nil {
+					log.Printf("Oops! could not send sign-in link to %s: %v\n", foundUser.UserId, err)
+				}
+			}()
+		}
+
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "If the email belongs to an account, a sign-in link has been sent to it",
+			"status":  fiber.StatusOK,
+		})
+	}
+}
+
+// LoginMagicLink - logs a user in with the token of a sign-in link. Users with
+// two-factor authentication still have to complete the challenge.
+func LoginMagicLink() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		// params
+		params := &model.MagicLinkLoginParams{}
+
+		// decode the request body into the params struct
+		if err := ctx.BodyParser(params); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// validate the params
+		if err := validate.Struct(params); err != nil {
+			return ctx.Status(fiber.StatusExpectationFailed).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusExpectationFailed,
+			})
+		}
+
+		// tokens can be guessed, throttle them like passwords
+		ipKey := lockout.IPKey(ctx.IP())
+		if blocked, err := checkLockout(ctx, contxt, ipKey); blocked {
+			return err
+		}
+
+		// find the user of the link
+		linkTicket, err := ticket.Find(contxt, ticket.MagicLink, params.Token)
+		if errors.Is(err, ticket.ErrInvalidTicket) {
+			return invalidMagicLink(ctx, contxt, ipKey)
+		}
+		if err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+		foundUser := &model.User{}
+		if err := collection.FindOne(contxt, bson.M{"user_id": linkTicket.UserId}).Decode(foundUser); err != nil {
+			return invalidMagicLink(ctx, contxt, ipKey)
+		}
+
+		// the account may have been locked since the link was sent
+		accountKey := lockout.AccountKey(foundUser.Email)
+		if blocked, err := checkLockout(ctx, contxt, accountKey); blocked {
+			return err
+		}
+
+		// use the link
+		if _, err := ticket.Redeem(contxt, ticket.MagicLink, params.Token); err != nil {
+			if errors.Is(err, ticket.ErrInvalidTicket) {
+				return invalidMagicLink(ctx, contxt, ipKey)
+			}
+
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		// the link proves the user owns the email
+		if !foundUser.IsVerified() {
+			now := primitive.NewDateTimeFromTime(time.Now())
+			if _, err := collection.UpdateOne(
+				contxt,
+				bson.M{"user_id": foundUser.UserId, "email": foundUser.Email},
+				bson.M{"$set": bson.M{"status": model.UserStatusActive, "verified_at": now, "updated_at": now}},
+			); err != nil {
+				return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error":  err.Error(),
+					"status": fiber.StatusInternalServerError,
+				})
+			}
+			foundUser.Status, foundUser.VerifiedAt = model.UserStatusActive, now
+		}
+
+		// forget the failed attempts on the account
+		if err := lockout.Reset(contxt, accountKey); err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		// issue the tokens or a two-factor challenge
+		return completeLogin(ctx, contxt, foundUser)
+	}
+}
+
+// invalidMagicLink - records a failed attempt from the ip address and responds
+// with the same error for unknown, used and expired links
+func invalidMagicLink(ctx *fiber.Ctx, contxt context.Context, ipKey string) error {
+	audit.Log(ctx, model.AuditLoginFailed, "", map[string]string{"reason": "invalid sign-in link"})
+	if err := lockout.Fail(contxt, ipKey); err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":  err.Error(),
+			"status": fiber.StatusInternalServerError,
+		})
+	}
+
+	return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"error":  "Invalid or expired sign-in link",
+		"status": fiber.StatusUnauthorized,
+	})
+}
+
+// sendMagicLink - issues a sign-in token and mails the sign-in link to the user
+func sendMagicLink(contxt context.Context, user *model.User) error {
+	ttl := helper.GetEnvDuration("MAGIC_LINK_TTL", 15*time.Minute)
+
+	// issue the sign-in token, previous links stop working
+	token, err := ticket.Issue(contxt, ticket.MagicLink, user.UserId, ttl, nil)
+	if err != nil {
+		return err
+	}
+
+	link := helper.GetEnv("MAGIC_LINK_URL", "http://localhost:5050/magic-link") + "?token=" + url.QueryEscape(token)
+
+	return mailer.Send(
+		contxt,
+		user.Email,
+		"Your sign-in link",
+		fmt.Sprintf("Hi %s,\n\nUse the link below to sign in to axxxe, it expires in %s and can only be used once.\n\n%s\n\nIf you did not ask to sign in, you can ignore this email.\n", user.Username, ttl, link),
+	)
+}
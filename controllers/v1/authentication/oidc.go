@@ -0,0 +1,220 @@
+package authentication
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/model"
+	"github.com/braswelljr/axxxe/oidc"
+)
+
+var (
+	errProviderEmailNotVerified = errors.New("the identity provider has not verified your email")
+	errAccountNotVerified       = errors.New("an account with this email exists, verify its email before logging in with an identity provider")
+)
+
+// OIDCLogin - redirects the user to an identity provider to login
+func OIDCLogin() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		// get the provider
+		provider, err := oidc.Lookup(ctx.Params("provider"))
+		if err != nil {
+			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":  "Unknown identity provider",
+				"status": fiber.StatusNotFound,
+			})
+		}
+
+		// start the login
+		authorizationURL, state, err := oidc.Begin(contxt, provider)
+		if err != nil {
+			return ctx.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadGateway,
+			})
+		}
+
+		// bind the login to the browser
+		helper.SetOIDCStateCookie(ctx, state, oidc.StateTTL())
+
+		return ctx.Redirect(authorizationURL, fiber.StatusFound)
+	}
+}
+
+// OIDCCallback - completes a login with an identity provider. The user is found
+// by the provider account, or by a verified email the account is then linked to,
+// or a new user is created.
+func OIDCCallback() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		// the provider refused the login
+		if reason := ctx.Query("error"); reason != "" {
+			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":  "Login failed: " + reason,
+				"status": fiber.StatusUnauthorized,
+			})
+		}
+
+		// get the provider
+		provider, err := oidc.Lookup(ctx.Params("provider"))
+		if err != nil {
+			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":  "Unknown identity provider",
+				"status": fiber.StatusNotFound,
+			})
+		}
+
+		// the login must have been started by this browser
+		state := ctx.Query("state")
+		cookie := ctx.Cookies(helper.OIDCStateCookie)
+		helper.ClearOIDCStateCookie(ctx)
+		if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookie)) != 1 {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  oidc.ErrInvalidState.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// verify the login
+		claims, err := oidc.Finish(contxt, provider, state, ctx.Query("code"))
+		if err != nil {
+			status := fiber.StatusBadGateway
+			switch {
+			case errors.Is(err, oidc.ErrInvalidState):
+				status = fiber.StatusBadRequest
+			case errors.Is(err, oidc.ErrInvalidIDToken):
+				status = fiber.StatusUnauthorized
+			}
+
+			return ctx.Status(status).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": status,
+			})
+		}
+
+		// find, link or create the user
+		foundUser, err := identityUser(contxt, provider.Name, claims)
+		if err != nil {
+			status := fiber.StatusInternalServerError
+			switch {
+			case errors.Is(err, errProviderEmailNotVerified):
+				status = fiber.StatusForbidden
+			case errors.Is(err, errAccountNotVerified):
+				status = fiber.StatusConflict
+			}
+
+			return ctx.Status(status).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": status,
+			})
+		}
+
+		// issue the tokens or a two-factor challenge
+		return completeLogin(ctx, contxt, foundUser)
+	}
+}
+
+// identityUser - gets the user of a provider account. Accounts are linked to the
+// user with the same email when both the provider and the user verified it, new
+// users are created for unknown verified emails.
+func identityUser(contxt context.Context, provider string, claims *oidc.Claims) (*model.User, error) {
+	// known account
+	foundUser := &model.User{}
+	err := collection.FindOne(contxt, bson.M{
+		"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": claims.Subject}},
+	}).Decode(foundUser)
+	if err == nil {
+		return foundUser, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	// emails are only trusted once verified by the provider
+	if claims.Email == "" || !bool(claims.EmailVerified) {
+		return nil, errProviderEmailNotVerified
+	}
+	claims.Email = helper.NormalizeEmail(claims.Email)
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	identity := model.Identity{
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+		LinkedAt: now,
+	}
+
+	// link the account to the user with the email
+	err = collection.FindOne(contxt, bson.M{"email": claims.Email}).Decode(foundUser)
+	if err == nil {
+		// whoever signed up with the email may not own it
+		if !foundUser.IsVerified() {
+			return nil, errAccountNotVerified
+		}
+
+		if _, err := collection.UpdateOne(
+			contxt,
+			bson.M{"user_id": foundUser.UserId},
+			bson.M{
+				"$push": bson.M{"identities": identity},
+				"$set":  bson.M{"updated_at": now},
+			},
+		); err != nil {
+			return nil, err
+		}
+		foundUser.Identities = append(foundUser.Identities, identity)
+
+		return foundUser, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	// create a user, without a password until one is set with a password reset
+	user := &model.User{
+		Id:         primitive.NewObjectID(),
+		Username:   identityUsername(claims),
+		Firstname:  claims.GivenName,
+		Lastname:   claims.FamilyName,
+		Email:      claims.Email,
+		Role:       model.RoleUser,
+		Status:     model.UserStatusActive,
+		VerifiedAt: now,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		LastLogin:  now,
+		Identities: []model.Identity{identity},
+	}
+	user.UserId = user.Id.Hex()
+
+	if _, err := collection.InsertOne(contxt, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// identityUsername - username of a user created from a provider account
+func identityUsername(claims *oidc.Claims) string {
+	if claims.PreferredUsername != "" {
+		return claims.PreferredUsername
+	}
+
+	return strings.SplitN(claims.Email, "@", 2)[0]
+}
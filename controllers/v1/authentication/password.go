@@ -2,30 +2,39 @@ package authentication
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
 	"time"
 
-	"github.com/braswelljr/axxxe/controllers/v1/user"
-
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"golang.org/x/crypto/bcrypt"
 
+	"github.com/braswelljr/axxxe/audit"
+	"github.com/braswelljr/axxxe/controllers/v1/user"
+	"github.com/braswelljr/axxxe/hasher"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/mailer"
 	"github.com/braswelljr/axxxe/model"
+	"github.com/braswelljr/axxxe/passwordpolicy"
+	"github.com/braswelljr/axxxe/session"
+	"github.com/braswelljr/axxxe/ticket"
 )
 
-// HashPassword to hash the user's password
+// HashPassword to hash the user's password with the current hashing policy
 func HashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return string(hash), err
+	return hasher.Hash(password)
 }
 
 // ComparePasswords to check the user's password
 func ComparePasswords(password, hash string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	return hasher.Verify(password, hash)
 }
 
-// UpdatePassword update users password
+// UpdatePassword update users password. Every session of the user is ended and
+// new tokens are returned for the device making the request.
 func UpdatePassword() fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		// context
@@ -33,7 +42,7 @@ func UpdatePassword() fiber.Handler {
 		defer cancel()
 
 		// password
-		var password *model.PasswordUpdateParams
+		password := &model.PasswordUpdateParams{}
 
 		// get id
 		id := ctx.Params("user_id")
@@ -48,7 +57,7 @@ func UpdatePassword() fiber.Handler {
 		}
 
 		// decode the request body into the user struct
-		if err := ctx.BodyParser(&password); err != nil {
+		if err := ctx.BodyParser(password); err != nil {
 			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error":  err.Error(),
 				"status": fiber.StatusBadRequest,
@@ -71,6 +80,11 @@ func UpdatePassword() fiber.Handler {
 			})
 		}
 
+		// check the new password against the password policy
+		if err := passwordpolicy.Check(password.NewPassword, user); err != nil {
+			return passwordPolicyError(ctx, err)
+		}
+
 		// hash password and update user
 		hash, err := HashPassword(password.NewPassword)
 		if err != nil {
@@ -79,12 +93,41 @@ func UpdatePassword() fiber.Handler {
 				"status": fiber.StatusBadRequest,
 			})
 		}
-		// update the user
-		user.Password = hash
-		user.UpdatedAt = primitive.NewDateTimeFromTime(time.Now())
+		// update the password only, other fields may have changed since the user was read
+		if _, err := collection.UpdateOne(
+			contxt,
+			bson.M{"user_id": user.UserId},
+			bson.M{
+				"$set": bson.M{
+					"password":         hash,
+					"password_history": passwordpolicy.Remember(user.PasswordHistory, user.Password),
+					"updated_at":       primitive.NewDateTimeFromTime(time.Now()),
+				},
+			},
+		); err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+		audit.Log(ctx, model.AuditPasswordChanged, user.UserId, nil)
 
-		// update the user in the database
-		if _, err := collection.UpdateOne(contxt, bson.M{"user_id": user.UserId}, bson.M{"$set": user}); err != nil {
+		// end every session of the user, then start a new one for this device
+		if err := session.RevokeAll(contxt, user.UserId); err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+		token, refreshToken, err := issueTokens(ctx, contxt, user)
+		if err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+		payload, err := tokensPayload(ctx, user.UserId, token, refreshToken)
+		if err != nil {
 			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error":  err.Error(),
 				"status": fiber.StatusInternalServerError,
@@ -93,29 +136,207 @@ func UpdatePassword() fiber.Handler {
 
 		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
 			"message": "Password Updated Successfully",
-			"status":  fiber.StatusNoContent,
+			"payload": payload,
+			"status":  fiber.StatusOK,
 		})
 	}
 }
 
-// ForgotPassword - reset forgotten password
+// ForgotPassword - sends a password reset link to the email of a user.
+// The response is the same, and as fast, whether the email exists or not.
 func ForgotPassword() fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
-		// get user id
-		id := ctx.Params("user_id")
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
 
-		// get user by id
-		_, err := user.GetUserById(id)
+		// params
+		params := &model.ForgotPasswordParams{}
+
+		// decode the request body into the params struct
+		if err := ctx.BodyParser(params); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// emails are stored and looked up trimmed and lowercased
+		params.Email = helper.NormalizeEmail(params.Email)
+
+		// validate the params
+		if err := validate.Struct(params); err != nil {
+			return ctx.Status(fiber.StatusExpectationFailed).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusExpectationFailed,
+			})
+		}
+
+		// send the reset link if the user exists, in the background so the
+		// response takes as long for unknown emails
+		foundUser := &model.User{}
+		if err := collection.FindOne(contxt, bson.M{"email": params.Email}).Decode(foundUser); err == nil {
+			go func() {
+				// context, outliving the request
+				contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+				defer cancel()
+
+				if err := sendPasswordReset(contxt, foundUser); err != nil {
+					log.Printf("Oops! could not send password reset to %s: %v\n", foundUser.UserId, err)
+				}
+			}()
+		}
+
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "If the email belongs to an account, a password reset link has been sent",
+			"status":  fiber.StatusOK,
+		})
+	}
+}
+
+// ResetPassword - sets a new password using a password reset token
+func ResetPassword() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		// params
+		params := &model.PasswordResetParams{}
+
+		// decode the request body into the params struct
+		if err := ctx.BodyParser(params); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// validate the params
+		if err := validate.Struct(params); err != nil {
+			return ctx.Status(fiber.StatusExpectationFailed).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusExpectationFailed,
+			})
+		}
+
+		// find the user of the reset token
+		resetTicket, err := ticket.Find(contxt, ticket.PasswordReset, params.Token)
+		if errors.Is(err, ticket.ErrInvalidTicket) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
 		if err != nil {
 			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error":  err.Error(),
 				"status": fiber.StatusInternalServerError,
 			})
 		}
+		foundUser := &model.User{}
+		if err := collection.FindOne(contxt, bson.M{"user_id": resetTicket.UserId}).Decode(foundUser); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  ticket.ErrInvalidTicket.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// check the new password against the password policy, the token is
+		// only used once the password is accepted
+		if err := passwordpolicy.Check(params.NewPassword, foundUser); err != nil {
+			return passwordPolicyError(ctx, err)
+		}
+
+		// use the reset token
+		if _, err := ticket.Redeem(contxt, ticket.PasswordReset, params.Token); err != nil {
+			if errors.Is(err, ticket.ErrInvalidTicket) {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error":  err.Error(),
+					"status": fiber.StatusBadRequest,
+				})
+			}
+
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		// hash the new password
+		hash, err := HashPassword(params.NewPassword)
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// update the password and end the sessions of the user
+		if _, err := collection.UpdateOne(
+			contxt,
+			bson.M{"user_id": resetTicket.UserId},
+			bson.M{
+				"$set": bson.M{
+					"password":         hash,
+					"password_history": passwordpolicy.Remember(foundUser.PasswordHistory, foundUser.Password),
+					"updated_at":       primitive.NewDateTimeFromTime(time.Now()),
+				},
+			},
+		); err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+		if err := session.RevokeAll(contxt, resetTicket.UserId); err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+		audit.Log(ctx, model.AuditPasswordReset, resetTicket.UserId, nil)
 
 		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
-			"message": "Password Updated Successfully",
-			"status":  fiber.StatusNoContent,
+			"message": "Password Reset Successfully",
+			"status":  fiber.StatusOK,
+		})
+	}
+}
+
+// passwordPolicyError - responds with the rules a new password breaks
+func passwordPolicyError(ctx *fiber.Ctx, err error) error {
+	var policyErr *passwordpolicy.Error
+	if errors.As(err, &policyErr) {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":      policyErr.Error(),
+			"violations": policyErr.Violations,
+			"status":     fiber.StatusBadRequest,
 		})
 	}
+
+	return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error":  err.Error(),
+		"status": fiber.StatusInternalServerError,
+	})
+}
+
+// sendPasswordReset - issues a password reset token and mails the reset link to the user
+func sendPasswordReset(contxt context.Context, user *model.User) error {
+	ttl := helper.GetEnvDuration("PASSWORD_RESET_TTL", 30*time.Minute)
+
+	// issue the reset token
+	token, err := ticket.Issue(contxt, ticket.PasswordReset, user.UserId, ttl, nil)
+	if err != nil {
+		return err
+	}
+
+	link := helper.GetEnv("PASSWORD_RESET_URL", "http://localhost:5050/reset-password") + "?token=" + url.QueryEscape(token)
+
+	return mailer.Send(
+		contxt,
+		user.Email,
+		"Reset your password",
+		fmt.Sprintf("Hi %s,\n\nUse the link below to reset your password, it expires in %s.\n\n%s\n\nIf you did not request a password reset you can ignore this email.\n", user.Username, ttl, link),
+	)
 }
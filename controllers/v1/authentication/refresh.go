@@ -0,0 +1,163 @@
+package authentication
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/braswelljr/axxxe/audit"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/model"
+	"github.com/braswelljr/axxxe/session"
+)
+
+// Refresh - exchanges a refresh token for a new access and refresh token pair.
+// Refresh tokens are rotated on every use, presenting an already used refresh
+// token revokes the whole token family.
+func Refresh() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		// get refresh token params
+		params := struct {
+			RefreshToken string `json:"refresh_token" validate:"required"`
+		}{}
+
+		// decode the request body into the params struct
+		if len(ctx.Body()) > 0 {
+			if err := ctx.BodyParser(&params); err != nil {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error":  err.Error(),
+					"status": fiber.StatusBadRequest,
+				})
+			}
+		}
+
+		// cookie sessions send the refresh token in a cookie, protected by the csrf token
+		if params.RefreshToken == "" && ctx.Cookies(helper.RefreshTokenCookie) != "" {
+			if !helper.ValidCSRFToken(ctx) {
+				return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error":  "Invalid CSRF token",
+					"status": fiber.StatusForbidden,
+				})
+			}
+			params.RefreshToken = ctx.Cookies(helper.RefreshTokenCookie)
+		}
+
+		// validate the params
+		if err := validate.Struct(params); err != nil {
+			return ctx.Status(fiber.StatusExpectationFailed).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusExpectationFailed,
+			})
+		}
+
+		// verify the refresh token
+		claims, err := helper.ValidateRefreshToken(params.RefreshToken)
+		if err != nil {
+			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":  "Invalid refresh token",
+				"status": fiber.StatusUnauthorized,
+			})
+		}
+
+		// check if the session has been revoked
+		revoked, err := session.IsRevoked(contxt, claims.Family, claims.Subject, claims.IssuedAt.Time)
+		if err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+		if revoked {
+			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":  "Invalid refresh token",
+				"status": fiber.StatusUnauthorized,
+			})
+		}
+
+		// get the session of the token
+		foundSession, err := session.Find(contxt, claims.Family)
+		if err != nil || foundSession.UserId != claims.Subject || foundSession.RevokedAt != 0 {
+			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":  "Invalid refresh token",
+				"status": fiber.StatusUnauthorized,
+			})
+		}
+
+		// only the latest refresh token of a session can be used, an older token
+		// being replayed revokes the session
+		if foundSession.RefreshTokenHash != helper.HashToken(params.RefreshToken) {
+			return revokeReplayedSession(ctx, contxt, foundSession)
+		}
+
+		// get the user the token is bound to
+		foundUser := &model.User{}
+		if err := collection.FindOne(contxt, bson.M{"user_id": claims.Subject}).Decode(foundUser); err != nil {
+			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":  "Invalid refresh token",
+				"status": fiber.StatusUnauthorized,
+			})
+		}
+
+		// rotate tokens within the family
+		token, refreshToken, err := helper.GetFamilyTokens(tokenParams(foundUser), claims.Family)
+		if err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		// swap the tokens only if the presented token is still the current one
+		rotated, err := session.Rotate(contxt, claims.Family, params.RefreshToken, refreshToken, ctx.IP())
+		if err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		// the token was used concurrently by someone else
+		if !rotated {
+			return revokeReplayedSession(ctx, contxt, foundSession)
+		}
+
+		audit.Log(ctx, model.AuditTokenRefreshed, foundUser.UserId, map[string]string{"session_id": claims.Family})
+
+		// tokens in the body or in cookies
+		payload, err := tokensPayload(ctx, foundUser.UserId, token, refreshToken)
+		if err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		// return the tokens
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Token refreshed",
+			"payload": payload,
+			"status":  fiber.StatusOK,
+		})
+	}
+}
+
+// revokeReplayedSession - revokes a session whose refresh token was used twice
+func revokeReplayedSession(ctx *fiber.Ctx, contxt context.Context, replayed *model.Session) error {
+	if err := session.Revoke(contxt, replayed.SessionId, replayed.UserId); err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":  err.Error(),
+			"status": fiber.StatusInternalServerError,
+		})
+	}
+	audit.Log(ctx, model.AuditTokenReused, replayed.UserId, map[string]string{"session_id": replayed.SessionId})
+
+	return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"error":  "Invalid refresh token",
+		"status": fiber.StatusUnauthorized,
+	})
+}
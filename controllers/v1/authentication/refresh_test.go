@@ -0,0 +1,129 @@
+package authentication
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/braswelljr/axxxe/database/databasetest"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/model"
+	"github.com/braswelljr/axxxe/session"
+)
+
+// testRefresh - exchanges a refresh token sent in the body
+func testRefresh(t *testing.T, refreshToken string) (*http.Response, fiber.Map) {
+	t.Helper()
+
+	app := fiber.New()
+	app.Post("/refresh", Refresh())
+
+	return testRequest(t, app, httptest.NewRequest(
+		fiber.MethodPost,
+		"/refresh",
+		strings.NewReader(`{"refresh_token":"`+refreshToken+`"}`),
+	))
+}
+
+func TestRefresh(t *testing.T) {
+	server := databasetest.Start(t)
+	user := testUser(t, server, model.RoleUser)
+	_, payload := testLogin(t, user, "")
+	token, _ := payload["token"].(string)
+	refreshToken, _ := payload["refreshToken"].(string)
+
+	// the refresh token is exchanged for a new pair in the same session
+	res, body := testRefresh(t, refreshToken)
+	if res.StatusCode != fiber.StatusOK {
+		t.Fatalf("refresh status = %d, want %d: %v", res.StatusCode, fiber.StatusOK, body)
+	}
+	rotated, _ := body["payload"].(map[string]interface{})
+	newRefreshToken, _ := rotated["refreshToken"].(string)
+	if newRefreshToken == "" || newRefreshToken == refreshToken {
+		t.Fatalf("expected a new refresh token, got %q", newRefreshToken)
+	}
+	family := helper.TokenFamily(refreshToken)
+	if helper.TokenFamily(newRefreshToken) != family {
+		t.Errorf("expected the new refresh token in the session %s", family)
+	}
+	stored := &model.Session{}
+	if !server.FindOne(t, "sessions", bson.M{"session_id": family}, stored) || stored.RefreshTokenHash != helper.HashToken(newRefreshToken) {
+		t.Fatalf("expected the session to store the new refresh token, got %+v", stored)
+	}
+
+	// access tokens are not refresh tokens
+	if res, _ := testRefresh(t, token); res.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("access token status = %d, want %d", res.StatusCode, fiber.StatusUnauthorized)
+	}
+	if res, _ := testRefresh(t, "not-a-token"); res.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("invalid token status = %d, want %d", res.StatusCode, fiber.StatusUnauthorized)
+	}
+
+	// replaying the used refresh token revokes the session, the new refresh
+	// token included
+	if res, _ := testRefresh(t, refreshToken); res.StatusCode != fiber.StatusUnauthorized {
+		t.Fatalf("replayed token status = %d, want %d", res.StatusCode, fiber.StatusUnauthorized)
+	}
+	claims, err := helper.ValidateRefreshToken(newRefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := session.IsRevoked(context.Background(), family, user.UserId, claims.IssuedAt.Time)
+	if err != nil || !revoked {
+		t.Fatalf("expected the session to be revoked, got %v (%v)", revoked, err)
+	}
+	if res, _ := testRefresh(t, newRefreshToken); res.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("new token of a revoked session status = %d, want %d", res.StatusCode, fiber.StatusUnauthorized)
+	}
+	if len(server.Find(t, "audit_log", bson.M{"action": model.AuditTokenReused, "user_id": user.UserId})) != 1 {
+		t.Errorf("expected the reuse to be audited")
+	}
+}
+
+func TestRefreshCookie(t *testing.T) {
+	server := databasetest.Start(t)
+	user := testUser(t, server, model.RoleUser)
+	res, payload := testLogin(t, user, "?mode=cookie")
+	csrfToken, _ := payload["csrf_token"].(string)
+
+	cookies := map[string]string{}
+	for _, cookie := range res.Cookies() {
+		cookies[cookie.Name] = cookie.Value
+	}
+	if cookies[helper.RefreshTokenCookie] == "" || cookies[helper.CSRFTokenCookie] != csrfToken {
+		t.Fatalf("expected the session cookies, got %v", cookies)
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		status int
+	}{
+		{name: "without csrf token", header: "", status: fiber.StatusForbidden},
+		{name: "wrong csrf token", header: "forged", status: fiber.StatusForbidden},
+		{name: "csrf token", header: csrfToken, status: fiber.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Post("/refresh", Refresh())
+
+			req := httptest.NewRequest(fiber.MethodPost, "/refresh?mode=cookie", nil)
+			req.AddCookie(&http.Cookie{Name: helper.RefreshTokenCookie, Value: cookies[helper.RefreshTokenCookie]})
+			req.AddCookie(&http.Cookie{Name: helper.CSRFTokenCookie, Value: csrfToken})
+			if tt.header != "" {
+				req.Header.Set(helper.CSRFTokenHeader, tt.header)
+			}
+			res, body := testRequest(t, app, req)
+			if res.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d: %v", res.StatusCode, tt.status, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/braswelljr/axxxe/audit"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/model"
+	"github.com/braswelljr/axxxe/session"
+)
+
+// ListSessions - gets the active sessions of the authenticated user, the session
+// of the request is marked as current
+func ListSessions() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		// get the session of the authenticated user
+		userId, _ := ctx.Locals("user_id").(string)
+		sessionId, _ := ctx.Locals("session_id").(string)
+
+		// get the sessions
+		sessions, err := session.List(contxt, userId)
+		if err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		// mark the current session
+		for i := range sessions {
+			sessions[i].Current = sessions[i].SessionId == sessionId
+		}
+
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Sessions retrieved successfully",
+			"payload": sessions,
+			"status":  fiber.StatusOK,
+		})
+	}
+}
+
+// RevokeSession - revokes one session of the authenticated user, e.g. a lost device
+func RevokeSession() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		// get the session of the authenticated user
+		userId, _ := ctx.Locals("user_id").(string)
+		currentSessionId, _ := ctx.Locals("session_id").(string)
+		sessionId := ctx.Params("session_id")
+
+		// users can only revoke their own sessions
+		foundSession, err := session.Find(contxt, sessionId)
+		if errors.Is(err, session.ErrNotFound) || (err == nil && (foundSession.UserId != userId || foundSession.RevokedAt != 0)) {
+			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":  "Session not found",
+				"status": fiber.StatusNotFound,
+			})
+		}
+		if err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		// revoke the session
+		if err := session.Revoke(contxt, sessionId, userId); err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		audit.Log(ctx, model.AuditSessionRevoked, userId, map[string]string{"session_id": sessionId})
+
+		// revoking the current session logs out
+		if sessionId == currentSessionId {
+			helper.ClearSessionCookies(ctx)
+		}
+
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Session revoked",
+			"payload": fiber.Map{
+				"session_id": sessionId,
+			},
+			"status": fiber.StatusOK,
+		})
+	}
+}
+
+// RevokeOtherSessions - revokes every session of the authenticated user except
+// the session of the request
+func RevokeOtherSessions() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		// get the session of the authenticated user
+		userId, _ := ctx.Locals("user_id").(string)
+		sessionId, _ := ctx.Locals("session_id").(string)
+
+		// revoke the other sessions
+		revoked, err := session.RevokeOthers(contxt, userId, sessionId)
+		if err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+		audit.Log(ctx, model.AuditSessionRevoked, userId, map[string]string{"kept_session_id": sessionId, "revoked": strconv.Itoa(revoked)})
+
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Other sessions revoked",
+			"payload": fiber.Map{
+				"revoked": revoked,
+			},
+			"status": fiber.StatusOK,
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package authentication
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/braswelljr/axxxe/database/databasetest"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/middleware"
+	"github.com/braswelljr/axxxe/model"
+)
+
+// sessionOf - the session of an access token
+func sessionOf(t *testing.T, token string) string {
+	t.Helper()
+
+	claims, err := helper.ValidateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return claims.ID
+}
+
+func TestSessions(t *testing.T) {
+	server := databasetest.Start(t)
+	user := testUser(t, server, model.RoleUser)
+	other := testUser(t, server, model.RoleUser)
+
+	app := testSessionApp()
+	app.Post("/login", Login())
+	app.Get("/sessions", middleware.Authenticate(), ListSessions())
+	app.Delete("/sessions", middleware.Authenticate(), RevokeOtherSessions())
+	app.Delete("/sessions/:session_id", middleware.Authenticate(), RevokeSession())
+
+	// sessions on devices named by the client or after their user agent
+	login := func(user *model.User, header, value string) string {
+		t.Helper()
+
+		req := httptest.NewRequest(fiber.MethodPost, "/login", strings.NewReader(`{"email":"`+user.Email+`","password":"`+testPassword+`"}`))
+		req.Header.Set(header, value)
+		res, body := testRequest(t, app, req)
+		if res.StatusCode != fiber.StatusOK {
+			t.Fatalf("login status = %d, want %d", res.StatusCode, fiber.StatusOK)
+		}
+
+		return body["payload"].(map[string]interface{})["token"].(string)
+	}
+	laptop := login(user, fiber.HeaderUserAgent, "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:109.0) Gecko/20100101 Firefox/119.0")
+	phone := login(user, "X-Device-Name", "Jane's phone")
+	tablet := login(user, fiber.HeaderUserAgent, "Mozilla/5.0 (iPad; CPU OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Version/17.0 Safari/604.1")
+	others := login(other, fiber.HeaderUserAgent, "curl/8.0")
+
+	list := func(token string) []interface{} {
+		t.Helper()
+
+		req := httptest.NewRequest(fiber.MethodGet, "/sessions", nil)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+		res, body := testRequest(t, app, req)
+		if res.StatusCode != fiber.StatusOK {
+			t.Fatalf("list status = %d, want %d", res.StatusCode, fiber.StatusOK)
+		}
+
+		return body["payload"].([]interface{})
+	}
+
+	// only the sessions of the user are listed, the current one marked
+	sessions := list(laptop)
+	if len(sessions) != 3 {
+		t.Fatalf("expected 3 sessions, got %d", len(sessions))
+	}
+	devices := map[string]bool{}
+	current := ""
+	for _, s := range sessions {
+		s := s.(map[string]interface{})
+		devices[s["device_name"].(string)] = true
+		if _, ok := s["refresh_token_hash"]; ok {
+			t.Errorf("expected the refresh token hash to be hidden")
+		}
+		if s["current"] == true {
+			current = s["id"].(string)
+		}
+	}
+	for _, device := range []string{"Firefox on Windows", "Jane's phone", "Safari on iPad"} {
+		if !devices[device] {
+			t.Errorf("expected a session on %s, got %v", device, devices)
+		}
+	}
+	if current != sessionOf(t, laptop) {
+		t.Errorf("expected the current session to be %s, got %s", sessionOf(t, laptop), current)
+	}
+
+	// users can not revoke the sessions of others
+	if status := testAuthenticated(t, app, fiber.MethodDelete, "/sessions/"+sessionOf(t, others), laptop); status != fiber.StatusNotFound {
+		t.Errorf("other user session status = %d, want %d", status, fiber.StatusNotFound)
+	}
+	if status := testAuthenticated(t, app, fiber.MethodGet, "/me", others); status != fiber.StatusOK {
+		t.Errorf("other user status = %d, want %d", status, fiber.StatusOK)
+	}
+
+	// a lost device is revoked, twice is not found
+	if status := testAuthenticated(t, app, fiber.MethodDelete, "/sessions/"+sessionOf(t, phone), laptop); status != fiber.StatusOK {
+		t.Fatalf("revoke status = %d, want %d", status, fiber.StatusOK)
+	}
+	if status := testAuthenticated(t, app, fiber.MethodGet, "/me", phone); status != fiber.StatusUnauthorized {
+		t.Errorf("revoked session status = %d, want %d", status, fiber.StatusUnauthorized)
+	}
+	if status := testAuthenticated(t, app, fiber.MethodDelete, "/sessions/"+sessionOf(t, phone), laptop); status != fiber.StatusNotFound {
+		t.Errorf("revoked twice status = %d, want %d", status, fiber.StatusNotFound)
+	}
+	if sessions := list(laptop); len(sessions) != 2 {
+		t.Errorf("expected 2 sessions after revoking one, got %d", len(sessions))
+	}
+
+	// the other sessions are revoked, not the current one
+	if status := testAuthenticated(t, app, fiber.MethodDelete, "/sessions", laptop); status != fiber.StatusOK {
+		t.Fatalf("revoke others status = %d, want %d", status, fiber.StatusOK)
+	}
+	if status := testAuthenticated(t, app, fiber.MethodGet, "/me", tablet); status != fiber.StatusUnauthorized {
+		t.Errorf("other session status = %d, want %d", status, fiber.StatusUnauthorized)
+	}
+	if status := testAuthenticated(t, app, fiber.MethodGet, "/me", laptop); status != fiber.StatusOK {
+		t.Errorf("current session status = %d, want %d", status, fiber.StatusOK)
+	}
+	if sessions := list(laptop); len(sessions) != 1 {
+		t.Errorf("expected 1 session left, got %d", len(sessions))
+	}
+}
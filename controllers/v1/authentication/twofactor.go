@@ -0,0 +1,674 @@
+package authentication
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/braswelljr/axxxe/audit"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/lockout"
+	"github.com/braswelljr/axxxe/model"
+	"github.com/braswelljr/axxxe/totp"
+)
+
+const (
+	// recoveryCodeCount - number of recovery codes generated for a user
+	recoveryCodeCount = 10
+	// recoveryCodeAlphabet - 32 unambiguous characters recovery codes are made of
+	recoveryCodeAlphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+)
+
+var errInvalidTwoFactorCode = errors.New("invalid two-factor code")
+
+// EnrollTwoFactor - starts two-factor enrollment of the authenticated user.
+// Returns a new secret and its otpauth URI, the secret is only used once
+// confirmed with ConfirmTwoFactor.
+func EnrollTwoFactor() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		// get the authenticated user
+		foundUser, err := authenticatedUser(ctx, contxt)
+		if err != nil {
+			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusNotFound,
+			})
+		}
+
+		if foundUser.TwoFactor.Enabled {
+			return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":  "Two-factor authentication is already enabled",
+				"status": fiber.StatusConflict,
+			})
+		}
+
+		return startTwoFactorEnrollment(ctx, contxt, foundUser)
+	}
+}
+
+// ConfirmTwoFactor - enables two-factor authentication of the authenticated user
+// with a code of the enrolled secret and returns the recovery codes
+func ConfirmTwoFactor() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		// params
+		params := &model.TwoFactorCodeParams{}
+
+		// decode the request body into the params struct
+		if err := ctx.BodyParser(params); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// validate the params
+		if err := validate.Struct(params); err != nil {
+			return ctx.Status(fiber.StatusExpectationFailed).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusExpectationFailed,
+			})
+		}
+
+		// get the authenticated user
+		foundUser, err := authenticatedUser(ctx, contxt)
+		if err != nil {
+			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusNotFound,
+			})
+		}
+
+		// enable two-factor authentication
+		recoveryCodes, err := confirmTwoFactorEnrollment(contxt, foundUser, params.Code)
+		if err != nil {
+			return twoFactorError(ctx, err)
+		}
+		audit.Log(ctx, model.AuditTwoFactorEnabled, foundUser.UserId, nil)
+
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Two-factor authentication enabled",
+			"payload": fiber.Map{
+				"recovery_codes": recoveryCodes,
+			},
+			"status": fiber.StatusOK,
+		})
+	}
+}
+
+// DisableTwoFactor - disables two-factor authentication of the authenticated user.
+// Users required to use two-factor authentication by policy can not disable it.
+func DisableTwoFactor() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		// params
+		params := &model.TwoFactorDisableParams{}
+
+		// decode the request body into the params struct
+		if err := ctx.BodyParser(params); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// validate the params
+		if err := validate.Struct(params); err != nil {
+			return ctx.Status(fiber.StatusExpectationFailed).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusExpectationFailed,
+			})
+		}
+
+		// get the authenticated user
+		foundUser, err := authenticatedUser(ctx, contxt)
+		if err != nil {
+			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusNotFound,
+			})
+		}
+
+		if twoFactorRequired(foundUser) {
+			return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":  "Two-factor authentication is required for your account",
+				"status": fiber.StatusForbidden,
+			})
+		}
+
+		// check the password and the code
+		if err := ComparePasswords(params.Password, foundUser.Password); err != nil {
+			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":  "Invalid Credentials",
+				"status": fiber.StatusUnauthorized,
+			})
+		}
+		if err := verifyTwoFactor(contxt, foundUser, params.Code, ""); err != nil {
+			return twoFactorError(ctx, err)
+		}
+
+		// disable two-factor authentication
+		if _, err := collection.UpdateOne(
+			contxt,
+			bson.M{"user_id": foundUser.UserId},
+			bson.M{
+				"$unset": bson.M{"two_factor": ""},
+				"$set":   bson.M{"updated_at": primitive.NewDateTimeFromTime(time.Now())},
+			},
+		); err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+		audit.Log(ctx, model.AuditTwoFactorDisabled, foundUser.UserId, nil)
+
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Two-factor authentication disabled",
+			"status":  fiber.StatusOK,
+		})
+	}
+}
+
+// RegenerateRecoveryCodes - replaces the recovery codes of the authenticated user
+func RegenerateRecoveryCodes() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		// params
+		params := &model.TwoFactorCodeParams{}
+
+		// decode the request body into the params struct
+		if err := ctx.BodyParser(params); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// validate the params
+		if err := validate.Struct(params); err != nil {
+			return ctx.Status(fiber.StatusExpectationFailed).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusExpectationFailed,
+			})
+		}
+
+		// get the authenticated user
+		foundUser, err := authenticatedUser(ctx, contxt)
+		if err != nil {
+			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusNotFound,
+			})
+		}
+
+		// check the code
+		if err := verifyTwoFactor(contxt, foundUser, params.Code, ""); err != nil {
+			return twoFactorError(ctx, err)
+		}
+
+		// replace the recovery codes
+		recoveryCodes, hashes, err := generateRecoveryCodes()
+		if err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+		if _, err := collection.UpdateOne(
+			contxt,
+			bson.M{"user_id": foundUser.UserId, "two_factor.enabled": true},
+			bson.M{"$set": bson.M{"two_factor.recovery_codes": hashes}},
+		); err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Recovery codes regenerated",
+			"payload": fiber.Map{
+				"recovery_codes": recoveryCodes,
+			},
+			"status": fiber.StatusOK,
+		})
+	}
+}
+
+// LoginTwoFactor - completes a login challenge with a TOTP code or a recovery code
+func LoginTwoFactor() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		// params
+		params := &model.TwoFactorChallengeParams{}
+
+		// decode the request body into the params struct
+		if err := ctx.BodyParser(params); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// validate the params
+		if err := validate.Struct(params); err != nil {
+			return ctx.Status(fiber.StatusExpectationFailed).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusExpectationFailed,
+			})
+		}
+
+		// get the user of the challenge
+		foundUser, err := challengedUser(contxt, helper.TwoFactorChallengeToken, params.ChallengeToken)
+		if err != nil || !foundUser.TwoFactor.Enabled {
+			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":  "Invalid or expired challenge",
+				"status": fiber.StatusUnauthorized,
+			})
+		}
+
+		// codes can be guessed, throttle them like passwords
+		attemptKeys := []string{lockout.AccountKey(foundUser.Email), lockout.IPKey(ctx.IP())}
+		if blocked, err := checkLockout(ctx, contxt, attemptKeys...); blocked {
+			return err
+		}
+
+		// check the code
+		if err := verifyTwoFactor(contxt, foundUser, params.Code, params.RecoveryCode); err != nil {
+			if errors.Is(err, errInvalidTwoFactorCode) {
+				audit.Log(ctx, model.AuditLoginFailed, foundUser.UserId, map[string]string{"reason": "invalid two-factor code"})
+				if err := lockout.Fail(contxt, attemptKeys...); err != nil {
+					return twoFactorError(ctx, err)
+				}
+			}
+			return twoFactorError(ctx, err)
+		}
+
+		// forget the failed attempts on the account
+		if err := lockout.Reset(contxt, lockout.AccountKey(foundUser.Email)); err != nil {
+			return twoFactorError(ctx, err)
+		}
+
+		return issueLoginTokens(ctx, contxt, foundUser, nil)
+	}
+}
+
+// LoginEnrollTwoFactor - starts two-factor enrollment of a user required to use it
+// by policy, using the enrollment challenge returned by login
+func LoginEnrollTwoFactor() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		// params
+		params := struct {
+			ChallengeToken string `json:"challenge_token" validate:"required"`
+		}{}
+
+		// decode the request body into the params struct
+		if err := ctx.BodyParser(&params); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// validate the params
+		if err := validate.Struct(params); err != nil {
+			return ctx.Status(fiber.StatusExpectationFailed).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusExpectationFailed,
+			})
+		}
+
+		// get the user of the challenge
+		foundUser, err := challengedUser(contxt, helper.TwoFactorEnrollmentToken, params.ChallengeToken)
+		if err != nil || foundUser.TwoFactor.Enabled {
+			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":  "Invalid or expired challenge",
+				"status": fiber.StatusUnauthorized,
+			})
+		}
+
+		return startTwoFactorEnrollment(ctx, contxt, foundUser)
+	}
+}
+
+// LoginConfirmTwoFactor - enables two-factor authentication of a user enrolling
+// during login and completes the login
+func LoginConfirmTwoFactor() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		// params
+		params := struct {
+			ChallengeToken string `json:"challenge_token" validate:"required"`
+			Code           string `json:"code" validate:"required,numeric,len=6"`
+		}{}
+
+		// decode the request body into the params struct
+		if err := ctx.BodyParser(&params); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// validate the params
+		if err := validate.Struct(params); err != nil {
+			return ctx.Status(fiber.StatusExpectationFailed).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusExpectationFailed,
+			})
+		}
+
+		// get the user of the challenge
+		foundUser, err := challengedUser(contxt, helper.TwoFactorEnrollmentToken, params.ChallengeToken)
+		if err != nil || foundUser.TwoFactor.Enabled {
+			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":  "Invalid or expired challenge",
+				"status": fiber.StatusUnauthorized,
+			})
+		}
+
+		// enable two-factor authentication
+		recoveryCodes, err := confirmTwoFactorEnrollment(contxt, foundUser, params.Code)
+		if err != nil {
+			return twoFactorError(ctx, err)
+		}
+		audit.Log(ctx, model.AuditTwoFactorEnabled, foundUser.UserId, nil)
+
+		return issueLoginTokens(ctx, contxt, foundUser, fiber.Map{"recovery_codes": recoveryCodes})
+	}
+}
+
+// issueLoginTokens - issues the tokens of a user who completed the login, extra
+// values are added to the payload
+func issueLoginTokens(ctx *fiber.Ctx, contxt context.Context, user *model.User, extra fiber.Map) error {
+	// get tokens
+	token, refreshToken, err := issueTokens(ctx, contxt, user)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":  err.Error(),
+			"status": fiber.StatusInternalServerError,
+		})
+	}
+
+	// tokens in the body or in cookies
+	payload, err := tokensPayload(ctx, user.UserId, token, refreshToken)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":  err.Error(),
+			"status": fiber.StatusInternalServerError,
+		})
+	}
+	for key, value := range extra {
+		payload[key] = value
+	}
+	audit.Log(ctx, model.AuditLoginSucceeded, user.UserId, nil)
+
+	// return the user
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Login successful",
+		"payload": payload,
+		"status":  fiber.StatusOK,
+	})
+}
+
+// twoFactorRequired - checks if the policy requires a user to use two-factor authentication.
+// The roles required to use it are set with `TWO_FACTOR_REQUIRED_ROLES` (comma separated).
+func twoFactorRequired(user *model.User) bool {
+	for _, role := range helper.GetEnvList("TWO_FACTOR_REQUIRED_ROLES", nil) {
+		if strings.EqualFold(role, user.Role) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// twoFactorChallenge - responds with a short lived challenge token the user has to complete
+func twoFactorChallenge(ctx *fiber.Ctx, user *model.User, tokenType, message string) error {
+	challengeToken, err := helper.GetActionToken(
+		tokenType,
+		model.TokenizedUserParams{UserId: user.UserId},
+		helper.GetEnvDuration("TWO_FACTOR_CHALLENGE_TTL", 5*time.Minute),
+	)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":  err.Error(),
+			"status": fiber.StatusInternalServerError,
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": message,
+		"payload": fiber.Map{
+			"user_id":         user.UserId,
+			"challenge_type":  tokenType,
+			"challenge_token": challengeToken,
+		},
+		"status": fiber.StatusOK,
+	})
+}
+
+// challengedUser - gets the user of a login challenge token
+func challengedUser(contxt context.Context, tokenType, challengeToken string) (*model.User, error) {
+	claims, err := helper.ValidateActionToken(tokenType, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	foundUser := &model.User{}
+	if err := collection.FindOne(contxt, bson.M{"user_id": claims.Subject}).Decode(foundUser); err != nil {
+		return nil, err
+	}
+
+	return foundUser, nil
+}
+
+// authenticatedUser - gets the user of the request
+func authenticatedUser(ctx *fiber.Ctx, contxt context.Context) (*model.User, error) {
+	userId, _ := ctx.Locals("user_id").(string)
+
+	foundUser := &model.User{}
+	if err := collection.FindOne(contxt, bson.M{"user_id": userId}).Decode(foundUser); err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	return foundUser, nil
+}
+
+// startTwoFactorEnrollment - stores a new pending secret for a user and responds with it
+func startTwoFactorEnrollment(ctx *fiber.Ctx, contxt context.Context, user *model.User) error {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":  err.Error(),
+			"status": fiber.StatusInternalServerError,
+		})
+	}
+
+	if _, err := collection.UpdateOne(
+		contxt,
+		bson.M{"user_id": user.UserId},
+		bson.M{"$set": bson.M{"two_factor.pending_secret": secret}},
+	); err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":  err.Error(),
+			"status": fiber.StatusInternalServerError,
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Confirm two-factor authentication with a code from your authenticator app",
+		"payload": fiber.Map{
+			"secret": secret,
+			"uri":    totp.URI(helper.GetEnv("TWO_FACTOR_ISSUER", "axxxe"), user.Email, secret),
+		},
+		"status": fiber.StatusOK,
+	})
+}
+
+// confirmTwoFactorEnrollment - enables two-factor authentication with the pending
+// secret of a user if the code matches and returns new recovery codes
+func confirmTwoFactorEnrollment(contxt context.Context, user *model.User, code string) ([]string, error) {
+	secret := user.TwoFactor.PendingSecret
+	if secret == "" {
+		return nil, errInvalidTwoFactorCode
+	}
+
+	// check the code
+	step, ok := totp.Validate(secret, code, time.Now(), 1)
+	if !ok {
+		return nil, errInvalidTwoFactorCode
+	}
+
+	// generate the recovery codes
+	recoveryCodes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	// enable two-factor authentication if the secret is still pending
+	result, err := collection.UpdateOne(
+		contxt,
+		bson.M{"user_id": user.UserId, "two_factor.pending_secret": secret},
+		bson.M{
+			"$set": bson.M{
+				"two_factor": model.TwoFactor{
+					Enabled:       true,
+					Secret:        secret,
+					RecoveryCodes: hashes,
+					LastStep:      step,
+					EnabledAt:     primitive.NewDateTimeFromTime(time.Now()),
+				},
+				"updated_at": primitive.NewDateTimeFromTime(time.Now()),
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, errInvalidTwoFactorCode
+	}
+
+	return recoveryCodes, nil
+}
+
+// verifyTwoFactor - checks a TOTP code, or a recovery code when no code is given.
+// Accepted codes and recovery codes can not be used again.
+func verifyTwoFactor(contxt context.Context, user *model.User, code, recoveryCode string) error {
+	if !user.TwoFactor.Enabled {
+		return errInvalidTwoFactorCode
+	}
+
+	// recovery code
+	if code == "" {
+		result, err := collection.UpdateOne(
+			contxt,
+			bson.M{"user_id": user.UserId, "two_factor.recovery_codes": helper.HashToken(normalizeRecoveryCode(recoveryCode))},
+			bson.M{"$pull": bson.M{"two_factor.recovery_codes": helper.HashToken(normalizeRecoveryCode(recoveryCode))}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return errInvalidTwoFactorCode
+		}
+
+		return nil
+	}
+
+	// TOTP code
+	step, ok := totp.Validate(user.TwoFactor.Secret, code, time.Now(), 1)
+	if !ok {
+		return errInvalidTwoFactorCode
+	}
+
+	// only accept codes newer than the last accepted one
+	result, err := collection.UpdateOne(
+		contxt,
+		bson.M{
+			"user_id": user.UserId,
+			"$or": bson.A{
+				bson.M{"two_factor.last_step": bson.M{"$exists": false}},
+				bson.M{"two_factor.last_step": bson.M{"$lt": step}},
+			},
+		},
+		bson.M{"$set": bson.M{"two_factor.last_step": step}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+// twoFactorError - responds with a two-factor verification error
+func twoFactorError(ctx *fiber.Ctx, err error) error {
+	if errors.Is(err, errInvalidTwoFactorCode) {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":  "Invalid two-factor code",
+			"status": fiber.StatusUnauthorized,
+		})
+	}
+
+	return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error":  err.Error(),
+		"status": fiber.StatusInternalServerError,
+	})
+}
+
+// generateRecoveryCodes - generates recovery codes and their hashes
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		bytes := make([]byte, 10)
+		if _, err := rand.Read(bytes); err != nil {
+			return nil, nil, err
+		}
+
+		// the alphabet has 32 characters so every byte maps without bias
+		code := make([]byte, len(bytes))
+		for j, b := range bytes {
+			code[j] = recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)]
+		}
+
+		codes[i] = string(code[:5]) + "-" + string(code[5:])
+		hashes[i] = helper.HashToken(normalizeRecoveryCode(codes[i]))
+	}
+
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode - lowercases a recovery code and removes separators
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(code)))
+}
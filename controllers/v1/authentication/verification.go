@@ -0,0 +1,176 @@
+package authentication
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/mailer"
+	"github.com/braswelljr/axxxe/model"
+)
+
+// VerifyEmail - verifies the email of a user with the token from the verification link
+func VerifyEmail() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		// get the token from the link
+		token := ctx.Query("token")
+		if token == "" {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  "Missing verification token",
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// verify the token
+		claims, err := helper.ValidateActionToken(helper.EmailVerificationToken, token)
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  "Invalid or expired verification token",
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// the token is only valid for the email it was sent to
+		if _, err := collection.UpdateOne(
+			contxt,
+			bson.M{
+				"user_id": claims.Subject,
+				"email":   claims.User.Email,
+				"status":  model.UserStatusUnverified,
+			},
+			bson.M{
+				"$set": bson.M{
+					"status":      model.UserStatusActive,
+					"verified_at": primitive.NewDateTimeFromTime(time.Now()),
+					"updated_at":  primitive.NewDateTimeFromTime(time.Now()),
+				},
+			},
+		); err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		// make sure the user is verified
+		foundUser := &model.User{}
+		if err := collection.FindOne(contxt, bson.M{"user_id": claims.Subject, "email": claims.User.Email}).Decode(foundUser); err != nil || !foundUser.IsVerified() {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  "Invalid or expired verification token",
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Email verified, refresh your token to use your verified account",
+			"payload": fiber.Map{
+				"user_id": foundUser.UserId,
+			},
+			"status": fiber.StatusOK,
+		})
+	}
+}
+
+// ResendVerification - sends a new verification email to the authenticated user.
+// Emails can be resent once every `EMAIL_VERIFICATION_RESEND_INTERVAL`.
+func ResendVerification() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		// get the authenticated user
+		userId, _ := ctx.Locals("user_id").(string)
+
+		foundUser := &model.User{}
+		if err := collection.FindOne(contxt, bson.M{"user_id": userId}).Decode(foundUser); err != nil {
+			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":  "User not found",
+				"status": fiber.StatusNotFound,
+			})
+		}
+
+		// nothing to verify
+		if foundUser.IsVerified() {
+			return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":  "Email already verified",
+				"status": fiber.StatusConflict,
+			})
+		}
+
+		// throttle - claim the send slot only if the last email is old enough
+		now := time.Now()
+		interval := helper.GetEnvDuration("EMAIL_VERIFICATION_RESEND_INTERVAL", time.Minute)
+		result, err := collection.UpdateOne(
+			contxt,
+			bson.M{
+				"user_id": userId,
+				"status":  model.UserStatusUnverified,
+				"$or": bson.A{
+					bson.M{"verification_sent_at": bson.M{"$exists": false}},
+					bson.M{"verification_sent_at": bson.M{"$lte": primitive.NewDateTimeFromTime(now.Add(-interval))}},
+				},
+			},
+			bson.M{"$set": bson.M{"verification_sent_at": primitive.NewDateTimeFromTime(now)}},
+		)
+		if err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+		if result.MatchedCount == 0 {
+			retryAfter := foundUser.VerificationSentAt.Time().Add(interval).Sub(now)
+			ctx.Set(fiber.HeaderRetryAfter, fmt.Sprintf("%.0f", retryAfter.Seconds()+1))
+			return ctx.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error":  "Please wait before requesting another verification email",
+				"status": fiber.StatusTooManyRequests,
+			})
+		}
+
+		// send the verification email
+		if err := sendVerificationEmail(contxt, foundUser); err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Verification email sent",
+			"status":  fiber.StatusOK,
+		})
+	}
+}
+
+// sendVerificationEmail - mails a signed verification link to the user
+func sendVerificationEmail(contxt context.Context, user *model.User) error {
+	ttl := helper.GetEnvDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour)
+
+	// sign the verification token
+	token, err := helper.GetActionToken(helper.EmailVerificationToken, model.TokenizedUserParams{
+		Email:  user.Email,
+		UserId: user.UserId,
+	}, ttl)
+	if err != nil {
+		return err
+	}
+
+	link := helper.GetEnv("EMAIL_VERIFICATION_URL", "http://localhost:5050/api/v1/users/verify-email") + "?token=" + url.QueryEscape(token)
+
+	return mailer.Send(
+		contxt,
+		user.Email,
+		"Verify your email",
+		fmt.Sprintf("Hi %s,\n\nWelcome to axxxe! Please verify your email using the link below, it expires in %s.\n\n%s\n", user.Username, ttl, link),
+	)
+}
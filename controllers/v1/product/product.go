@@ -11,6 +11,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	"github.com/braswelljr/axxxe/database"
+	"github.com/braswelljr/axxxe/view"
 )
 
 var (
@@ -68,7 +69,7 @@ func GetProduct() fiber.Handler {
 		// return the product
 		return ctx.Status(200).JSON(fiber.Map{
 			"message":    "User found",
-			"payload":    product,
+			"payload":    view.NewProduct(product),
 			"statusCode": fiber.StatusOK,
 		})
 	}
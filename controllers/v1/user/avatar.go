@@ -0,0 +1,203 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/braswelljr/axxxe/avatar"
+	"github.com/braswelljr/axxxe/model"
+	"github.com/braswelljr/axxxe/storage"
+	"github.com/braswelljr/axxxe/view"
+)
+
+// UploadAvatar - replaces the profile image of a user with the image in the
+// `avatar` field of a multipart form - owner or users with the users:update permission
+func UploadAvatar() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		// get the user
+		user := &model.User{}
+		if err := collection.FindOne(contxt, bson.M{"user_id": ctx.Params("user_id")}).Decode(user); err != nil {
+			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":  "User not found",
+				"status": fiber.StatusNotFound,
+			})
+		}
+
+		// read the upload, without trusting its declared size
+		upload, err := ctx.FormFile("avatar")
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  "Missing avatar file",
+				"status": fiber.StatusBadRequest,
+			})
+		}
+		if upload.Size > int64(avatar.MaxSize()) {
+			return avatarError(ctx, avatar.ErrTooLarge)
+		}
+		file, err := upload.Open()
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+		defer file.Close()
+		data, err := io.ReadAll(io.LimitReader(file, int64(avatar.MaxSize())+1))
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
+		}
+
+		// store the resized images as a new version
+		version, err := avatar.Save(contxt, user.UserId, data)
+		if err != nil {
+			return avatarError(ctx, err)
+		}
+
+		// point the user to the new version
+		previous := user.Avatar
+		user.Avatar = version
+		user.UpdatedAt = primitive.NewDateTimeFromTime(time.Now())
+		if _, err := collection.UpdateOne(
+			contxt,
+			bson.M{"user_id": user.UserId},
+			bson.M{"$set": bson.M{"avatar": user.Avatar, "updated_at": user.UpdatedAt}},
+		); err != nil {
+			if err := avatar.Delete(contxt, user.UserId, version); err != nil {
+				log.Printf("Oops! could not delete avatar %s of %s: %v\n", version, user.UserId, err)
+			}
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		// drop the previous version
+		if previous != "" {
+			if err := avatar.Delete(contxt, user.UserId, previous); err != nil {
+				log.Printf("Oops! could not delete avatar %s of %s: %v\n", previous, user.UserId, err)
+			}
+		}
+
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message":    "Avatar updated",
+			"payload":    view.User(ctx, user),
+			"statusCode": fiber.StatusOK,
+		})
+	}
+}
+
+// DeleteAvatar - removes the profile image of a user - owner or users with the users:update permission
+func DeleteAvatar() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		// unset the avatar, returning the user as it was
+		user := &model.User{}
+		if err := collection.FindOneAndUpdate(
+			contxt,
+			bson.M{"user_id": ctx.Params("user_id")},
+			bson.M{
+				"$unset": bson.M{"avatar": ""},
+				"$set":   bson.M{"updated_at": primitive.NewDateTimeFromTime(time.Now())},
+			},
+		).Decode(user); err != nil {
+			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":  "User not found",
+				"status": fiber.StatusNotFound,
+			})
+		}
+
+		// delete the images
+		if user.Avatar != "" {
+			if err := avatar.Delete(contxt, user.UserId, user.Avatar); err != nil {
+				log.Printf("Oops! could not delete avatar %s of %s: %v\n", user.Avatar, user.UserId, err)
+			}
+		}
+
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message":    "Avatar deleted",
+			"statusCode": fiber.StatusOK,
+		})
+	}
+}
+
+// GetAvatar - serves an image of an avatar. Versions never change, so the images
+// are cached for a year.
+func GetAvatar() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		size, err := strconv.Atoi(ctx.Params("size"))
+		if err != nil {
+			return avatarError(ctx, avatar.ErrInvalidSize)
+		}
+
+		// deleted images are not found, even by clients caching them
+		blob, err := avatar.Open(contxt, ctx.Params("user_id"), ctx.Params("version"), size)
+		if err != nil {
+			return avatarError(ctx, err)
+		}
+
+		// the version and size identify the image
+		etag := `"` + ctx.Params("version") + "-" + strconv.Itoa(size) + `"`
+		if ctx.Get(fiber.HeaderIfNoneMatch) == etag {
+			return ctx.SendStatus(fiber.StatusNotModified)
+		}
+
+		ctx.Set(fiber.HeaderContentType, blob.ContentType)
+		ctx.Set(fiber.HeaderCacheControl, "public, max-age=31536000, immutable")
+		ctx.Set(fiber.HeaderETag, etag)
+		ctx.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+		if !blob.ModTime.IsZero() {
+			ctx.Set(fiber.HeaderLastModified, blob.ModTime.UTC().Format(http.TimeFormat))
+		}
+
+		return ctx.Status(fiber.StatusOK).Send(blob.Data)
+	}
+}
+
+// avatarError - responds to a failed avatar operation
+func avatarError(ctx *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, avatar.ErrTooLarge):
+		return ctx.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error":  err.Error(),
+			"status": fiber.StatusRequestEntityTooLarge,
+		})
+	case errors.Is(err, avatar.ErrUnsupportedType):
+		return ctx.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+			"error":  err.Error(),
+			"status": fiber.StatusUnsupportedMediaType,
+		})
+	case errors.Is(err, avatar.ErrInvalidSize), errors.Is(err, storage.ErrNotFound), errors.Is(err, storage.ErrInvalidKey):
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":  "Avatar not found",
+			"status": fiber.StatusNotFound,
+		})
+	}
+
+	return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error":  err.Error(),
+		"status": fiber.StatusInternalServerError,
+	})
+}
@@ -0,0 +1,74 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/braswelljr/axxxe/database"
+)
+
+func init() {
+	// sort fields with the user id breaking ties, used by keyset pagination
+	models := []mongo.IndexModel{}
+	for _, field := range sortFields {
+		models = append(models, mongo.IndexModel{Keys: bson.D{{Key: field, Value: 1}, {Key: "user_id", Value: 1}}})
+	}
+	models = append(models, mongo.IndexModel{Keys: bson.D{{Key: "role", Value: 1}, {Key: "created_at", Value: -1}}})
+
+	database.CreateIndexes(collection, models...)
+}
+
+// normalizedEmail - the trimmed and lowercased email of a user document
+var normalizedEmail = bson.M{"$toLower": bson.M{"$trim": bson.M{"input": "$email"}}}
+
+// MigrateEmails - normalizes the stored emails and creates the unique email
+// index two users can not share an email with, email swaps rely on it.
+//
+// Emails shared by several users once normalized are not merged: they are
+// reported in the error and must be resolved by hand, the server refuses to
+// start until then.
+func MigrateEmails(ctx context.Context) error {
+	// emails shared by several users
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": normalizedEmail, "user_ids": bson.M{"$push": "$user_id"}, "count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	})
+	if err != nil {
+		return err
+	}
+	duplicates := []struct {
+		Email   string   `bson:"_id"`
+		UserIds []string `bson:"user_ids"`
+	}{}
+	if err := cursor.All(ctx, &duplicates); err != nil {
+		return err
+	}
+	if len(duplicates) > 0 {
+		shared := []string{}
+		for _, duplicate := range duplicates {
+			shared = append(shared, duplicate.Email+" ("+strings.Join(duplicate.UserIds, ", ")+")")
+		}
+		return fmt.Errorf("%d emails are shared by several users: %s", len(duplicates), strings.Join(shared, "; "))
+	}
+
+	// store the emails normalized
+	if _, err := collection.UpdateMany(
+		ctx,
+		bson.M{"$expr": bson.M{"$ne": bson.A{"$email", normalizedEmail}}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"email": normalizedEmail}}}},
+	); err != nil {
+		return err
+	}
+
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+
+	return err
+}
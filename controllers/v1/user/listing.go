@@ -0,0 +1,301 @@
+package user
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/model"
+)
+
+const (
+	// defaultLimit - users per page when no limit is asked for
+	defaultLimit = 20
+	// maxLimit - most users per page
+	maxLimit = 100
+	// defaultSort - newest users first
+	defaultSort = "-created_at"
+)
+
+// sortFields - fields users can be sorted by
+var sortFields = []string{"created_at", "last_login", "username", "email"}
+
+// userStatuses - statuses users can be filtered by
+var userStatuses = []string{model.UserStatusUnverified, model.UserStatusActive, model.UserStatusDeleted}
+
+// listProjection - fields not needed to list users
+var listProjection = bson.M{
+	"password":         0,
+	"password_history": 0,
+}
+
+// listQuery - a page of the user listing asked for by a request
+type listQuery struct {
+	filter bson.M
+	// sortField - field the users are sorted by, descending when desc
+	sortField string
+	desc      bool
+	limit     int64
+	// page - 1-based page number of offset pagination, unused with a cursor
+	page int64
+	// cursor - position after which the page starts, keyset pagination
+	cursor *listCursor
+}
+
+// listCursor - the sort value and user id of the last user of a page
+type listCursor struct {
+	Sort   string      `bson:"s"`
+	Value  interface{} `bson:"v"`
+	UserId string      `bson:"id"`
+}
+
+// parseListQuery - reads the listing params of a request:
+//   - `role` - comma separated roles
+//   - `status` - one of userStatuses
+//   - `created_from`, `created_to` - RFC 3339 times
+//   - `q` - text searched in the username, names and email
+//   - `sort` - one of sortFields, prefixed by `-` for descending order
+//   - `limit` - users per page
+//   - `page` - page number, or `cursor` - the next cursor of the previous page
+func parseListQuery(ctx *fiber.Ctx) (*listQuery, error) {
+	query := &listQuery{filter: bson.M{}, limit: defaultLimit, page: 1}
+
+	// filters
+	if roles := ctx.Query("role"); roles != "" {
+		list := []string{}
+		for _, role := range strings.Split(roles, ",") {
+			role = strings.ToUpper(strings.TrimSpace(role))
+			if !helper.RoleExists(role) {
+				return nil, errors.New("unknown role " + role)
+			}
+			list = append(list, role)
+		}
+		query.filter["role"] = bson.M{"$in": list}
+	}
+	if status := ctx.Query("status"); status != "" {
+		status = strings.ToUpper(strings.TrimSpace(status))
+		if !contains(userStatuses, status) {
+			return nil, errors.New("status must be one of " + strings.Join(userStatuses, ", "))
+		}
+		query.filter["status"] = status
+	}
+	createdAt := bson.M{}
+	for param, operator := range map[string]string{"created_from": "$gte", "created_to": "$lt"} {
+		if value := ctx.Query(param); value != "" {
+			at, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, errors.New(param + " must be an RFC 3339 time")
+			}
+			createdAt[operator] = primitive.NewDateTimeFromTime(at)
+		}
+	}
+	if len(createdAt) > 0 {
+		query.filter["created_at"] = createdAt
+	}
+	if text := strings.TrimSpace(ctx.Query("q")); text != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(text), Options: "i"}
+		query.filter["$or"] = bson.A{
+			bson.M{"username": pattern},
+			bson.M{"firstname": pattern},
+			bson.M{"lastname": pattern},
+			bson.M{"email": pattern},
+		}
+	}
+
+	// sort
+	sort := ctx.Query("sort", defaultSort)
+	query.desc = strings.HasPrefix(sort, "-")
+	query.sortField = strings.TrimPrefix(sort, "-")
+	if !validSortField(query.sortField) {
+		return nil, errors.New("sort must be one of " + strings.Join(sortFields, ", ") + ", prefixed by - for descending order")
+	}
+
+	// page size, `recordsPerPage` is kept for older clients
+	limit := ctx.Query("limit", ctx.Query("recordsPerPage"))
+	if limit != "" {
+		value, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || value < 1 || value > maxLimit {
+			return nil, errors.New("limit must be between 1 and " + strconv.Itoa(maxLimit))
+		}
+		query.limit = value
+	}
+
+	// position
+	if cursor := ctx.Query("cursor"); cursor != "" {
+		decoded, err := decodeCursor(cursor)
+		if err != nil || decoded.Sort != sort {
+			return nil, errors.New("invalid cursor, cursors can only be used with the sort they were issued for")
+		}
+		query.cursor = decoded
+	} else if page := ctx.Query("page"); page != "" {
+		value, err := strconv.ParseInt(page, 10, 64)
+		if err != nil || value < 1 {
+			return nil, errors.New("page must be a positive number")
+		}
+		query.page = value
+	}
+
+	return query, nil
+}
+
+// sortParam - the sort param of the query
+func (q *listQuery) sortParam() string {
+	if q.desc {
+		return "-" + q.sortField
+	}
+
+	return q.sortField
+}
+
+// sort - the mongo sort of the query, ties are broken by the user id
+func (q *listQuery) sort() bson.D {
+	direction := 1
+	if q.desc {
+		direction = -1
+	}
+
+	return bson.D{{Key: q.sortField, Value: direction}, {Key: "user_id", Value: direction}}
+}
+
+// pageFilter - the filter of the query limited to the users after the cursor
+func (q *listQuery) pageFilter() bson.M {
+	if q.cursor == nil {
+		return q.filter
+	}
+
+	operator := "$gt"
+	if q.desc {
+		operator = "$lt"
+	}
+	after := bson.M{"$or": bson.A{
+		bson.M{q.sortField: bson.M{operator: q.cursor.Value}},
+		bson.M{q.sortField: q.cursor.Value, "user_id": bson.M{operator: q.cursor.UserId}},
+	}}
+
+	if len(q.filter) == 0 {
+		return after
+	}
+
+	return bson.M{"$and": bson.A{q.filter, after}}
+}
+
+// skip - number of users before the page with offset pagination
+func (q *listQuery) skip() int64 {
+	if q.cursor != nil {
+		return 0
+	}
+
+	return (q.page - 1) * q.limit
+}
+
+// nextCursor - cursor of the page after a page ending with the user
+func (q *listQuery) nextCursor(last *model.User) (string, error) {
+	var value interface{}
+	switch q.sortField {
+	case "created_at":
+		value = last.CreatedAt
+	case "last_login":
+		value = last.LastLogin
+	case "username":
+		value = last.Username
+	case "email":
+		value = last.Email
+	}
+
+	raw, err := bson.Marshal(listCursor{Sort: q.sortParam(), Value: value, UserId: last.UserId})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// links - the `Link` header of a page, with the next page and for offset
+// pagination the first and previous pages
+func (q *listQuery) links(ctx *fiber.Ctx, next string, total int64) string {
+	link := func(rel string, set map[string]string) string {
+		params := url.Values{}
+		ctx.Context().QueryArgs().VisitAll(func(key, value []byte) {
+			params.Add(string(key), string(value))
+		})
+		params.Del("page")
+		params.Del("cursor")
+		for key, value := range set {
+			params.Set(key, value)
+		}
+
+		return "<" + ctx.BaseURL() + ctx.Path() + "?" + params.Encode() + `>; rel="` + rel + `"`
+	}
+
+	links := []string{}
+	switch {
+	case q.cursor != nil:
+		if next != "" {
+			links = append(links, link("next", map[string]string{"cursor": next}))
+		}
+	default:
+		links = append(links, link("first", map[string]string{"page": "1"}))
+		if q.page > 1 {
+			links = append(links, link("prev", map[string]string{"page": strconv.FormatInt(q.page-1, 10)}))
+		}
+		if q.page*q.limit < total {
+			links = append(links, link("next", map[string]string{"page": strconv.FormatInt(q.page+1, 10)}))
+		}
+	}
+
+	return strings.Join(links, ", ")
+}
+
+// decodeCursor - decodes a cursor made by nextCursor. Cursors come from
+// clients, their value must have the type of the sort field so it can not be
+// a query operator.
+func decodeCursor(cursor string) (*listCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded := &listCursor{}
+	if err := bson.Unmarshal(raw, decoded); err != nil {
+		return nil, err
+	}
+	if decoded.UserId == "" || !validCursorValue(strings.TrimPrefix(decoded.Sort, "-"), decoded.Value) {
+		return nil, errors.New("invalid cursor")
+	}
+
+	return decoded, nil
+}
+
+// validCursorValue - checks if a cursor value has the type of the sort field
+func validCursorValue(sortField string, value interface{}) bool {
+	switch sortField {
+	case "created_at", "last_login":
+		_, ok := value.(primitive.DateTime)
+		return ok
+	case "username", "email":
+		_, ok := value.(string)
+		return ok
+	}
+
+	return false
+}
+
+// validSortField - checks if users can be sorted by a field
+func validSortField(field string) bool {
+	for _, sortField := range sortFields {
+		if sortField == field {
+			return true
+		}
+	}
+
+	return false
+}
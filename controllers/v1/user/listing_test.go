@@ -0,0 +1,196 @@
+package user
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/braswelljr/axxxe/model"
+)
+
+func TestCursor(t *testing.T) {
+	createdAt := primitive.NewDateTimeFromTime(time.Date(2022, 11, 5, 10, 30, 0, 0, time.UTC))
+	lastLogin := primitive.NewDateTimeFromTime(time.Date(2022, 11, 6, 8, 0, 0, 0, time.UTC))
+	last := &model.User{
+		UserId:    "637f1b2c9a1e4b3d2c1a0f9e",
+		Username:  "jane",
+		Email:     "jane@example.com",
+		CreatedAt: createdAt,
+		LastLogin: lastLogin,
+	}
+
+	tests := []struct {
+		sortField string
+		desc      bool
+		value     interface{}
+	}{
+		{sortField: "created_at", desc: true, value: createdAt},
+		{sortField: "created_at", value: createdAt},
+		{sortField: "last_login", desc: true, value: lastLogin},
+		{sortField: "username", value: "jane"},
+		{sortField: "email", desc: true, value: "jane@example.com"},
+	}
+
+	for _, tt := range tests {
+		query := &listQuery{sortField: tt.sortField, desc: tt.desc}
+		t.Run(query.sortParam(), func(t *testing.T) {
+			encoded, err := query.nextCursor(last)
+			if err != nil {
+				t.Fatalf("nextCursor() error = %v", err)
+			}
+
+			decoded, err := decodeCursor(encoded)
+			if err != nil {
+				t.Fatalf("decodeCursor() error = %v", err)
+			}
+			want := &listCursor{Sort: query.sortParam(), Value: tt.value, UserId: last.UserId}
+			if !reflect.DeepEqual(decoded, want) {
+				t.Errorf("decodeCursor() = %#v, want %#v", decoded, want)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	withoutUser, _ := bson.Marshal(listCursor{Sort: "username", Value: "jane"})
+	operator, _ := bson.Marshal(listCursor{Sort: "username", Value: bson.M{"$ne": nil}, UserId: "1"})
+	wrongType, _ := bson.Marshal(listCursor{Sort: "-created_at", Value: "2022-11-05", UserId: "1"})
+	unknownSort, _ := bson.Marshal(listCursor{Sort: "password", Value: "secret", UserId: "1"})
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "not base64", cursor: "not a cursor!"},
+		{name: "padded base64", cursor: base64.URLEncoding.EncodeToString(withoutUser)},
+		{name: "not bson", cursor: base64.RawURLEncoding.EncodeToString([]byte("plain text"))},
+		{name: "without user id", cursor: base64.RawURLEncoding.EncodeToString(withoutUser)},
+		{name: "truncated", cursor: base64.RawURLEncoding.EncodeToString(withoutUser[:len(withoutUser)-3])},
+		{name: "query operator value", cursor: base64.RawURLEncoding.EncodeToString(operator)},
+		{name: "value of another type", cursor: base64.RawURLEncoding.EncodeToString(wrongType)},
+		{name: "unknown sort field", cursor: base64.RawURLEncoding.EncodeToString(unknownSort)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if decoded, err := decodeCursor(tt.cursor); err == nil {
+				t.Errorf("decodeCursor() = %#v, want an error", decoded)
+			}
+		})
+	}
+}
+
+func TestParseListQuery(t *testing.T) {
+	usernameCursor, _ := (&listQuery{sortField: "username"}).nextCursor(&model.User{UserId: "1", Username: "jane"})
+
+	tests := []struct {
+		name  string
+		query string
+		check func(t *testing.T, query *listQuery)
+		ok    bool
+	}{
+		{
+			name: "defaults",
+			ok:   true,
+			check: func(t *testing.T, q *listQuery) {
+				if q.sortField != "created_at" || !q.desc || q.limit != defaultLimit || q.page != 1 || q.cursor != nil || len(q.filter) != 0 {
+					t.Errorf("query = %+v", q)
+				}
+			},
+		},
+		{
+			name:  "offset page",
+			query: "sort=username&limit=10&page=3",
+			ok:    true,
+			check: func(t *testing.T, q *listQuery) {
+				if q.sortField != "username" || q.desc || q.limit != 10 || q.skip() != 20 {
+					t.Errorf("query = %+v, skip %d", q, q.skip())
+				}
+			},
+		},
+		{
+			name:  "older page size param",
+			query: "recordsPerPage=5",
+			ok:    true,
+			check: func(t *testing.T, q *listQuery) {
+				if q.limit != 5 {
+					t.Errorf("limit = %d, want 5", q.limit)
+				}
+			},
+		},
+		{
+			name:  "cursor of the same sort",
+			query: "sort=username&cursor=" + usernameCursor,
+			ok:    true,
+			check: func(t *testing.T, q *listQuery) {
+				if q.cursor == nil || q.cursor.Value != "jane" || q.skip() != 0 {
+					t.Errorf("cursor = %+v, skip %d", q.cursor, q.skip())
+				}
+				after := bson.M{"$or": bson.A{
+					bson.M{"username": bson.M{"$gt": "jane"}},
+					bson.M{"username": "jane", "user_id": bson.M{"$gt": "1"}},
+				}}
+				if filter := q.pageFilter(); !reflect.DeepEqual(filter, after) {
+					t.Errorf("pageFilter() = %v, want %v", filter, after)
+				}
+			},
+		},
+		{
+			name:  "filters",
+			query: "role=user,%20admin&status=active&created_from=2022-01-01T00:00:00Z&q=jane.doe",
+			ok:    true,
+			check: func(t *testing.T, q *listQuery) {
+				if roles := q.filter["role"]; !reflect.DeepEqual(roles, bson.M{"$in": []string{"USER", "ADMIN"}}) {
+					t.Errorf("role filter = %v", roles)
+				}
+				if q.filter["status"] != "ACTIVE" {
+					t.Errorf("status filter = %v", q.filter["status"])
+				}
+				if _, ok := q.filter["created_at"].(bson.M)["$gte"]; !ok {
+					t.Errorf("created_at filter = %v", q.filter["created_at"])
+				}
+				pattern := primitive.Regex{Pattern: `jane\.doe`, Options: "i"}
+				if or, _ := q.filter["$or"].(bson.A); len(or) != 4 || !reflect.DeepEqual(or[0], bson.M{"username": pattern}) {
+					t.Errorf("search filter = %v", q.filter["$or"])
+				}
+			},
+		},
+		{name: "cursor of another sort", query: "sort=-username&cursor=" + usernameCursor},
+		{name: "invalid cursor", query: "cursor=abc"},
+		{name: "unknown sort field", query: "sort=password"},
+		{name: "limit too large", query: "limit=101"},
+		{name: "limit zero", query: "limit=0"},
+		{name: "page zero", query: "page=0"},
+		{name: "unknown role", query: "role=OWNER"},
+		{name: "invalid time", query: "created_to=yesterday"},
+		{name: "unknown status", query: "status=SUSPENDED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var query *listQuery
+			var err error
+			app := fiber.New()
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				query, err = parseListQuery(ctx)
+				return nil
+			})
+			if _, testErr := app.Test(httptest.NewRequest(fiber.MethodGet, "/?"+tt.query, nil)); testErr != nil {
+				t.Fatal(testErr)
+			}
+
+			if (err == nil) != tt.ok {
+				t.Fatalf("parseListQuery() error = %v, want success %v", err, tt.ok)
+			}
+			if tt.check != nil {
+				tt.check(t, query)
+			}
+		})
+	}
+}
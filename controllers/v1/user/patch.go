@@ -0,0 +1,143 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/model"
+	"github.com/braswelljr/axxxe/patch"
+)
+
+// editableFields - fields of a user that can be patched and the struct fields
+// whose validation tags apply to them
+var editableFields = map[string]string{
+	"username":  "Username",
+	"firstname": "Firstname",
+	"lastname":  "Lastname",
+	"email":     "Email",
+	"phone":     "Phone",
+	"gender":    "Gender",
+	"role":      "Role",
+}
+
+// selfEditableFields - fields users can update on their own account, the email is
+// changed with a confirmation link instead
+var selfEditableFields = []string{"username", "firstname", "lastname", "phone", "gender"}
+
+// adminEditableFields - fields users with the users:update permission can update
+// on any account, the role also needs the users:manage-roles permission. API
+// keys can not change emails, a key could otherwise take over accounts with a
+// password reset sent to the new email.
+var adminEditableFields = []string{"username", "firstname", "lastname", "email", "phone", "gender", "role"}
+
+var errUnsupportedPatch = errors.New("unsupported content type, use " + patch.MergePatchType + " or " + patch.JSONPatchType)
+
+// editableDocument - the patchable fields of a user as a JSON document
+func editableDocument(user *model.User) map[string]interface{} {
+	return map[string]interface{}{
+		"username":  user.Username,
+		"firstname": user.Firstname,
+		"lastname":  user.Lastname,
+		"email":     user.Email,
+		"phone":     user.Phone,
+		"gender":    user.Gender,
+		"role":      user.Role,
+	}
+}
+
+// patchDocument - applies the patch in the body of a request to a document, as a
+// merge patch or a json patch depending on the content type. Plain JSON bodies
+// are merge patches.
+func patchDocument(ctx *fiber.Ctx, document map[string]interface{}) (map[string]interface{}, error) {
+	contentType := strings.TrimSpace(strings.Split(ctx.Get(fiber.HeaderContentType), ";")[0])
+
+	switch strings.ToLower(contentType) {
+	case patch.MergePatchType, fiber.MIMEApplicationJSON:
+		return patch.Merge(document, ctx.Body())
+	case patch.JSONPatchType:
+		return patch.Apply(document, ctx.Body())
+	}
+
+	return nil, errUnsupportedPatch
+}
+
+// editableBy - the fields of a user the authenticated user can update
+func editableBy(ctx *fiber.Ctx, userId string) []string {
+	if !helper.Can(ctx, model.PermissionUsersUpdate) {
+		if helper.IsOwner(ctx, userId) {
+			return selfEditableFields
+		}
+		return nil
+	}
+
+	fields := []string{}
+	for _, field := range adminEditableFields {
+		if field == "role" && !helper.Can(ctx, model.PermissionUsersManageRoles) {
+			continue
+		}
+		if field == "email" && helper.IsAPIKey(ctx) {
+			continue
+		}
+		fields = append(fields, field)
+	}
+
+	return fields
+}
+
+// applyChanges - sets the changed fields of a patched document on a user,
+// removed fields are emptied and emails normalized. Returns the struct fields
+// to validate.
+func applyChanges(user *model.User, patched map[string]interface{}, changes []string) ([]string, error) {
+	values := map[string]interface{}{}
+	structFields := []string{}
+	for _, field := range changes {
+		value, ok := patched[field]
+		if !ok || value == nil {
+			value = ""
+		}
+		values[field] = value
+		structFields = append(structFields, editableFields[field])
+	}
+
+	// decoding checks the types of the values
+	raw, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, user); err != nil {
+		return nil, errors.New("invalid value: " + err.Error())
+	}
+
+	// emails are stored and looked up trimmed and lowercased
+	user.Email = helper.NormalizeEmail(user.Email)
+
+	return structFields, nil
+}
+
+// changedValues - the values of the changed fields of a user, taken from the
+// user rather than the patch so they are stored as validated
+func changedValues(user *model.User, changes []string) bson.M {
+	document := editableDocument(user)
+	values := bson.M{}
+	for _, field := range changes {
+		values[field] = document[field]
+	}
+
+	return values
+}
+
+// contains - checks if a list contains a value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,118 @@
+package user
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/braswelljr/axxxe/model"
+	"github.com/braswelljr/axxxe/patch"
+)
+
+func TestEditableBy(t *testing.T) {
+	const userId = "637f1b2c9a1e4b3d2c1a0f9e"
+
+	tests := []struct {
+		name   string
+		locals map[string]interface{}
+		want   []string
+	}{
+		{
+			name:   "owner",
+			locals: map[string]interface{}{"user_id": userId, "role": model.RoleUser},
+			want:   selfEditableFields,
+		},
+		{
+			name:   "other user",
+			locals: map[string]interface{}{"user_id": "637f1b2c9a1e4b3d2c1a0f9f", "role": model.RoleUser},
+		},
+		{
+			name:   "admin",
+			locals: map[string]interface{}{"user_id": "637f1b2c9a1e4b3d2c1a0f9f", "role": model.RoleAdmin},
+			want:   adminEditableFields,
+		},
+		{
+			name:   "api key",
+			locals: map[string]interface{}{"api_key_id": "637f1b2c9a1e4b3d2c1a0fa0", "permissions": []string{model.PermissionUsersUpdate}},
+			want:   []string{"username", "firstname", "lastname", "phone", "gender"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			app := fiber.New()
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				for key, value := range tt.locals {
+					ctx.Locals(key, value)
+				}
+				got = editableBy(ctx, userId)
+				return nil
+			})
+
+			if _, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil)); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("editableBy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyChanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   string
+		fields  []string
+		update  bson.M
+		wantErr bool
+	}{
+		{
+			name:   "email is normalized",
+			patch:  `{"email":" Jane.Doe@Example.COM "}`,
+			fields: []string{"Email"},
+			update: bson.M{"email": "jane.doe@example.com"},
+		},
+		{
+			name:   "removed fields are emptied",
+			patch:  `{"phone":null,"lastname":"Smith"}`,
+			fields: []string{"Lastname", "Phone"},
+			update: bson.M{"lastname": "Smith", "phone": ""},
+		},
+		{
+			name:    "values are typed",
+			patch:   `{"username":42}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &model.User{Username: "jane", Email: "jane@example.com", Phone: "+233200000000", Role: model.RoleUser}
+			document := editableDocument(user)
+			patched, err := patch.Merge(document, []byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			changes := patch.Changes(document, patched)
+
+			fields, err := applyChanges(user, patched, changes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyChanges() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("applyChanges() = %v, want %v", fields, tt.fields)
+			}
+			if update := changedValues(user, changes); !reflect.DeepEqual(update, tt.update) {
+				t.Errorf("changedValues() = %v, want %v", update, tt.update)
+			}
+		})
+	}
+}
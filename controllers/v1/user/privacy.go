@@ -0,0 +1,155 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/braswelljr/axxxe/audit"
+	"github.com/braswelljr/axxxe/hasher"
+	"github.com/braswelljr/axxxe/mailer"
+	"github.com/braswelljr/axxxe/model"
+	"github.com/braswelljr/axxxe/privacy"
+)
+
+// ExportUser - downloads a JSON archive of the personal data of the user - owner only
+func ExportUser() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		// get the user
+		foundUser := &model.User{}
+		if err := collection.FindOne(contxt, bson.M{"user_id": ctx.Params("user_id")}).Decode(foundUser); err != nil {
+			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":  "User not found",
+				"status": fiber.StatusNotFound,
+			})
+		}
+
+		// collect the data
+		export, err := privacy.Export(contxt, foundUser)
+		if err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		audit.Log(ctx, model.AuditDataExport, foundUser.UserId, nil)
+
+		// download as a file
+		ctx.Attachment("axxxe-export-" + foundUser.UserId + ".json")
+		return ctx.Status(fiber.StatusOK).JSON(export)
+	}
+}
+
+// RequestDeletion - schedules the deletion of the account of the user at the end
+// of the grace period - owner only
+func RequestDeletion() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		// params
+		params := &model.DeletionParams{}
+
+		// decode the request body into the params struct
+		if len(ctx.Body()) > 0 {
+			if err := ctx.BodyParser(params); err != nil {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error":  err.Error(),
+					"status": fiber.StatusBadRequest,
+				})
+			}
+		}
+
+		// get the user
+		foundUser := &model.User{}
+		if err := collection.FindOne(contxt, bson.M{"user_id": ctx.Params("user_id")}).Decode(foundUser); err != nil {
+			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":  "User not found",
+				"status": fiber.StatusNotFound,
+			})
+		}
+
+		// confirm with the password, when the user has one
+		if foundUser.Password != "" && hasher.Verify(params.Password, foundUser.Password) != nil {
+			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":  "Invalid password",
+				"status": fiber.StatusUnauthorized,
+			})
+		}
+
+		// schedule the deletion
+		deleteAt, err := privacy.ScheduleDeletion(contxt, foundUser.UserId)
+		if err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		audit.Log(ctx, model.AuditDeletionScheduled, foundUser.UserId, nil)
+
+		// let the user know how to change their mind
+		if err := mailer.Send(
+			contxt,
+			foundUser.Email,
+			"Your account will be deleted",
+			fmt.Sprintf("Hi %s,\n\nYour axxxe account will be deleted on %s. Until then you can log in and cancel the deletion.\n\nIf you did not ask to delete your account, log in and cancel the deletion, then change your password.\n", foundUser.Username, deleteAt.UTC().Format(time.RFC1123)),
+		); err != nil {
+			log.Printf("Oops! could not send deletion notice to %s: %v\n", foundUser.UserId, err)
+		}
+
+		return ctx.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message": "Account deletion scheduled",
+			"payload": fiber.Map{
+				"user_id":               foundUser.UserId,
+				"deletion_scheduled_at": deleteAt,
+			},
+			"status": fiber.StatusAccepted,
+		})
+	}
+}
+
+// CancelDeletion - cancels the scheduled deletion of the account of the user - owner only
+func CancelDeletion() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		userId := ctx.Params("user_id")
+
+		// cancel the deletion
+		if err := privacy.CancelDeletion(contxt, userId); err != nil {
+			if errors.Is(err, privacy.ErrNotScheduled) {
+				return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error":  "Account deletion is not scheduled",
+					"status": fiber.StatusNotFound,
+				})
+			}
+
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		audit.Log(ctx, model.AuditDeletionCancelled, userId, nil)
+
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Account deletion cancelled",
+			"payload": fiber.Map{
+				"user_id": userId,
+			},
+			"status": fiber.StatusOK,
+		})
+	}
+}
@@ -3,18 +3,22 @@ package user
 import (
 	"context"
 	"errors"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"github.com/braswelljr/axxxe/audit"
 	"github.com/braswelljr/axxxe/database"
 	"github.com/braswelljr/axxxe/helper"
 	"github.com/braswelljr/axxxe/model"
+	"github.com/braswelljr/axxxe/patch"
+	"github.com/braswelljr/axxxe/session"
+	"github.com/braswelljr/axxxe/view"
 )
 
 var (
@@ -22,20 +26,12 @@ var (
 	validate   = validator.New()
 )
 
-// GetUser - gets a user by id
+// GetUser - gets a user by id - owner or users with the users:read permission
 func GetUser() fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		// get the user id from the request params
 		id := ctx.Params("user_id")
 
-		// get user with admin role
-		if err := helper.MatchUserTypeToUID(ctx, id); err != nil {
-			return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error":  err.Error(),
-				"status": fiber.StatusForbidden,
-			})
-		}
-
 		// get the user from the database
 		user, err := GetUserById(id)
 		if err != nil {
@@ -48,7 +44,7 @@ func GetUser() fiber.Handler {
 		// return the user
 		return ctx.Status(200).JSON(fiber.Map{
 			"message":    "User found",
-			"payload":    user,
+			"payload":    view.User(ctx, user),
 			"statusCode": fiber.StatusOK,
 		})
 	}
@@ -76,124 +72,192 @@ func GetUserById(id string) (*model.User, error) {
 	return user, nil
 }
 
-// GetAllUsers fetches all the users from the database - admin only
+// GetAllUsers fetches a page of the users - users with the users:list permission.
+// See parseListQuery for the filters, sorts and pagination, the next page is
+// linked in the `Link` header.
 func GetAllUsers() fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
-		// Check user with admin role
-		if err := helper.CheckUserType(ctx, "ADMIN"); err != nil {
-			return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error":  err.Error(),
-				"status": fiber.StatusForbidden,
-			})
-		}
-
 		// context
 		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		recordsPerPage, err := strconv.Atoi(ctx.Query("recordsPerPage"))
-		if err != nil || recordsPerPage < 1 {
-			recordsPerPage = 10
-		}
-		page, err := strconv.Atoi(ctx.Query("page"))
-		if err != nil || page < 1 {
-			page = 1
-		}
-		//skip := (page - 1) * recordsPerPage
-		startIndex, err := strconv.Atoi(ctx.Query("startIndex"))
-		if err != nil || startIndex < 1 {
-			startIndex = 1
+		// filters, sort and page
+		query, err := parseListQuery(ctx)
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusBadRequest,
+			})
 		}
 
-		// make a match query to get all the users
-		match := bson.D{{"$match", bson.D{{}}}}
-
-		// make a group query to get the total number of users
-		group := bson.D{{"$group", bson.D{
-			{"_id", nil},
-			{"total_count", bson.D{{"$sum", 1}}},
-			{"data", bson.D{{"$push", "$$ROOT"}}},
-		}}}
-
-		// make a project query to get the users
-		project := bson.D{{"$project", bson.D{
-			{"_id", 0},
-			{"total_count", "$total_count"},
-			{"data", bson.D{{"$slice", []interface{}{"$data", startIndex, recordsPerPage}}}}},
-		}}
-
-		result, err := collection.Aggregate(contxt, mongo.Pipeline{
-			match, group, project,
-		})
+		// total number of users matching the filters
+		total, err := collection.CountDocuments(contxt, query.filter)
 		if err != nil {
 			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error":  err,
+				"error":  err.Error(),
 				"status": fiber.StatusInternalServerError,
 			})
 		}
 
-		// get all the users from the database
-		var users []bson.M
-		if err := result.All(contxt, &users); err != nil {
+		// get the page of users
+		cursor, err := collection.Find(
+			contxt,
+			query.pageFilter(),
+			options.Find().
+				SetSort(query.sort()).
+				SetSkip(query.skip()).
+				SetLimit(query.limit).
+				SetProjection(listProjection),
+		)
+		if err != nil {
 			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error":  err,
+				"error":  err.Error(),
 				"status": fiber.StatusInternalServerError,
 			})
 		}
+		users := []model.User{}
+		if err := cursor.All(contxt, &users); err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusInternalServerError,
+			})
+		}
+
+		// a full page may be followed by another one
+		next := ""
+		if int64(len(users)) == query.limit {
+			if next, err = query.nextCursor(&users[len(users)-1]); err != nil {
+				return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error":  err.Error(),
+					"status": fiber.StatusInternalServerError,
+				})
+			}
+		}
+		if links := query.links(ctx, next, total); links != "" {
+			ctx.Set(fiber.HeaderLink, links)
+		}
 
 		// return the users
+		payload := fiber.Map{
+			"users":       view.Users(ctx, users),
+			"total":       total,
+			"limit":       query.limit,
+			"sort":        query.sortParam(),
+			"next_cursor": next,
+		}
+		if query.cursor == nil {
+			payload["page"] = query.page
+		}
+
 		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
 			"message":    "Users found",
-			"payload":    users,
+			"payload":    payload,
 			"statusCode": fiber.StatusOK,
 		})
 	}
 }
 
-// UpdateUser - updates a user
-// Fields that can be updated:
-//   - firstname
-//   - lastname
-//   - username
-//   - phone
-//   - gender
+// UpdateUser - partially updates a user - owner or users with the users:update permission.
+// The body is a JSON Merge Patch (`application/merge-patch+json`, or plain
+// `application/json`) or a JSON Patch (`application/json-patch+json`) of the
+// fields:
+//   - username, firstname, lastname, phone and gender - owner or users with the users:update permission
+//   - email - users with the users:update permission, owners use the email change links
+//   - role - users with the users:update and users:manage-roles permissions
+//
+// Only the changed fields are validated and stored.
 func UpdateUser() fiber.Handler {
-	// get the user id from the request params
 	return func(ctx *fiber.Ctx) error {
-		// get the user id from the request params
-		id := ctx.Params("user_id")
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
 
 		// get the user from the database
-		user, err := GetUserById(id)
+		user := &model.User{}
+		if err := collection.FindOne(contxt, bson.M{"user_id": ctx.Params("user_id")}).Decode(user); err != nil {
+			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":  "User not found",
+				"status": fiber.StatusNotFound,
+			})
+		}
+		oldEmail := user.Email
+		oldRole := user.Role
+
+		// apply the patch to the editable fields
+		document := editableDocument(user)
+		patched, err := patchDocument(ctx, document)
+		if errors.Is(err, errUnsupportedPatch) {
+			return ctx.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusUnsupportedMediaType,
+			})
+		}
+		if errors.Is(err, patch.ErrTestFailed) {
+			return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":  err.Error(),
+				"status": fiber.StatusConflict,
+			})
+		}
 		if err != nil {
-			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error":  err.Error(),
-				"status": fiber.StatusInternalServerError,
+				"status": fiber.StatusBadRequest,
 			})
 		}
 
-		// set old email
-		oldEmail := user.Email
+		// only allowed fields can change
+		changes := patch.Changes(document, patched)
+		allowed := editableBy(ctx, user.UserId)
+		for _, field := range changes {
+			if _, ok := editableFields[field]; !ok {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error":  "Unknown field " + field,
+					"status": fiber.StatusBadRequest,
+				})
+			}
+			if !contains(allowed, field) {
+				return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error":  "Unauthorised to update " + field,
+					"status": fiber.StatusForbidden,
+				})
+			}
+		}
+
+		// nothing to update
+		if len(changes) == 0 {
+			return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+				"message":    "User updated",
+				"payload":    view.User(ctx, user),
+				"statusCode": fiber.StatusOK,
+			})
+		}
 
-		// decode the request body into the user struct
-		if err := ctx.BodyParser(&user); err != nil {
+		// validate the changed fields only
+		structFields, err := applyChanges(user, patched, changes)
+		if err != nil {
 			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error":  err.Error(),
 				"status": fiber.StatusBadRequest,
 			})
 		}
-
-		// validate the user
-		if err := validate.Struct(user); err != nil {
+		if err := validate.StructPartial(user, structFields...); err != nil {
 			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error":  err.Error(),
 				"status": fiber.StatusBadRequest,
 			})
 		}
 
+		// the email can not be changed while impersonating the user
+		if user.Email != oldEmail && helper.IsImpersonating(ctx) {
+			return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":  "The email can not be changed while impersonating a user",
+				"status": fiber.StatusForbidden,
+			})
+		}
+
 		// check for more than one user with the same email
-		if user.Email != "" {
-			if err := checkEmail(user.Email); err != nil {
+		if user.Email != oldEmail {
+			if err := checkEmail(user.Email, user.UserId); err != nil {
 				return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{
 					"error":  err.Error(),
 					"status": fiber.StatusConflict,
@@ -201,74 +265,53 @@ func UpdateUser() fiber.Handler {
 			}
 		}
 
-		// check for more than one user with the same email again
-		if err := checkEmail(user.Email); err != nil {
-			user.Email = oldEmail
-			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":  err.Error(),
-				"status": fiber.StatusBadRequest,
-			})
-		}
-
-		// context
-		contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
-		defer cancel()
-
-		// update the user
+		// update the changed fields in the database, as validated
 		user.UpdatedAt = primitive.NewDateTimeFromTime(time.Now())
-
-		// update the user in the database
-		if _, err := collection.UpdateOne(contxt, bson.M{"user_id": user.UserId}, bson.M{"$set": user}); err != nil {
+		update := changedValues(user, changes)
+		update["updated_at"] = user.UpdatedAt
+		if _, err := collection.UpdateOne(contxt, bson.M{"user_id": user.UserId}, bson.M{"$set": update}); err != nil {
 			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error":  err.Error(),
 				"status": fiber.StatusInternalServerError,
 			})
 		}
 
+		// tokens carry the role, role changes log the user out everywhere so the
+		// new role applies at once. Role changes and changes by admins are audited.
+		if user.Role != oldRole {
+			if err := session.RevokeAll(contxt, user.UserId); err != nil {
+				return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error":  err.Error(),
+					"status": fiber.StatusInternalServerError,
+				})
+			}
+			audit.Log(ctx, model.AuditRoleChanged, user.UserId, map[string]string{"from": oldRole, "to": user.Role})
+		}
+		if !helper.IsOwner(ctx, user.UserId) {
+			audit.Log(ctx, model.AuditUserUpdated, user.UserId, map[string]string{"fields": strings.Join(changes, ",")})
+		}
+
 		// return the user
 		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
 			"message":    "User updated",
-			"statusCode": fiber.StatusNoContent,
+			"payload":    view.User(ctx, user),
+			"statusCode": fiber.StatusOK,
 		})
 	}
 }
 
-// check email
-func checkEmail(email string) error {
+// checkEmail - checks that no other user has the email
+func checkEmail(email, userId string) error {
 	// context
 	contxt, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 	defer cancel()
 
-	// make a match query to get all the users
-	match := bson.D{{"$match", bson.D{{"email", email}}}}
-
-	// make a group query to get the total number of users
-	group := bson.D{{"$group", bson.D{
-		{"_id", nil},
-		{"total_count", bson.D{{"$sum", 1}}},
-	}}}
-
-	// make a project query to get the users
-	project := bson.D{{"$project", bson.D{
-		{"_id", 0},
-		{"total_count", "$total_count"},
-	}}}
-
-	result, err := collection.Aggregate(contxt, mongo.Pipeline{
-		match, group, project,
-	})
+	// count the other users with the email
+	count, err := collection.CountDocuments(contxt, bson.M{"email": email, "user_id": bson.M{"$ne": userId}})
 	if err != nil {
 		return err
 	}
-
-	// get all the users from the database
-	var users []bson.M
-	if err := result.All(contxt, &users); err != nil {
-		return err
-	}
-
-	// check if there is more than one user with the same email
-	if len(users) > 1 {
+	if count > 0 {
 		return errors.New("email already exists")
 	}
 
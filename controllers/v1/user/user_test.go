@@ -0,0 +1,129 @@
+package user
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/braswelljr/axxxe/database/databasetest"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/middleware"
+	"github.com/braswelljr/axxxe/model"
+	"github.com/braswelljr/axxxe/session"
+)
+
+// testUser - stores a verified user with a session and gets its access token
+func testUser(t *testing.T, server *databasetest.Server, role string) (*model.User, string) {
+	t.Helper()
+
+	id := primitive.NewObjectID()
+	now := primitive.NewDateTimeFromTime(time.Now())
+	user := &model.User{
+		Id:         id,
+		Username:   "jane" + id.Hex()[18:],
+		Email:      "jane." + id.Hex() + "@example.com",
+		Password:   "hash",
+		Gender:     "FEMALE",
+		Role:       role,
+		UserId:     id.Hex(),
+		Status:     model.UserStatusActive,
+		VerifiedAt: now,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	server.Insert(t, "users", user)
+
+	sessionId, err := session.NewSessionId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, refreshToken, err := helper.GetFamilyTokens(model.TokenizedUserParams{
+		Username: user.Username,
+		Email:    user.Email,
+		Role:     user.Role,
+		UserId:   user.UserId,
+		Verified: true,
+	}, sessionId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.Start(context.Background(), sessionId, user.UserId, refreshToken, "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	return user, token
+}
+
+func TestUpdateUserRole(t *testing.T) {
+	server := databasetest.Start(t)
+	admin, adminToken := testUser(t, server, model.RoleAdmin)
+	_, supportToken := testUser(t, server, model.RoleSupport)
+	target, targetToken := testUser(t, server, model.RoleUser)
+
+	app := fiber.New()
+	app.Get("/users/:user_id", middleware.Authenticate(), middleware.RequireOwnerOrPermission("user_id", model.PermissionUsersRead), func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(fiber.StatusOK)
+	})
+	app.Patch("/users/:user_id", middleware.Authenticate(), middleware.RequireOwnerOrPermission("user_id", model.PermissionUsersUpdate), UpdateUser())
+
+	request := func(method, token, body string) int {
+		t.Helper()
+
+		req := httptest.NewRequest(method, "/users/"+target.UserId, strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+		res, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return res.StatusCode
+	}
+
+	// users can not change their own role, nor can roles without the permission
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{name: "owner", token: targetToken, status: fiber.StatusForbidden},
+		{name: "support", token: supportToken, status: fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := request(fiber.MethodPatch, tt.token, `{"role":"ADMIN"}`); status != tt.status {
+				t.Errorf("status = %d, want %d", status, tt.status)
+			}
+		})
+	}
+	stored := &model.User{}
+	if !server.FindOne(t, "users", bson.M{"user_id": target.UserId}, stored) || stored.Role != model.RoleUser {
+		t.Fatalf("expected the role to be unchanged, got %s", stored.Role)
+	}
+
+	// admins can, which logs the user out everywhere
+	if status := request(fiber.MethodGet, targetToken, ""); status != fiber.StatusOK {
+		t.Fatalf("token before the role change status = %d, want %d", status, fiber.StatusOK)
+	}
+	if status := request(fiber.MethodPatch, adminToken, `{"role":"SUPPORT"}`); status != fiber.StatusOK {
+		t.Fatalf("admin status = %d, want %d", status, fiber.StatusOK)
+	}
+	if !server.FindOne(t, "users", bson.M{"user_id": target.UserId}, stored) || stored.Role != model.RoleSupport {
+		t.Errorf("expected the role to be %s, got %s", model.RoleSupport, stored.Role)
+	}
+	if status := request(fiber.MethodGet, targetToken, ""); status != fiber.StatusUnauthorized {
+		t.Errorf("token after the role change status = %d, want %d", status, fiber.StatusUnauthorized)
+	}
+	if status := request(fiber.MethodGet, supportToken, ""); status != fiber.StatusOK {
+		t.Errorf("other user token status = %d, want %d", status, fiber.StatusOK)
+	}
+	if len(server.Find(t, "audit_log", bson.M{"action": model.AuditRoleChanged, "user_id": target.UserId, "actor_id": admin.UserId})) != 1 {
+		t.Errorf("expected the role change to be audited")
+	}
+}
@@ -2,8 +2,11 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
+	"net"
 	"os"
 	"time"
 
@@ -16,10 +19,21 @@ var (
 	DB_NAME = "axxxe"
 )
 
+// Dial - connects the client to the database, tests replace it to serve the
+// database from memory
+var Dial = (&net.Dialer{}).DialContext
+
+// dialer - dials the database with Dial
+type dialer struct{}
+
+func (dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return Dial(ctx, network, address)
+}
+
 func DBInstance() *mongo.Client {
-	// load environmental variables
-	err := godotenv.Load(".env")
-	if err != nil {
+	// load environmental variables, the .env file is optional since they may
+	// also be set by the environment (e.g. on Heroku or in CI)
+	if err := godotenv.Load(".env"); err != nil && !errors.Is(err, fs.ErrNotExist) {
 		log.Fatalln("Oops! could not load environmental variables")
 	}
 
@@ -32,7 +46,7 @@ func DBInstance() *mongo.Client {
 	}
 
 	// Set client options
-	client, err := mongo.NewClient(options.Client().ApplyURI(DB_URL))
+	client, err := mongo.NewClient(options.Client().ApplyURI(DB_URL).SetDialer(dialer{}))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,490 @@
+package databasetest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// duplicateKey - the error code of a write breaking a unique index
+const duplicateKey = 11000
+
+// commandError - an error answered to a command
+type commandError struct {
+	code    int32
+	message string
+}
+
+func (e *commandError) Error() string {
+	return e.message
+}
+
+// run - runs a command and gets its reply
+func (s *Server) run(command bson.D) bson.D {
+	if len(command) == 0 {
+		return failed(errors.New("empty command"))
+	}
+
+	name := command[0].Key
+	collection, _ := command[0].Value.(string)
+	args := command.Map()
+
+	// handshakes and heartbeats
+	switch strings.ToLower(name) {
+	case "ismaster", "hello":
+		return bson.D{
+			{Key: "ismaster", Value: true},
+			{Key: "isWritablePrimary", Value: true},
+			{Key: "helloOk", Value: true},
+			{Key: "maxBsonObjectSize", Value: int32(16 * 1024 * 1024)},
+			{Key: "maxMessageSizeBytes", Value: int32(48000000)},
+			{Key: "maxWriteBatchSize", Value: int32(100000)},
+			{Key: "localTime", Value: primitive.NewDateTimeFromTime(time.Now())},
+			{Key: "minWireVersion", Value: int32(0)},
+			{Key: "maxWireVersion", Value: int32(13)},
+			{Key: "connectionId", Value: int32(1)},
+			{Key: "ok", Value: 1.0},
+		}
+	case "ping", "endsessions", "killcursors":
+		return bson.D{{Key: "ok", Value: 1.0}}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var reply bson.D
+	var err error
+	switch name {
+	case "createIndexes":
+		err = s.createIndexes(collection, args)
+		reply = bson.D{}
+	case "dropDatabase":
+		s.collections = map[string][]bson.D{}
+		s.unique = map[string][][]string{}
+		reply = bson.D{}
+	case "insert":
+		reply, err = s.insertCommand(collection, args)
+	case "find":
+		reply, err = s.findCommand(collection, args)
+	case "update":
+		reply, err = s.updateCommand(collection, args)
+	case "delete":
+		reply, err = s.deleteCommand(collection, args)
+	case "findAndModify":
+		reply, err = s.findAndModifyCommand(collection, args)
+	case "aggregate":
+		reply, err = s.aggregateCommand(collection, args)
+	case "count":
+		var docs []bson.D
+		docs, err = s.filter(collection, document(args["query"]))
+		reply = bson.D{{Key: "n", Value: int32(len(docs))}}
+	default:
+		err = &commandError{code: 59, message: "no such command: " + name}
+	}
+	if err != nil {
+		return failed(err)
+	}
+
+	return append(reply, bson.E{Key: "ok", Value: 1.0})
+}
+
+// failed - the reply of a failed command
+func failed(err error) bson.D {
+	code := int32(2)
+	var cmdErr *commandError
+	if errors.As(err, &cmdErr) {
+		code = cmdErr.code
+	}
+
+	return bson.D{{Key: "ok", Value: 0.0}, {Key: "errmsg", Value: err.Error()}, {Key: "code", Value: code}}
+}
+
+// writeError - a write error of a batch, duplicate keys are reported as such
+func writeError(index int, err error) bson.D {
+	code := int32(2)
+	var cmdErr *commandError
+	if errors.As(err, &cmdErr) {
+		code = cmdErr.code
+	}
+
+	return bson.D{{Key: "index", Value: int32(index)}, {Key: "code", Value: code}, {Key: "errmsg", Value: err.Error()}}
+}
+
+// createIndexes - records the unique indexes of a collection
+func (s *Server) createIndexes(collection string, args bson.M) error {
+	indexes, _ := args["indexes"].(bson.A)
+	for _, index := range indexes {
+		spec := document(index).Map()
+		if unique, _ := spec["unique"].(bool); !unique {
+			continue
+		}
+
+		keys := []string{}
+		for _, key := range document(spec["key"]) {
+			keys = append(keys, key.Key)
+		}
+		s.unique[collection] = append(s.unique[collection], keys)
+	}
+
+	return nil
+}
+
+// insertCommand - inserts documents
+func (s *Server) insertCommand(collection string, args bson.M) (bson.D, error) {
+	documents, _ := args["documents"].(bson.A)
+
+	n := 0
+	writeErrors := bson.A{}
+	for i, doc := range documents {
+		if err := s.insert(collection, document(doc)); err != nil {
+			writeErrors = append(writeErrors, writeError(i, err))
+			break
+		}
+		n++
+	}
+
+	reply := bson.D{{Key: "n", Value: int32(n)}}
+	if len(writeErrors) > 0 {
+		reply = append(reply, bson.E{Key: "writeErrors", Value: writeErrors})
+	}
+
+	return reply, nil
+}
+
+// findCommand - finds documents
+func (s *Server) findCommand(collection string, args bson.M) (bson.D, error) {
+	docs, err := s.filter(collection, document(args["filter"]))
+	if err != nil {
+		return nil, err
+	}
+	sortDocuments(docs, document(args["sort"]))
+	docs = page(docs, toInt(args["skip"]), toInt(args["limit"]))
+
+	batch := bson.A{}
+	for _, doc := range docs {
+		batch = append(batch, project(doc, document(args["projection"])))
+	}
+
+	return cursorReply(collection, batch), nil
+}
+
+// updateCommand - updates documents, inserting them on upserts
+func (s *Server) updateCommand(collection string, args bson.M) (bson.D, error) {
+	updates, _ := args["updates"].(bson.A)
+
+	n, modified := 0, 0
+	upserted := bson.A{}
+	writeErrors := bson.A{}
+	for i, item := range updates {
+		spec := document(item).Map()
+		multi, _ := spec["multi"].(bool)
+		upsert, _ := spec["upsert"].(bool)
+
+		matched, changed, id, err := s.update(collection, document(spec["q"]), document(spec["u"]), multi, upsert)
+		if err != nil {
+			writeErrors = append(writeErrors, writeError(i, err))
+			break
+		}
+		n += matched
+		modified += changed
+		if id != nil {
+			n++
+			upserted = append(upserted, bson.D{{Key: "index", Value: int32(i)}, {Key: "_id", Value: id}})
+		}
+	}
+
+	reply := bson.D{{Key: "n", Value: int32(n)}, {Key: "nModified", Value: int32(modified)}}
+	if len(upserted) > 0 {
+		reply = append(reply, bson.E{Key: "upserted", Value: upserted})
+	}
+	if len(writeErrors) > 0 {
+		reply = append(reply, bson.E{Key: "writeErrors", Value: writeErrors})
+	}
+
+	return reply, nil
+}
+
+// deleteCommand - deletes documents
+func (s *Server) deleteCommand(collection string, args bson.M) (bson.D, error) {
+	deletes, _ := args["deletes"].(bson.A)
+
+	n := 0
+	for _, item := range deletes {
+		spec := document(item).Map()
+		limit := toInt(spec["limit"])
+
+		kept := []bson.D{}
+		for _, doc := range s.collections[collection] {
+			ok, err := matches(doc, document(spec["q"]))
+			if err != nil {
+				return nil, err
+			}
+			if ok && (limit == 0 || n < limit) {
+				n++
+				continue
+			}
+			kept = append(kept, doc)
+		}
+		s.collections[collection] = kept
+	}
+
+	return bson.D{{Key: "n", Value: int32(n)}}, nil
+}
+
+// findAndModifyCommand - updates or removes a document and returns it
+func (s *Server) findAndModifyCommand(collection string, args bson.M) (bson.D, error) {
+	docs, err := s.filter(collection, document(args["query"]))
+	if err != nil {
+		return nil, err
+	}
+	sortDocuments(docs, document(args["sort"]))
+
+	returnNew, _ := args["new"].(bool)
+	upsert, _ := args["upsert"].(bool)
+	remove, _ := args["remove"].(bool)
+
+	// nothing to modify
+	if len(docs) == 0 && (remove || !upsert) {
+		return bson.D{
+			{Key: "lastErrorObject", Value: bson.D{{Key: "n", Value: int32(0)}, {Key: "updatedExisting", Value: false}}},
+			{Key: "value", Value: nil},
+		}, nil
+	}
+
+	if remove {
+		s.removeDocument(collection, docs[0])
+		return bson.D{
+			{Key: "lastErrorObject", Value: bson.D{{Key: "n", Value: int32(1)}}},
+			{Key: "value", Value: project(docs[0], document(args["fields"]))},
+		}, nil
+	}
+
+	// update the first match, or insert
+	var before bson.D
+	query := document(args["query"])
+	if len(docs) > 0 {
+		before = docs[0]
+		query = bson.D{{Key: "_id", Value: lookup(before, "_id")}}
+	}
+	_, _, id, err := s.update(collection, query, document(args["update"]), false, upsert)
+	if err != nil {
+		return nil, err
+	}
+	if id != nil {
+		query = bson.D{{Key: "_id", Value: id}}
+	}
+	after, err := s.filter(collection, query)
+	if err != nil {
+		return nil, err
+	}
+
+	lastError := bson.D{{Key: "n", Value: int32(1)}, {Key: "updatedExisting", Value: id == nil}}
+	if id != nil {
+		lastError = append(lastError, bson.E{Key: "upserted", Value: id})
+	}
+	var value interface{}
+	switch {
+	case returnNew && len(after) > 0:
+		value = project(after[0], document(args["fields"]))
+	case !returnNew && before != nil:
+		value = project(before, document(args["fields"]))
+	}
+
+	return bson.D{{Key: "lastErrorObject", Value: lastError}, {Key: "value", Value: value}}, nil
+}
+
+// aggregateCommand - runs an aggregation pipeline
+func (s *Server) aggregateCommand(collection string, args bson.M) (bson.D, error) {
+	docs := append([]bson.D{}, s.collections[collection]...)
+
+	stages, _ := args["pipeline"].(bson.A)
+	for _, item := range stages {
+		stage := document(item)
+		if len(stage) != 1 {
+			return nil, errors.New("invalid pipeline stage")
+		}
+
+		var err error
+		switch stage[0].Key {
+		case "$match":
+			kept := []bson.D{}
+			for _, doc := range docs {
+				ok, matchErr := matches(doc, document(stage[0].Value))
+				if matchErr != nil {
+					return nil, matchErr
+				}
+				if ok {
+					kept = append(kept, doc)
+				}
+			}
+			docs = kept
+		case "$sort":
+			sortDocuments(docs, document(stage[0].Value))
+		case "$skip":
+			docs = page(docs, toInt(stage[0].Value), 0)
+		case "$limit":
+			docs = page(docs, 0, toInt(stage[0].Value))
+		case "$group":
+			docs, err = group(docs, document(stage[0].Value))
+		default:
+			err = fmt.Errorf("unsupported pipeline stage %s", stage[0].Key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	batch := bson.A{}
+	for _, doc := range docs {
+		batch = append(batch, doc)
+	}
+
+	return cursorReply(collection, batch), nil
+}
+
+// cursorReply - the reply of a command returning every document at once
+func cursorReply(collection string, batch bson.A) bson.D {
+	return bson.D{{Key: "cursor", Value: bson.D{
+		{Key: "firstBatch", Value: batch},
+		{Key: "id", Value: int64(0)},
+		{Key: "ns", Value: "test." + collection},
+	}}}
+}
+
+// filter - the documents of a collection matching a query
+func (s *Server) filter(collection string, query bson.D) ([]bson.D, error) {
+	docs := []bson.D{}
+	for _, doc := range s.collections[collection] {
+		ok, err := matches(doc, query)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			docs = append(docs, doc)
+		}
+	}
+
+	return docs, nil
+}
+
+// insert - stores a document, with an id when it has none
+func (s *Server) insert(collection string, doc bson.D) error {
+	if _, found := lookupPath(doc, "_id"); !found {
+		doc = append(bson.D{{Key: "_id", Value: primitive.NewObjectID()}}, doc...)
+	}
+	if err := s.checkUnique(collection, doc, -1); err != nil {
+		return err
+	}
+
+	s.collections[collection] = append(s.collections[collection], doc)
+
+	return nil
+}
+
+// update - applies an update to the documents matching a query, or the first
+// one unless multi. Upserts insert a document built from the query when none
+// matches and return its id.
+func (s *Server) update(collection string, query, update bson.D, multi, upsert bool) (int, int, interface{}, error) {
+	matched, modified := 0, 0
+	docs := s.collections[collection]
+	for i, doc := range docs {
+		ok, err := matches(doc, query)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		updated, err := applyUpdate(doc, update, false)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		if err := s.checkUnique(collection, updated, i); err != nil {
+			return 0, 0, nil, err
+		}
+		matched++
+		if !equal(doc, updated) {
+			modified++
+		}
+		docs[i] = updated
+
+		if !multi {
+			break
+		}
+	}
+	if matched > 0 || !upsert {
+		return matched, modified, nil, nil
+	}
+
+	// upsert
+	doc := bson.D{}
+	for _, elem := range query {
+		if strings.HasPrefix(elem.Key, "$") {
+			continue
+		}
+		if operators, ok := elem.Value.(bson.D); ok && isOperatorDocument(operators) {
+			if value, ok := operators.Map()["$eq"]; ok {
+				doc = setPath(doc, elem.Key, value)
+			}
+			continue
+		}
+		doc = setPath(doc, elem.Key, elem.Value)
+	}
+	doc, err := applyUpdate(doc, update, true)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if _, found := lookupPath(doc, "_id"); !found {
+		doc = append(bson.D{{Key: "_id", Value: primitive.NewObjectID()}}, doc...)
+	}
+	if err := s.insert(collection, doc); err != nil {
+		return 0, 0, nil, err
+	}
+
+	return 0, 0, lookup(doc, "_id"), nil
+}
+
+// removeDocument - removes a stored document
+func (s *Server) removeDocument(collection string, removed bson.D) {
+	kept := []bson.D{}
+	for _, doc := range s.collections[collection] {
+		if !equal(lookup(doc, "_id"), lookup(removed, "_id")) {
+			kept = append(kept, doc)
+		}
+	}
+	s.collections[collection] = kept
+}
+
+// checkUnique - checks that a document breaks no unique index, skipping the
+// document at the index it replaces
+func (s *Server) checkUnique(collection string, doc bson.D, replaces int) error {
+	indexes := append([][]string{{"_id"}}, s.unique[collection]...)
+	for _, keys := range indexes {
+		for i, other := range s.collections[collection] {
+			if i == replaces {
+				continue
+			}
+
+			same := true
+			for _, key := range keys {
+				if !equal(lookup(doc, key), lookup(other, key)) {
+					same = false
+					break
+				}
+			}
+			if same {
+				return &commandError{
+					code:    duplicateKey,
+					message: fmt.Sprintf("E11000 duplicate key error collection: test.%s index: %s", collection, strings.Join(keys, "_")),
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package databasetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/braswelljr/axxxe/database"
+)
+
+type item struct {
+	Name  string `bson:"name"`
+	Count int    `bson:"count"`
+}
+
+func TestServer(t *testing.T) {
+	server := Start(t)
+	collection := database.OpenCollection(database.Client, "items")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// inserts, enforcing unique indexes
+	if _, err := collection.InsertOne(ctx, item{Name: "a", Count: 1}); err != nil {
+		t.Fatal(err)
+	}
+	server.Insert(t, "items", item{Name: "b", Count: 2})
+	if _, err := collection.InsertOne(ctx, item{Name: "a"}); !mongo.IsDuplicateKeyError(err) {
+		t.Fatalf("expected a duplicate key error, got %v", err)
+	}
+
+	// finds
+	found := item{}
+	if err := collection.FindOne(ctx, bson.M{"count": bson.M{"$gt": 1}}).Decode(&found); err != nil || found.Name != "b" {
+		t.Fatalf("expected b, got %+v (%v)", found, err)
+	}
+	if err := collection.FindOne(ctx, bson.M{"name": "c"}).Err(); err != mongo.ErrNoDocuments {
+		t.Fatalf("expected no documents, got %v", err)
+	}
+	cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"count": -1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := []item{}
+	if err := cursor.All(ctx, &items); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].Name != "b" {
+		t.Fatalf("expected b then a, got %+v", items)
+	}
+	if count, err := collection.CountDocuments(ctx, bson.M{"name": bson.M{"$in": bson.A{"a", "b"}}}); err != nil || count != 2 {
+		t.Fatalf("expected 2 documents, got %d (%v)", count, err)
+	}
+
+	// updates
+	result, err := collection.UpdateOne(ctx, bson.M{"name": "a"}, bson.M{"$inc": bson.M{"count": 2}})
+	if err != nil || result.ModifiedCount != 1 {
+		t.Fatalf("expected an update, got %+v (%v)", result, err)
+	}
+	if !server.FindOne(t, "items", bson.M{"name": "a"}, &found) || found.Count != 3 {
+		t.Fatalf("expected a count of 3, got %+v", found)
+	}
+	if err := collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"name": "c"},
+		bson.M{"$inc": bson.M{"count": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&found); err != nil || found.Name != "c" || found.Count != 1 {
+		t.Fatalf("expected an upserted c, got %+v (%v)", found, err)
+	}
+
+	// deletes
+	if result, err := collection.DeleteMany(ctx, bson.M{"count": bson.M{"$lt": 3}}); err != nil || result.DeletedCount != 2 {
+		t.Fatalf("expected 2 deletions, got %+v (%v)", result, err)
+	}
+	if docs := server.Find(t, "items", nil); len(docs) != 1 {
+		t.Fatalf("expected 1 document left, got %d", len(docs))
+	}
+
+	// every start empties the database
+	Start(t)
+	if docs := server.Find(t, "items", nil); len(docs) != 0 {
+		t.Fatalf("expected an empty database, got %d documents", len(docs))
+	}
+}
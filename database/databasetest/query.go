@@ -0,0 +1,653 @@
+package databasetest
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// toDocument - converts a filter, update or model to a document
+func toDocument(value interface{}) (bson.D, error) {
+	if value == nil {
+		return bson.D{}, nil
+	}
+
+	raw, err := bson.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	doc := bson.D{}
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// document - a decoded value as a document, empty when it is not one
+func document(value interface{}) bson.D {
+	switch doc := value.(type) {
+	case bson.D:
+		return doc
+	case bson.M:
+		d := bson.D{}
+		for key, value := range doc {
+			d = append(d, bson.E{Key: key, Value: value})
+		}
+		return d
+	}
+
+	return bson.D{}
+}
+
+// toInt - a decoded number as an int
+func toInt(value interface{}) int {
+	if number, ok := toFloat(value); ok {
+		return int(number)
+	}
+
+	return 0
+}
+
+// toFloat - a decoded number as a float
+func toFloat(value interface{}) (float64, bool) {
+	switch number := value.(type) {
+	case int32:
+		return float64(number), true
+	case int64:
+		return float64(number), true
+	case float64:
+		return number, true
+	case int:
+		return float64(number), true
+	}
+
+	return 0, false
+}
+
+// lookupPath - the value at a dotted path of a document
+func lookupPath(doc bson.D, path string) (interface{}, bool) {
+	var value interface{} = doc
+	for _, key := range strings.Split(path, ".") {
+		switch current := value.(type) {
+		case bson.D:
+			found := false
+			for _, elem := range current {
+				if elem.Key == key {
+					value, found = elem.Value, true
+					break
+				}
+			}
+			if !found {
+				return nil, false
+			}
+		case bson.A:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(current) {
+				return nil, false
+			}
+			value = current[index]
+		default:
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// lookup - the value at a dotted path of a document, nil when missing
+func lookup(doc bson.D, path string) interface{} {
+	value, _ := lookupPath(doc, path)
+	return value
+}
+
+// setPath - sets the value at a dotted path of a document
+func setPath(doc bson.D, path string, value interface{}) bson.D {
+	key, rest, nested := strings.Cut(path, ".")
+	for i, elem := range doc {
+		if elem.Key != key {
+			continue
+		}
+		if nested {
+			doc[i].Value = setPath(document(elem.Value), rest, value)
+		} else {
+			doc[i].Value = value
+		}
+		return doc
+	}
+
+	if nested {
+		return append(doc, bson.E{Key: key, Value: setPath(bson.D{}, rest, value)})
+	}
+
+	return append(doc, bson.E{Key: key, Value: value})
+}
+
+// unsetPath - removes the value at a dotted path of a document
+func unsetPath(doc bson.D, path string) bson.D {
+	key, rest, nested := strings.Cut(path, ".")
+	for i, elem := range doc {
+		if elem.Key != key {
+			continue
+		}
+		if nested {
+			if inner, ok := elem.Value.(bson.D); ok {
+				doc[i].Value = unsetPath(inner, rest)
+			}
+			return doc
+		}
+		return append(doc[:i:i], doc[i+1:]...)
+	}
+
+	return doc
+}
+
+// copyValue - a deep copy of a decoded value
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.D:
+		doc := make(bson.D, len(v))
+		for i, elem := range v {
+			doc[i] = bson.E{Key: elem.Key, Value: copyValue(elem.Value)}
+		}
+		return doc
+	case bson.A:
+		array := make(bson.A, len(v))
+		for i, item := range v {
+			array[i] = copyValue(item)
+		}
+		return array
+	}
+
+	return value
+}
+
+// typeOrder - the order of the types of compared values
+func typeOrder(value interface{}) int {
+	switch value.(type) {
+	case nil:
+		return 0
+	case int32, int64, float64, int:
+		return 1
+	case string:
+		return 2
+	case bson.D:
+		return 3
+	case bson.A:
+		return 4
+	case primitive.Binary:
+		return 5
+	case primitive.ObjectID:
+		return 6
+	case bool:
+		return 7
+	case primitive.DateTime, time.Time:
+		return 8
+	}
+
+	return 9
+}
+
+// compare - orders two decoded values the way MongoDB does, types first
+func compare(a, b interface{}) int {
+	if ta, tb := typeOrder(a), typeOrder(b); ta != tb {
+		return ta - tb
+	}
+
+	switch x := a.(type) {
+	case nil:
+		return 0
+	case string:
+		return strings.Compare(x, b.(string))
+	case bool:
+		y := b.(bool)
+		switch {
+		case x == y:
+			return 0
+		case !x:
+			return -1
+		}
+		return 1
+	case primitive.ObjectID:
+		y := b.(primitive.ObjectID)
+		return bytes.Compare(x[:], y[:])
+	case primitive.DateTime, time.Time:
+		tx, ty := toTime(a), toTime(b)
+		switch {
+		case tx.Before(ty):
+			return -1
+		case tx.After(ty):
+			return 1
+		}
+		return 0
+	case bson.A:
+		y := b.(bson.A)
+		for i := 0; i < len(x) && i < len(y); i++ {
+			if c := compare(x[i], y[i]); c != 0 {
+				return c
+			}
+		}
+		return len(x) - len(y)
+	}
+
+	if x, ok := toFloat(a); ok {
+		y, _ := toFloat(b)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+
+	// documents and other values are only told equal or not
+	ra, _ := bson.Marshal(bson.D{{Key: "v", Value: a}})
+	rb, _ := bson.Marshal(bson.D{{Key: "v", Value: b}})
+	return bytes.Compare(ra, rb)
+}
+
+// toTime - a decoded date as a time
+func toTime(value interface{}) time.Time {
+	if date, ok := value.(primitive.DateTime); ok {
+		return date.Time()
+	}
+
+	return value.(time.Time)
+}
+
+// equal - whether two decoded values are equal
+func equal(a, b interface{}) bool {
+	return compare(a, b) == 0
+}
+
+// isOperatorDocument - whether a document holds query or update operators
+func isOperatorDocument(doc bson.D) bool {
+	return len(doc) > 0 && strings.HasPrefix(doc[0].Key, "$")
+}
+
+// matches - whether a document matches a query
+func matches(doc bson.D, query bson.D) (bool, error) {
+	for _, elem := range query {
+		var ok bool
+		var err error
+		switch elem.Key {
+		case "$and", "$or", "$nor":
+			ok, err = matchLogical(doc, elem.Key, elem.Value)
+		default:
+			if strings.HasPrefix(elem.Key, "$") {
+				return false, fmt.Errorf("unsupported query operator %s", elem.Key)
+			}
+			value, found := lookupPath(doc, elem.Key)
+			ok, err = matchValue(value, found, elem.Value)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// matchLogical - matches a document against the queries of $and, $or or $nor
+func matchLogical(doc bson.D, operator string, value interface{}) (bool, error) {
+	queries, ok := value.(bson.A)
+	if !ok {
+		return false, fmt.Errorf("%s needs an array", operator)
+	}
+
+	for _, query := range queries {
+		ok, err := matches(doc, document(query))
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case operator == "$and" && !ok:
+			return false, nil
+		case operator == "$or" && ok:
+			return true, nil
+		case operator == "$nor" && ok:
+			return false, nil
+		}
+	}
+
+	return operator != "$or", nil
+}
+
+// matchValue - whether the value of a field matches a condition, operators or
+// a value to equal
+func matchValue(value interface{}, found bool, condition interface{}) (bool, error) {
+	if regex, ok := condition.(primitive.Regex); ok {
+		return matchRegex(value, regex)
+	}
+
+	operators, ok := condition.(bson.D)
+	if !ok || !isOperatorDocument(operators) {
+		return matchEqual(value, condition), nil
+	}
+
+	for _, operator := range operators {
+		var ok bool
+		var err error
+		switch operator.Key {
+		case "$eq":
+			ok = matchEqual(value, operator.Value)
+		case "$ne":
+			ok = !matchEqual(value, operator.Value)
+		case "$gt", "$gte", "$lt", "$lte":
+			ok = matchAny(value, func(v interface{}) bool {
+				// ranges only compare values of the same type
+				if typeOrder(v) != typeOrder(operator.Value) {
+					return false
+				}
+				c := compare(v, operator.Value)
+				switch operator.Key {
+				case "$gt":
+					return c > 0
+				case "$gte":
+					return c >= 0
+				case "$lt":
+					return c < 0
+				}
+				return c <= 0
+			})
+		case "$in", "$nin":
+			values, isArray := operator.Value.(bson.A)
+			if !isArray {
+				return false, fmt.Errorf("%s needs an array", operator.Key)
+			}
+			in := false
+			for _, v := range values {
+				if matchEqual(value, v) {
+					in = true
+					break
+				}
+			}
+			ok = in == (operator.Key == "$in")
+		case "$exists":
+			exists, _ := operator.Value.(bool)
+			if number, isNumber := toFloat(operator.Value); isNumber {
+				exists = number != 0
+			}
+			ok = found == exists
+		case "$regex":
+			pattern, _ := operator.Value.(string)
+			options, _ := operators.Map()["$options"].(string)
+			ok, err = matchRegex(value, primitive.Regex{Pattern: pattern, Options: options})
+		case "$options":
+			ok = true
+		case "$elemMatch":
+			items, isArray := value.(bson.A)
+			query := document(operator.Value)
+			for _, item := range items {
+				if !isArray {
+					break
+				}
+				if isOperatorDocument(query) {
+					ok, err = matchValue(item, true, query)
+				} else {
+					ok, err = matches(document(item), query)
+				}
+				if err != nil || ok {
+					break
+				}
+			}
+		case "$not":
+			ok, err = matchValue(value, found, operator.Value)
+			ok = !ok
+		default:
+			return false, fmt.Errorf("unsupported query operator %s", operator.Key)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// matchAny - whether a value, or one of its items when it is an array, matches
+func matchAny(value interface{}, match func(interface{}) bool) bool {
+	if items, ok := value.(bson.A); ok {
+		for _, item := range items {
+			if match(item) {
+				return true
+			}
+		}
+	}
+
+	return match(value)
+}
+
+// matchEqual - whether a value, or one of its items, equals another
+func matchEqual(value, other interface{}) bool {
+	return matchAny(value, func(v interface{}) bool { return equal(v, other) })
+}
+
+// matchRegex - whether a string value matches a regular expression
+func matchRegex(value interface{}, regex primitive.Regex) (bool, error) {
+	pattern := regex.Pattern
+	if strings.Contains(regex.Options, "i") {
+		pattern = "(?i)" + pattern
+	}
+	expression, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+
+	return matchAny(value, func(v interface{}) bool {
+		s, ok := v.(string)
+		return ok && expression.MatchString(s)
+	}), nil
+}
+
+// applyUpdate - a copy of a document with an update applied, either operators
+// or a replacement. $setOnInsert only applies to inserts.
+func applyUpdate(doc bson.D, update bson.D, insert bool) (bson.D, error) {
+	doc = copyValue(doc).(bson.D)
+
+	// replacement, keeping the id
+	if !isOperatorDocument(update) {
+		replacement := copyValue(update).(bson.D)
+		if id, found := lookupPath(doc, "_id"); found {
+			replacement = append(bson.D{{Key: "_id", Value: id}}, unsetPath(replacement, "_id")...)
+		}
+		return replacement, nil
+	}
+
+	for _, operator := range update {
+		for _, field := range document(operator.Value) {
+			value := copyValue(field.Value)
+			switch operator.Key {
+			case "$set":
+				doc = setPath(doc, field.Key, value)
+			case "$setOnInsert":
+				if insert {
+					doc = setPath(doc, field.Key, value)
+				}
+			case "$unset":
+				doc = unsetPath(doc, field.Key)
+			case "$inc":
+				current, _ := toFloat(lookup(doc, field.Key))
+				increment, ok := toFloat(value)
+				if !ok {
+					return nil, fmt.Errorf("cannot increment %s by a non number", field.Key)
+				}
+				// integers stay integers
+				var sum interface{} = int32(increment + current)
+				if _, isFloat := value.(float64); isFloat {
+					sum = increment + current
+				}
+				doc = setPath(doc, field.Key, sum)
+			case "$push":
+				items, _ := lookup(doc, field.Key).(bson.A)
+				if each, ok := value.(bson.D); ok && isOperatorDocument(each) {
+					added, _ := each.Map()["$each"].(bson.A)
+					items = append(items, added...)
+				} else {
+					items = append(items, value)
+				}
+				doc = setPath(doc, field.Key, items)
+			case "$pull":
+				items, _ := lookup(doc, field.Key).(bson.A)
+				kept := bson.A{}
+				for _, item := range items {
+					ok, err := matchValue(item, true, value)
+					if err != nil {
+						return nil, err
+					}
+					if !ok {
+						kept = append(kept, item)
+					}
+				}
+				doc = setPath(doc, field.Key, kept)
+			default:
+				return nil, fmt.Errorf("unsupported update operator %s", operator.Key)
+			}
+		}
+	}
+
+	return doc, nil
+}
+
+// sortDocuments - sorts documents by the fields of a sort
+func sortDocuments(docs []bson.D, order bson.D) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, field := range order {
+			c := compare(lookup(docs[i], field.Key), lookup(docs[j], field.Key))
+			if direction, _ := toFloat(field.Value); direction < 0 {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
+// page - the documents after skipping some, up to a limit when not zero
+func page(docs []bson.D, skip, limit int) []bson.D {
+	if skip >= len(docs) {
+		return []bson.D{}
+	}
+	docs = docs[skip:]
+	if limit < 0 {
+		limit = -limit
+	}
+	if limit > 0 && limit < len(docs) {
+		docs = docs[:limit]
+	}
+
+	return docs
+}
+
+// project - the fields of a document kept by a projection, the id is kept
+// unless excluded
+func project(doc bson.D, projection bson.D) bson.D {
+	if len(projection) == 0 {
+		return doc
+	}
+
+	include := false
+	for _, field := range projection {
+		if number, ok := toFloat(field.Value); (ok && number != 0) || field.Value == true {
+			if field.Key != "_id" {
+				include = true
+			}
+		}
+	}
+
+	if !include {
+		projected := copyValue(doc).(bson.D)
+		for _, field := range projection {
+			projected = unsetPath(projected, field.Key)
+		}
+		return projected
+	}
+
+	projected := bson.D{}
+	keepId := true
+	for _, field := range projection {
+		number, _ := toFloat(field.Value)
+		if field.Key == "_id" && number == 0 && field.Value != true {
+			keepId = false
+			continue
+		}
+		if value, found := lookupPath(doc, field.Key); found {
+			projected = setPath(projected, field.Key, copyValue(value))
+		}
+	}
+	if id, found := lookupPath(doc, "_id"); found && keepId {
+		projected = append(bson.D{{Key: "_id", Value: id}}, unsetPath(projected, "_id")...)
+	}
+
+	return projected
+}
+
+// expression - evaluates a field path or a constant of a $group stage
+func expression(doc bson.D, value interface{}) interface{} {
+	if path, ok := value.(string); ok && strings.HasPrefix(path, "$") {
+		return lookup(doc, strings.TrimPrefix(path, "$"))
+	}
+
+	return value
+}
+
+// group - groups documents by the id of a $group stage, with $sum, $push and
+// $first accumulators
+func group(docs []bson.D, spec bson.D) ([]bson.D, error) {
+	groups := []bson.D{}
+	for _, doc := range docs {
+		id := expression(doc, spec.Map()["_id"])
+
+		index := -1
+		for i, g := range groups {
+			if equal(lookup(g, "_id"), id) {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			groups = append(groups, bson.D{{Key: "_id", Value: id}})
+			index = len(groups) - 1
+		}
+
+		for _, field := range spec {
+			if field.Key == "_id" {
+				continue
+			}
+			accumulator := document(field.Value)
+			if len(accumulator) != 1 {
+				return nil, fmt.Errorf("invalid accumulator for %s", field.Key)
+			}
+
+			current, found := lookupPath(groups[index], field.Key)
+			value := expression(doc, accumulator[0].Value)
+			switch accumulator[0].Key {
+			case "$sum":
+				sum, _ := toFloat(current)
+				number, _ := toFloat(value)
+				groups[index] = setPath(groups[index], field.Key, int32(sum+number))
+			case "$push":
+				items, _ := current.(bson.A)
+				groups[index] = setPath(groups[index], field.Key, append(items, value))
+			case "$first":
+				if !found {
+					groups[index] = setPath(groups[index], field.Key, value)
+				}
+			default:
+				return nil, fmt.Errorf("unsupported accumulator %s", accumulator[0].Key)
+			}
+		}
+	}
+
+	return groups, nil
+}
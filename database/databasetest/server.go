@@ -0,0 +1,254 @@
+// Package databasetest serves an in memory database speaking enough of the
+// MongoDB wire protocol for the handlers to be tested without MongoDB.
+//
+// The database client dials the server instead of MongoDB once Start has been
+// called. Commands run against collections of documents kept in memory: finds,
+// counts, inserts, updates, deletes and findAndModify with the query and update
+// operators the handlers use, and simple aggregations. Unique indexes are
+// enforced once created, e.g. by database.EnsureIndexes.
+package databasetest
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/wiremessage"
+
+	"github.com/braswelljr/axxxe/database"
+)
+
+// Server - an in memory database, shared by the tests of a package
+type Server struct {
+	mu          sync.Mutex
+	collections map[string][]bson.D
+	// unique - the keys of the unique indexes of the collections
+	unique map[string][][]string
+}
+
+var (
+	server *Server
+	once   sync.Once
+)
+
+// Start - serves an empty database to the database client. Tests using it can
+// not run in parallel, every call empties the database.
+func Start(t testing.TB) *Server {
+	t.Helper()
+
+	once.Do(func() {
+		server = &Server{}
+		database.Dial = server.dial
+	})
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.collections = map[string][]bson.D{}
+	server.unique = map[string][][]string{}
+
+	return server
+}
+
+// Insert - stores documents in a collection, as the handlers would have
+func (s *Server) Insert(t testing.TB, collection string, documents ...interface{}) {
+	t.Helper()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, document := range documents {
+		doc, err := toDocument(document)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.insert(collection, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// FindOne - decodes the first document of a collection matching the filter into
+// the result, returns false when none matches
+func (s *Server) FindOne(t testing.TB, collection string, filter, result interface{}) bool {
+	t.Helper()
+
+	docs := s.Find(t, collection, filter)
+	if len(docs) == 0 {
+		return false
+	}
+
+	raw, err := bson.Marshal(docs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bson.Unmarshal(raw, result); err != nil {
+		t.Fatal(err)
+	}
+
+	return true
+}
+
+// Find - the documents of a collection matching the filter
+func (s *Server) Find(t testing.TB, collection string, filter interface{}) []bson.D {
+	t.Helper()
+
+	query, err := toDocument(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	docs := []bson.D{}
+	for _, doc := range s.collections[collection] {
+		ok, err := matches(doc, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			docs = append(docs, doc)
+		}
+	}
+
+	return docs
+}
+
+// dial - connects the database client to the server
+func (s *Server) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	client, conn := net.Pipe()
+	go s.serve(conn)
+
+	return client, nil
+}
+
+// serve - answers the commands sent on a connection until it is closed
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		// the length of the message, then the rest of it
+		size := make([]byte, 4)
+		if _, err := io.ReadFull(conn, size); err != nil {
+			return
+		}
+		message := make([]byte, binary.LittleEndian.Uint32(size))
+		copy(message, size)
+		if _, err := io.ReadFull(conn, message[4:]); err != nil {
+			return
+		}
+
+		reply, err := s.reply(message)
+		if err != nil {
+			return
+		}
+		if _, err := conn.Write(reply); err != nil {
+			return
+		}
+	}
+}
+
+// reply - runs the command of a message and builds the reply
+func (s *Server) reply(message []byte) ([]byte, error) {
+	_, requestId, _, opcode, rem, ok := wiremessage.ReadHeader(message)
+	if !ok {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	switch opcode {
+	case wiremessage.OpQuery:
+		// handshakes are sent as queries on admin.$cmd
+		_, rem, _ = wiremessage.ReadQueryFlags(rem)
+		_, rem, _ = wiremessage.ReadQueryFullCollectionName(rem)
+		_, rem, _ = wiremessage.ReadQueryNumberToSkip(rem)
+		_, rem, _ = wiremessage.ReadQueryNumberToReturn(rem)
+		query, _, ok := wiremessage.ReadQueryQuery(rem)
+		if !ok {
+			return nil, io.ErrUnexpectedEOF
+		}
+		command := bson.D{}
+		if err := bson.Unmarshal(query, &command); err != nil {
+			return nil, err
+		}
+		if len(command) > 0 && command[0].Key == "$query" {
+			command, _ = command[0].Value.(bson.D)
+		}
+
+		reply, err := bson.Marshal(s.run(command))
+		if err != nil {
+			return nil, err
+		}
+
+		index, dst := wiremessage.AppendHeaderStart(nil, wiremessage.NextRequestID(), requestId, wiremessage.OpReply)
+		dst = wiremessage.AppendReplyFlags(dst, 0)
+		dst = wiremessage.AppendReplyCursorID(dst, 0)
+		dst = wiremessage.AppendReplyStartingFrom(dst, 0)
+		dst = wiremessage.AppendReplyNumberReturned(dst, 1)
+		dst = append(dst, reply...)
+
+		return bsoncore.UpdateLength(dst, index, int32(len(dst[index:]))), nil
+	case wiremessage.OpMsg:
+		_, rem, _ = wiremessage.ReadMsgFlags(rem)
+		command := bson.D{}
+		for len(rem) > 0 {
+			var sectionType wiremessage.SectionType
+			sectionType, rem, ok = wiremessage.ReadMsgSectionType(rem)
+			if !ok {
+				return nil, io.ErrUnexpectedEOF
+			}
+
+			switch sectionType {
+			case wiremessage.SingleDocument:
+				var doc bsoncore.Document
+				doc, rem, ok = wiremessage.ReadMsgSectionSingleDocument(rem)
+				if !ok {
+					return nil, io.ErrUnexpectedEOF
+				}
+				body := bson.D{}
+				if err := bson.Unmarshal(doc, &body); err != nil {
+					return nil, err
+				}
+				command = append(body, command...)
+			case wiremessage.DocumentSequence:
+				var identifier string
+				var docs []bsoncore.Document
+				identifier, docs, rem, ok = wiremessage.ReadMsgSectionDocumentSequence(rem)
+				if !ok {
+					return nil, io.ErrUnexpectedEOF
+				}
+				sequence := bson.A{}
+				for _, doc := range docs {
+					item := bson.D{}
+					if err := bson.Unmarshal(doc, &item); err != nil {
+						return nil, err
+					}
+					sequence = append(sequence, item)
+				}
+				command = append(command, bson.E{Key: identifier, Value: sequence})
+			default:
+				return nil, fmt.Errorf("unknown section type %d", sectionType)
+			}
+		}
+
+		reply, err := bson.Marshal(s.run(command))
+		if err != nil {
+			return nil, err
+		}
+
+		index, dst := wiremessage.AppendHeaderStart(nil, wiremessage.NextRequestID(), requestId, wiremessage.OpMsg)
+		dst = wiremessage.AppendMsgFlags(dst, 0)
+		dst = wiremessage.AppendMsgSectionType(dst, wiremessage.SingleDocument)
+		dst = append(dst, reply...)
+
+		return bsoncore.UpdateLength(dst, index, int32(len(dst[index:]))), nil
+	}
+
+	return nil, fmt.Errorf("unsupported opcode %s", opcode)
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// collectionIndexes - the indexes of a collection
+type collectionIndexes struct {
+	collection *mongo.Collection
+	models     []mongo.IndexModel
+}
+
+var (
+	indexesMu sync.Mutex
+	indexes   = []collectionIndexes{}
+)
+
+// CreateIndexes - registers the indexes of a collection, they are created by
+// EnsureIndexes when the server starts
+func CreateIndexes(collection *mongo.Collection, models ...mongo.IndexModel) {
+	indexesMu.Lock()
+	defer indexesMu.Unlock()
+
+	indexes = append(indexes, collectionIndexes{collection: collection, models: models})
+}
+
+// EnsureIndexes - creates the registered indexes that do not exist yet, the
+// server must not accept requests before the unique indexes exist
+func EnsureIndexes(ctx context.Context) error {
+	indexesMu.Lock()
+	defer indexesMu.Unlock()
+
+	for _, index := range indexes {
+		if _, err := index.collection.Indexes().CreateMany(ctx, index.models); err != nil {
+			return fmt.Errorf("could not create indexes on %s: %w", index.collection.Name(), err)
+		}
+	}
+
+	return nil
+}
@@ -10,6 +10,7 @@ require (
 	github.com/joho/godotenv v1.4.0
 	go.mongodb.org/mongo-driver v1.11.0
 	golang.org/x/crypto v0.2.0
+	golang.org/x/term v0.2.0
 )
 
 require (
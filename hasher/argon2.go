@@ -0,0 +1,113 @@
+package hasher
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// argon2SaltLength - length of the random salt
+	argon2SaltLength = 16
+	// argon2KeyLength - length of the derived key
+	argon2KeyLength = 32
+)
+
+var errInvalidArgon2Hash = errors.New("invalid argon2id hash")
+
+// Argon2idParams - argon2id with its memory (KiB), time and threads parameters
+type Argon2idParams struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+}
+
+// Validate - checks the parameters, argon2id needs at least one thread and
+// iteration and 8 KiB of memory per thread
+func (a Argon2idParams) Validate() error {
+	switch {
+	case a.Threads < 1:
+		return fmt.Errorf("%w: argon2id needs at least 1 thread", ErrInvalidParams)
+	case a.Time < 1:
+		return fmt.Errorf("%w: argon2id time must be at least 1", ErrInvalidParams)
+	case a.Memory < 8*uint32(a.Threads):
+		return fmt.Errorf("%w: argon2id memory must be at least 8 KiB per thread", ErrInvalidParams)
+	}
+
+	return nil
+}
+
+// Hash - hashes a password into a PHC string
+func (a Argon2idParams) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Threads, argon2KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, a.Memory, a.Time, a.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify - checks a password against an argon2id hash with the parameters of the hash
+func (a Argon2idParams) Verify(password, encoded string) error {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return err
+	}
+
+	derived := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(derived, key) != 1 {
+		return ErrMismatch
+	}
+
+	return nil
+}
+
+// Matches - checks if a hash is an argon2id hash of the parameters
+func (a Argon2idParams) Matches(encoded string) bool {
+	params, _, _, err := decodeArgon2id(encoded)
+	return err == nil && params == a
+}
+
+// decodeArgon2id - reads the parameters, salt and key of a PHC string
+func decodeArgon2id(encoded string) (Argon2idParams, []byte, []byte, error) {
+	params := Argon2idParams{}
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != Argon2id {
+		return params, nil, nil, errInvalidArgon2Hash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errInvalidArgon2Hash
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil || params.Validate() != nil {
+		return params, nil, nil, errInvalidArgon2Hash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, errInvalidArgon2Hash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, errInvalidArgon2Hash
+	}
+
+	return params, salt, key, nil
+}
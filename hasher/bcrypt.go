@@ -0,0 +1,48 @@
+package hasher
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BcryptParams - bcrypt with a cost
+type BcryptParams struct {
+	Cost int
+}
+
+// Validate - checks that the cost is one bcrypt supports
+func (b BcryptParams) Validate() error {
+	if b.Cost < bcrypt.MinCost || b.Cost > bcrypt.MaxCost {
+		return fmt.Errorf("%w: bcrypt cost must be between %d and %d", ErrInvalidParams, bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	return nil
+}
+
+// Hash - hashes a password
+func (b BcryptParams) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	return string(hash), err
+}
+
+// Verify - checks a password against a bcrypt hash, the cost is read from the hash
+func (b BcryptParams) Verify(password, encoded string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrMismatch
+	}
+
+	return err
+}
+
+// Matches - checks if a hash is a bcrypt hash of the cost
+func (b BcryptParams) Matches(encoded string) bool {
+	if algorithm(encoded) != Bcrypt {
+		return false
+	}
+
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err == nil && cost == b.Cost
+}
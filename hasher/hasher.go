@@ -0,0 +1,132 @@
+// Package hasher hashes and verifies passwords.
+//
+// Hashes are encoded with their algorithm and parameters, bcrypt hashes in
+// their usual `$2a$<cost>$...` form and argon2id hashes as PHC strings
+// (`$argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<hash>`), so hashes
+// made with an older policy keep verifying. NeedsRehash reports hashes that no
+// longer match the current policy so they can be upgraded on login.
+//
+// The policy is configured with `PASSWORD_HASH_ALGORITHM` (`bcrypt` or
+// `argon2id`), `PASSWORD_BCRYPT_COST`, `PASSWORD_ARGON2_MEMORY` (KiB),
+// `PASSWORD_ARGON2_TIME` and `PASSWORD_ARGON2_THREADS`, and checked by Load.
+package hasher
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/braswelljr/axxxe/helper"
+)
+
+// algorithms
+const (
+	Bcrypt   = "bcrypt"
+	Argon2id = "argon2id"
+)
+
+var (
+	ErrMismatch         = errors.New("password does not match")
+	ErrUnknownAlgorithm = errors.New("unknown password hash algorithm")
+	ErrInvalidParams    = errors.New("invalid password hash parameters")
+)
+
+// Algorithm - a password hashing algorithm with its parameters
+type Algorithm interface {
+	// Hash - hashes a password
+	Hash(password string) (string, error)
+	// Verify - checks a password against a hash of the algorithm
+	Verify(password, encoded string) error
+	// Matches - checks if a hash was made by the algorithm with the same parameters
+	Matches(encoded string) bool
+}
+
+// default policies, also used when the configured parameters are invalid
+var (
+	DefaultBcrypt   = BcryptParams{Cost: 12}
+	DefaultArgon2id = Argon2idParams{Memory: 64 * 1024, Time: 3, Threads: 2}
+)
+
+// Load - checks the policy configured in the environment, called at startup so
+// invalid parameters stop the server instead of weakening or breaking hashes
+func Load() error {
+	_, err := Configured()
+	return err
+}
+
+// Configured - the algorithm configured in the environment, an error when the
+// algorithm is unknown or its parameters are invalid
+func Configured() (Algorithm, error) {
+	switch name := strings.ToLower(helper.GetEnv("PASSWORD_HASH_ALGORITHM", Bcrypt)); name {
+	case Bcrypt:
+		params := BcryptParams{Cost: helper.GetEnvInt("PASSWORD_BCRYPT_COST", DefaultBcrypt.Cost)}
+		if err := params.Validate(); err != nil {
+			return DefaultBcrypt, err
+		}
+		return params, nil
+	case Argon2id:
+		// read as ints so values too large for the parameters are refused, not wrapped
+		memory := helper.GetEnvInt("PASSWORD_ARGON2_MEMORY", int(DefaultArgon2id.Memory))
+		time := helper.GetEnvInt("PASSWORD_ARGON2_TIME", int(DefaultArgon2id.Time))
+		threads := helper.GetEnvInt("PASSWORD_ARGON2_THREADS", int(DefaultArgon2id.Threads))
+		switch {
+		case threads < 1 || threads > math.MaxUint8:
+			return DefaultArgon2id, fmt.Errorf("%w: argon2id threads must be between 1 and %d", ErrInvalidParams, math.MaxUint8)
+		case time < 1 || int64(time) > math.MaxUint32:
+			return DefaultArgon2id, fmt.Errorf("%w: argon2id time must be between 1 and %d", ErrInvalidParams, uint32(math.MaxUint32))
+		case memory < 1 || int64(memory) > math.MaxUint32:
+			return DefaultArgon2id, fmt.Errorf("%w: argon2id memory must be between 1 and %d KiB", ErrInvalidParams, uint32(math.MaxUint32))
+		}
+
+		params := Argon2idParams{Memory: uint32(memory), Time: uint32(time), Threads: uint8(threads)}
+		if err := params.Validate(); err != nil {
+			return DefaultArgon2id, err
+		}
+		return params, nil
+	default:
+		return DefaultBcrypt, fmt.Errorf("%w %q", ErrUnknownAlgorithm, name)
+	}
+}
+
+// Current - the algorithm new passwords are hashed with. Invalid parameters,
+// refused by Load at startup, fall back to the defaults of the algorithm.
+func Current() Algorithm {
+	algorithm, _ := Configured()
+	return algorithm
+}
+
+// Hash - hashes a password with the current algorithm
+func Hash(password string) (string, error) {
+	return Current().Hash(password)
+}
+
+// Verify - checks a password against a hash of any supported algorithm
+func Verify(password, encoded string) error {
+	switch algorithm(encoded) {
+	case Bcrypt:
+		return BcryptParams{}.Verify(password, encoded)
+	case Argon2id:
+		return Argon2idParams{}.Verify(password, encoded)
+	}
+
+	return ErrUnknownAlgorithm
+}
+
+// NeedsRehash - checks if a hash was made with another algorithm or other
+// parameters than the current ones
+func NeedsRehash(encoded string) bool {
+	return !Current().Matches(encoded)
+}
+
+// algorithm - the algorithm of a hash
+func algorithm(encoded string) string {
+	switch {
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return Bcrypt
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return Argon2id
+	}
+
+	return ""
+}
@@ -0,0 +1,232 @@
+package hasher
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// cheap parameters keeping the tests fast
+var (
+	testBcrypt   = BcryptParams{Cost: bcrypt.MinCost}
+	testArgon2id = Argon2idParams{Memory: 64, Time: 1, Threads: 1}
+)
+
+func TestHashVerify(t *testing.T) {
+	for _, algorithm := range []Algorithm{testBcrypt, testArgon2id} {
+		encoded, err := algorithm.Hash("correct horse battery staple")
+		if err != nil {
+			t.Fatalf("Hash() error = %v", err)
+		}
+
+		tests := []struct {
+			name     string
+			password string
+			err      error
+		}{
+			{name: "same password", password: "correct horse battery staple"},
+			{name: "other password", password: "correct horse battery stapler", err: ErrMismatch},
+			{name: "empty password", password: "", err: ErrMismatch},
+		}
+
+		for _, tt := range tests {
+			t.Run(encoded[:8]+" "+tt.name, func(t *testing.T) {
+				if err := Verify(tt.password, encoded); !errors.Is(err, tt.err) {
+					t.Errorf("Verify() error = %v, want %v", err, tt.err)
+				}
+				if err := algorithm.Verify(tt.password, encoded); !errors.Is(err, tt.err) {
+					t.Errorf("%T.Verify() error = %v, want %v", algorithm, err, tt.err)
+				}
+			})
+		}
+	}
+}
+
+func TestHashesAreSalted(t *testing.T) {
+	for _, algorithm := range []Algorithm{testBcrypt, testArgon2id} {
+		first, _ := algorithm.Hash("password")
+		second, _ := algorithm.Hash("password")
+		if first == second {
+			t.Errorf("%T.Hash() returned the same hash twice: %q", algorithm, first)
+		}
+	}
+}
+
+func TestArgon2idEncoding(t *testing.T) {
+	encoded, err := testArgon2id.Hash("password")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("Hash() = %q, want a PHC string of the parameters", encoded)
+	}
+
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		t.Fatalf("decodeArgon2id() error = %v", err)
+	}
+	if params != testArgon2id || len(salt) != argon2SaltLength || len(key) != argon2KeyLength {
+		t.Errorf("decodeArgon2id() = %+v, %d byte salt, %d byte key", params, len(salt), len(key))
+	}
+}
+
+func TestDecodeArgon2idInvalid(t *testing.T) {
+	valid, _ := testArgon2id.Hash("password")
+	parts := strings.Split(valid, "$")
+	salt, key := parts[4], parts[5]
+
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{name: "bcrypt hash", encoded: "$2a$04$abcdefghijklmnopqrstuuN2K5Ca8/2yGyB0W1YRI2zW.EJuY2n2K"},
+		{name: "missing parts", encoded: "$argon2id$v=19$m=64,t=1,p=1$" + salt},
+		{name: "other version", encoded: "$argon2id$v=16$m=64,t=1,p=1$" + salt + "$" + key},
+		{name: "argon2i", encoded: "$argon2i$v=19$m=64,t=1,p=1$" + salt + "$" + key},
+		{name: "malformed parameters", encoded: "$argon2id$v=19$m=64;t=1;p=1$" + salt + "$" + key},
+		{name: "no threads", encoded: "$argon2id$v=19$m=64,t=1,p=0$" + salt + "$" + key},
+		{name: "too many threads", encoded: "$argon2id$v=19$m=64,t=1,p=256$" + salt + "$" + key},
+		{name: "no iterations", encoded: "$argon2id$v=19$m=64,t=0,p=1$" + salt + "$" + key},
+		{name: "too little memory", encoded: "$argon2id$v=19$m=7,t=1,p=1$" + salt + "$" + key},
+		{name: "invalid salt", encoded: "$argon2id$v=19$m=64,t=1,p=1$!!$" + key},
+		{name: "empty key", encoded: "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, _, err := decodeArgon2id(tt.encoded); !errors.Is(err, errInvalidArgon2Hash) {
+				t.Errorf("decodeArgon2id() error = %v, want %v", err, errInvalidArgon2Hash)
+			}
+			if err := (Argon2idParams{}).Verify("password", tt.encoded); err == nil {
+				t.Error("Verify() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestVerifyUnknownAlgorithm(t *testing.T) {
+	for _, encoded := range []string{"", "plaintext", "$1$md5crypt$hash", "$argon2i$v=19$m=64,t=1,p=1$c2FsdA$a2V5"} {
+		if err := Verify("password", encoded); !errors.Is(err, ErrUnknownAlgorithm) {
+			t.Errorf("Verify(%q) error = %v, want %v", encoded, err, ErrUnknownAlgorithm)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	bcryptHash, _ := testBcrypt.Hash("password")
+	argon2idHash, _ := testArgon2id.Hash("password")
+
+	tests := []struct {
+		name      string
+		algorithm Algorithm
+		encoded   string
+		want      bool
+	}{
+		{name: "same bcrypt cost", algorithm: testBcrypt, encoded: bcryptHash, want: true},
+		{name: "other bcrypt cost", algorithm: BcryptParams{Cost: bcrypt.MinCost + 1}, encoded: bcryptHash},
+		{name: "bcrypt against argon2id", algorithm: testBcrypt, encoded: argon2idHash},
+		{name: "same argon2id parameters", algorithm: testArgon2id, encoded: argon2idHash, want: true},
+		{name: "other argon2id memory", algorithm: Argon2idParams{Memory: 128, Time: 1, Threads: 1}, encoded: argon2idHash},
+		{name: "other argon2id time", algorithm: Argon2idParams{Memory: 64, Time: 2, Threads: 1}, encoded: argon2idHash},
+		{name: "other argon2id threads", algorithm: Argon2idParams{Memory: 64, Time: 1, Threads: 2}, encoded: argon2idHash},
+		{name: "argon2id against bcrypt", algorithm: testArgon2id, encoded: bcryptHash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.algorithm.Matches(tt.encoded); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigured(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want Algorithm
+		err  error
+	}{
+		{name: "defaults", want: DefaultBcrypt},
+		{name: "bcrypt cost", env: map[string]string{"PASSWORD_BCRYPT_COST": "10"}, want: BcryptParams{Cost: 10}},
+		{name: "bcrypt cost too low", env: map[string]string{"PASSWORD_BCRYPT_COST": "3"}, want: DefaultBcrypt, err: ErrInvalidParams},
+		{name: "bcrypt cost too high", env: map[string]string{"PASSWORD_BCRYPT_COST": "32"}, want: DefaultBcrypt, err: ErrInvalidParams},
+		{name: "argon2id defaults", env: map[string]string{"PASSWORD_HASH_ALGORITHM": "argon2id"}, want: DefaultArgon2id},
+		{name: "algorithm in capitals", env: map[string]string{"PASSWORD_HASH_ALGORITHM": "ARGON2ID"}, want: DefaultArgon2id},
+		{
+			name: "argon2id parameters",
+			env:  map[string]string{"PASSWORD_HASH_ALGORITHM": "argon2id", "PASSWORD_ARGON2_MEMORY": "19456", "PASSWORD_ARGON2_TIME": "2", "PASSWORD_ARGON2_THREADS": "1"},
+			want: Argon2idParams{Memory: 19456, Time: 2, Threads: 1},
+		},
+		{
+			name: "argon2id threads wrapping to 0",
+			env:  map[string]string{"PASSWORD_HASH_ALGORITHM": "argon2id", "PASSWORD_ARGON2_THREADS": "256"},
+			want: DefaultArgon2id, err: ErrInvalidParams,
+		},
+		{
+			name: "argon2id no threads",
+			env:  map[string]string{"PASSWORD_HASH_ALGORITHM": "argon2id", "PASSWORD_ARGON2_THREADS": "0"},
+			want: DefaultArgon2id, err: ErrInvalidParams,
+		},
+		{
+			name: "argon2id memory wrapping",
+			env:  map[string]string{"PASSWORD_HASH_ALGORITHM": "argon2id", "PASSWORD_ARGON2_MEMORY": "4294967297"},
+			want: DefaultArgon2id, err: ErrInvalidParams,
+		},
+		{
+			name: "argon2id memory below 8 KiB per thread",
+			env:  map[string]string{"PASSWORD_HASH_ALGORITHM": "argon2id", "PASSWORD_ARGON2_MEMORY": "31", "PASSWORD_ARGON2_THREADS": "4"},
+			want: DefaultArgon2id, err: ErrInvalidParams,
+		},
+		{
+			name: "argon2id negative time",
+			env:  map[string]string{"PASSWORD_HASH_ALGORITHM": "argon2id", "PASSWORD_ARGON2_TIME": "-1"},
+			want: DefaultArgon2id, err: ErrInvalidParams,
+		},
+		{name: "unknown algorithm", env: map[string]string{"PASSWORD_HASH_ALGORITHM": "scrypt"}, want: DefaultBcrypt, err: ErrUnknownAlgorithm},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"PASSWORD_HASH_ALGORITHM", "PASSWORD_BCRYPT_COST", "PASSWORD_ARGON2_MEMORY", "PASSWORD_ARGON2_TIME", "PASSWORD_ARGON2_THREADS"} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			algorithm, err := Configured()
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Configured() error = %v, want %v", err, tt.err)
+			}
+			if algorithm != tt.want {
+				t.Errorf("Configured() = %+v, want %+v", algorithm, tt.want)
+			}
+			if !errors.Is(Load(), tt.err) {
+				t.Errorf("Load() error = %v, want %v", Load(), tt.err)
+			}
+			if Current() != tt.want {
+				t.Errorf("Current() = %+v, want %+v", Current(), tt.want)
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	t.Setenv("PASSWORD_HASH_ALGORITHM", "bcrypt")
+	t.Setenv("PASSWORD_BCRYPT_COST", "4")
+
+	bcryptHash, _ := testBcrypt.Hash("password")
+	argon2idHash, _ := testArgon2id.Hash("password")
+	if NeedsRehash(bcryptHash) {
+		t.Error("NeedsRehash() of a hash of the current policy = true")
+	}
+	if !NeedsRehash(argon2idHash) {
+		t.Error("NeedsRehash() of a hash of another algorithm = false")
+	}
+
+	t.Setenv("PASSWORD_BCRYPT_COST", "5")
+	if !NeedsRehash(bcryptHash) {
+		t.Error("NeedsRehash() of a hash of another cost = false")
+	}
+}
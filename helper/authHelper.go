@@ -1,34 +1,96 @@
 package helper
 
 import (
-	"errors"
-
 	"github.com/gofiber/fiber/v2"
+
+	"github.com/braswelljr/axxxe/model"
 )
 
-// MatchUserTypeToUID : Match Role to userid
-func MatchUserTypeToUID(ctx *fiber.Ctx, userId string) error {
-	// get user type and id
-	userType := ctx.Get("role")
-	uid := ctx.Get("user_id")
+// RolePermissions - permissions attached to every role.
+// Permissions only cover resources of other users, users can always access their own.
+var RolePermissions = map[string][]string{
+	model.RoleAdmin: {
+		model.PermissionAll,
+	},
+	model.RoleSupport: {
+		model.PermissionUsersList,
+		model.PermissionUsersRead,
+		model.PermissionUsersUnlock,
+		model.PermissionOrdersRead,
+	},
+	model.RoleMerchant: {
+		model.PermissionProductsWrite,
+		model.PermissionOrdersRead,
+		model.PermissionOrdersUpdate,
+	},
+	model.RoleUser: {},
+}
+
+// RoleExists - checks if a role is defined
+func RoleExists(role string) bool {
+	_, ok := RolePermissions[role]
+	return ok
+}
 
-	// check for user type before access is granted
-	if userType == "USER" && uid != userId {
-		return errors.New("unauthorised to access this resource")
+// HasPermission - checks if a role has a permission
+func HasPermission(role, permission string) bool {
+	for _, granted := range RolePermissions[role] {
+		if granted == model.PermissionAll || granted == permission {
+			return true
+		}
 	}
 
-	return CheckUserType(ctx, userType)
+	return false
+}
+
+// CurrentUserId - id of the authenticated user, set from the verified token claims
+func CurrentUserId(ctx *fiber.Ctx) string {
+	userId, _ := ctx.Locals("user_id").(string)
+	return userId
+}
+
+// CurrentRole - role of the authenticated user, set from the verified token claims
+func CurrentRole(ctx *fiber.Ctx) string {
+	role, _ := ctx.Locals("role").(string)
+	return role
 }
 
-func CheckUserType(ctx *fiber.Ctx, role string) (err error) {
-	// get user type and id
-	userType := ctx.Get("role")
-	err = nil
+// Can - checks if the authenticated user has a permission. Requests made with
+// an api key only have the permissions the key is scoped to.
+func Can(ctx *fiber.Ctx, permission string) bool {
+	if scopes, ok := ctx.Locals("permissions").([]string); ok {
+		for _, scope := range scopes {
+			if scope == permission {
+				return true
+			}
+		}
 
-	// check for type
-	if userType != role {
-		errors.New("unauthorised to access this resource")
+		return false
 	}
 
-	return err
+	return HasPermission(CurrentRole(ctx), permission)
+}
+
+// IsOwner - checks if the authenticated user is the user with the id
+func IsOwner(ctx *fiber.Ctx, userId string) bool {
+	currentUserId := CurrentUserId(ctx)
+	return currentUserId != "" && currentUserId == userId
+}
+
+// CurrentImpersonator - the user impersonating the authenticated user, nil when
+// the request is not impersonated
+func CurrentImpersonator(ctx *fiber.Ctx) *model.Impersonator {
+	impersonator, _ := ctx.Locals("impersonator").(*model.Impersonator)
+	return impersonator
+}
+
+// IsImpersonating - checks if the request is made by a user impersonating another user
+func IsImpersonating(ctx *fiber.Ctx) bool {
+	return CurrentImpersonator(ctx) != nil
+}
+
+// IsAPIKey - checks if the request is authenticated with an api key
+func IsAPIKey(ctx *fiber.Ctx) bool {
+	keyId, _ := ctx.Locals("api_key_id").(string)
+	return keyId != ""
 }
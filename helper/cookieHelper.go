@@ -0,0 +1,100 @@
+package helper
+
+import (
+	"crypto/subtle"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// session cookie names
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	CSRFTokenCookie    = "csrf_token"
+	// CSRFTokenHeader - header the csrf token cookie value must be echoed in
+	CSRFTokenHeader = "X-CSRF-Token"
+	// refreshTokenCookiePath - the refresh token cookie is only sent to the refresh endpoint
+	refreshTokenCookiePath = "/api/v1/users/refresh"
+	// OIDCStateCookie - binds an OpenID Connect login to the browser that started it
+	OIDCStateCookie = "oidc_state"
+	// oidcStateCookiePath - the state cookie is only sent to the OpenID Connect endpoints
+	oidcStateCookiePath = "/api/v1/users/oidc"
+)
+
+// CookieSessionRequested - checks if the client asked for a cookie session (`?mode=cookie`)
+func CookieSessionRequested(ctx *fiber.Ctx) bool {
+	return ctx.Query("mode") == "cookie"
+}
+
+// SetSessionCookies - stores the tokens in HttpOnly cookies and sets a csrf token
+// cookie readable by scripts, returns the csrf token
+func SetSessionCookies(ctx *fiber.Ctx, token, refreshToken string) (string, error) {
+	// keep the csrf token of the browser if it has one
+	csrfToken := ctx.Cookies(CSRFTokenCookie)
+	if csrfToken == "" {
+		random, err := RandomString(32)
+		if err != nil {
+			return "", err
+		}
+		csrfToken = random
+	}
+
+	ctx.Cookie(sessionCookie(AccessTokenCookie, token, "/", AccessTokenTTL, true))
+	ctx.Cookie(sessionCookie(RefreshTokenCookie, refreshToken, refreshTokenCookiePath, RefreshTokenTTL, true))
+	ctx.Cookie(sessionCookie(CSRFTokenCookie, csrfToken, "/", RefreshTokenTTL, false))
+
+	return csrfToken, nil
+}
+
+// ClearSessionCookies - removes the session cookies
+func ClearSessionCookies(ctx *fiber.Ctx) {
+	ctx.Cookie(sessionCookie(AccessTokenCookie, "", "/", -time.Hour, true))
+	ctx.Cookie(sessionCookie(RefreshTokenCookie, "", refreshTokenCookiePath, -time.Hour, true))
+	ctx.Cookie(sessionCookie(CSRFTokenCookie, "", "/", -time.Hour, false))
+}
+
+// SetOIDCStateCookie - stores the state of an OpenID Connect login in an HttpOnly
+// cookie. Strict cookies are not sent when the provider redirects back, they are
+// relaxed to lax.
+func SetOIDCStateCookie(ctx *fiber.Ctx, state string, ttl time.Duration) {
+	cookie := sessionCookie(OIDCStateCookie, state, oidcStateCookiePath, ttl, true)
+	if strings.EqualFold(cookie.SameSite, fiber.CookieSameSiteStrictMode) {
+		cookie.SameSite = fiber.CookieSameSiteLaxMode
+	}
+
+	ctx.Cookie(cookie)
+}
+
+// ClearOIDCStateCookie - removes the OpenID Connect login state cookie
+func ClearOIDCStateCookie(ctx *fiber.Ctx) {
+	ctx.Cookie(sessionCookie(OIDCStateCookie, "", oidcStateCookiePath, -time.Hour, true))
+}
+
+// ValidCSRFToken - checks the double submitted csrf token: the header must match the cookie
+func ValidCSRFToken(ctx *fiber.Ctx) bool {
+	cookie := ctx.Cookies(CSRFTokenCookie)
+	header := ctx.Get(CSRFTokenHeader)
+
+	return cookie != "" && subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
+
+// sessionCookie - a session cookie, configured with `COOKIE_DOMAIN`, `COOKIE_SECURE` and `COOKIE_SAMESITE`
+func sessionCookie(name, value, path string, ttl time.Duration, httpOnly bool) *fiber.Cookie {
+	secure := IsProduction()
+	if value := GetEnv("COOKIE_SECURE", ""); value != "" {
+		secure = value == "true"
+	}
+
+	return &fiber.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   GetEnv("COOKIE_DOMAIN", ""),
+		Expires:  time.Now().Add(ttl),
+		Secure:   secure,
+		HTTPOnly: httpOnly,
+		SameSite: GetEnv("COOKIE_SAMESITE", fiber.CookieSameSiteLaxMode),
+	}
+}
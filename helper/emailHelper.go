@@ -0,0 +1,8 @@
+package helper
+
+import "strings"
+
+// NormalizeEmail - the form emails are stored and looked up in, trimmed and lowercased
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,62 @@
+package helper
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GetEnv - gets an environmental variable or the fallback when it is not set
+func GetEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+// GetEnvInt - gets an environmental variable as an integer or the fallback when
+// it is not set or invalid
+func GetEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+
+	return value
+}
+
+// GetEnvDuration - gets an environmental variable as a duration (e.g. `15m`) or
+// the fallback when it is not set or invalid
+func GetEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+
+	return value
+}
+
+// GetEnvList - gets a comma separated environmental variable as a list or the
+// fallback when it is not set
+func GetEnvList(key string, fallback []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+// IsProduction - checks if the application runs in production (`APP_ENV=production`)
+func IsProduction() bool {
+	return strings.EqualFold(os.Getenv("APP_ENV"), "production")
+}
@@ -0,0 +1,13 @@
+package helper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// HashToken - hashes a high entropy token (e.g. reset tokens or recovery codes) for storage.
+// Passwords must be hashed with a password hashing function instead.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,246 @@
+package helper
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// signingKey - a key tokens are signed or verified with
+type signingKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+}
+
+// keyRing - the key used to sign new tokens and every key accepted to verify tokens
+type keyRing struct {
+	signing *signingKey
+	keys    map[string]*signingKey
+}
+
+var (
+	ring     *keyRing
+	ringLock sync.RWMutex
+
+	ErrNoKeyMaterial = errors.New("no token signing key configured, set JWT_KEYS_DIR")
+)
+
+// LoadSigningKeys - loads the token signing keys from `JWT_KEYS_DIR`.
+//
+// Every `<kid>.pem` file holding an RSA or Ed25519 private key can sign tokens
+// and every `<kid>.pub.pem` file holding a public key can only verify them, so
+// retired keys keep verifying tokens issued before a rotation. Tokens are signed
+// with the key `JWT_SIGNING_KEY_ID`, or the last private key in name order.
+//
+// Without keys, tokens are signed with HS256 and `SECRET_KEY` (a random secret
+// when not set) except in production where an error is returned.
+func LoadSigningKeys() error {
+	loaded, err := loadKeyRing()
+	if err != nil {
+		return err
+	}
+
+	ringLock.Lock()
+	ring = loaded
+	ringLock.Unlock()
+
+	return nil
+}
+
+// keys - the loaded key ring, loading it on first use
+func keys() (*keyRing, error) {
+	ringLock.RLock()
+	loaded := ring
+	ringLock.RUnlock()
+
+	if loaded != nil {
+		return loaded, nil
+	}
+
+	if err := LoadSigningKeys(); err != nil {
+		return nil, err
+	}
+
+	ringLock.RLock()
+	defer ringLock.RUnlock()
+
+	return ring, nil
+}
+
+// loadKeyRing - reads the key ring from the environment
+func loadKeyRing() (*keyRing, error) {
+	loaded := &keyRing{keys: map[string]*signingKey{}}
+
+	// keys from disk
+	if dir := os.Getenv("JWT_KEYS_DIR"); dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+
+		for _, file := range files {
+			key, err := readKeyFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+
+			// private keys take precedence over public keys with the same id
+			if existing, ok := loaded.keys[key.id]; ok && existing.private != nil {
+				continue
+			}
+			loaded.keys[key.id] = key
+		}
+
+		// pick the signing key
+		signingId := os.Getenv("JWT_SIGNING_KEY_ID")
+		for _, file := range files {
+			key := loaded.keys[keyId(file)]
+			if key.private != nil && (signingId == "" || key.id == signingId) {
+				loaded.signing = key
+			}
+		}
+
+		if signingId != "" && loaded.signing == nil {
+			return nil, fmt.Errorf("signing key %q not found in %s", signingId, dir)
+		}
+	}
+
+	if loaded.signing != nil {
+		return loaded, nil
+	}
+
+	// shared secret fallback
+	if IsProduction() {
+		return nil, ErrNoKeyMaterial
+	}
+
+	secret := os.Getenv("SECRET_KEY")
+	if secret == "" {
+		random, err := RandomString(32)
+		if err != nil {
+			return nil, err
+		}
+		secret = random
+		log.Println("SECRET_KEY is not set, tokens are signed with a random secret and will not survive a restart")
+	}
+
+	loaded.signing = &signingKey{
+		method:  jwt.SigningMethodHS256,
+		private: []byte(secret),
+		public:  []byte(secret),
+	}
+	loaded.keys[""] = loaded.signing
+
+	return loaded, nil
+}
+
+// readKeyFile - reads an RSA or Ed25519 key from a PEM file
+func readKeyFile(file string) (*signingKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{id: keyId(file)}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.private, key.public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.method, key.public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.method, key.private, key.public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.method, key.public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, use RSA or Ed25519", parsed)
+	}
+
+	return key, nil
+}
+
+// keyId - the key id of a key file, its name without the extensions
+func keyId(file string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(filepath.Base(file), ".pem"), ".pub")
+}
+
+// JWKS - the public verification keys as a JSON Web Key Set (RFC 7517).
+// Shared secrets are never published.
+func JWKS() (map[string]interface{}, error) {
+	loaded, err := keys()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(loaded.keys))
+	for id := range loaded.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	jwks := []map[string]string{}
+	for _, id := range ids {
+		key := loaded.keys[id]
+
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwks = append(jwks, map[string]string{
+				"kty": "RSA",
+				"kid": key.id,
+				"use": "sig",
+				"alg": key.method.Alg(),
+				"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks = append(jwks, map[string]string{
+				"kty": "OKP",
+				"crv": "Ed25519",
+				"kid": key.id,
+				"use": "sig",
+				"alg": key.method.Alg(),
+				"x":   base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+
+	return map[string]interface{}{"keys": jwks}, nil
+}
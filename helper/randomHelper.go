@@ -0,0 +1,16 @@
+package helper
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+)
+
+// RandomString - generates a url safe random string from size random bytes
+func RandomString(size int) (string, error) {
+	bytes := make([]byte, size)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
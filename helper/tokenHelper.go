@@ -1,7 +1,7 @@
 package helper
 
 import (
-	"os"
+	"errors"
 	"time"
 
 	"github.com/braswelljr/axxxe/model"
@@ -9,56 +9,227 @@ import (
 )
 
 var (
-	SecretKey = os.Getenv("SECRET_KEY")
+	// AccessTokenTTL - lifetime of an access token
+	AccessTokenTTL = time.Hour * time.Duration(168)
+	// RefreshTokenTTL - lifetime of a refresh token, renewed on every rotation
+	RefreshTokenTTL = time.Hour * time.Duration(720)
+
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+func init() {
+	// token timestamps are precise to the microsecond, so tokens issued in the
+	// same second as a "log out everywhere" can be told apart from it
+	jwt.TimePrecision = time.Microsecond
+}
+
+// token types
+const (
+	AccessToken            = "access"
+	RefreshToken           = "refresh"
+	EmailVerificationToken = "email_verification"
+	// TwoFactorChallengeToken - issued by login to users who must enter a TOTP code
+	TwoFactorChallengeToken = "two_factor_challenge"
+	// TwoFactorEnrollmentToken - issued by login to users who must enroll in two-factor authentication
+	TwoFactorEnrollmentToken = "two_factor_enrollment"
+	// InvitationToken - sent to people invited to create an account
+	InvitationToken = "invitation"
 )
 
 type SignedParams struct {
 	User model.TokenizedUserParams
+	// Type - the kind of token (access or refresh)
+	Type string `json:"type,omitempty"`
+	// Family - refresh token family, shared by all tokens rotated from the same login.
+	// The family is the session id, which access tokens carry in the `jti` claim.
+	Family string `json:"family,omitempty"`
+	// Impersonator - the user acting as the user of an impersonation token
+	Impersonator *model.Impersonator `json:"impersonator,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// GetAllTokens - creates an access token and a refresh token starting a new session
 func GetAllTokens(user model.TokenizedUserParams) (string, string, error) {
-	// set secret key
-	if SecretKey != "" {
-		SecretKey = "xxyyzzaa"
+	// new token family / session
+	family, err := RandomString(16)
+	if err != nil {
+		return "", "", err
 	}
 
+	return GetFamilyTokens(user, family)
+}
+
+// GetFamilyTokens - creates an access token and a refresh token within an existing token family
+func GetFamilyTokens(user model.TokenizedUserParams, family string) (string, string, error) {
+	now := time.Now().Local()
+
 	// params
 	signedParams := &SignedParams{
 		User: user,
+		Type: AccessToken,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: &jwt.NumericDate{
-				Time: time.Now().Local().Add(time.Hour * time.Duration(168)),
-			},
+			ID:        family,
+			Issuer:    tokenIssuer(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
 		},
 	}
 
+	// every refresh token gets a unique id so a rotated token never equals its predecessor
+	id, err := RandomString(16)
+	if err != nil {
+		return "", "", err
+	}
+
 	// refresh token
 	refreshClaims := &SignedParams{
+		Type:   RefreshToken,
+		Family: family,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: &jwt.NumericDate{
-				Time: time.Now().Local().Add(time.Hour * time.Duration(168)),
-			},
+			ID:        id,
+			Issuer:    tokenIssuer(),
+			Subject:   user.UserId,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(RefreshTokenTTL)),
 		},
 	}
 
 	// create token
-	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, signedParams).SignedString([]byte(SecretKey))
+	token, err := signToken(signedParams)
+	if err != nil {
+		return "", "", err
+	}
 
 	// create refresh token
-	refreshToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims).SignedString([]byte(SecretKey))
-
+	refreshToken, err := signToken(refreshClaims)
 	if err != nil {
 		return "", "", err
 	}
 
-	return token, refreshToken, err
+	return token, refreshToken, nil
 }
 
-// ValidateToken validates a token
+// GetImpersonationToken - creates a short lived access token of a user carrying
+// the identity of the impersonator. No refresh token is issued, the
+// impersonation ends when the token expires.
+func GetImpersonationToken(user model.TokenizedUserParams, impersonator model.Impersonator, sessionId string, ttl time.Duration) (string, error) {
+	now := time.Now().Local()
+
+	claims := &SignedParams{
+		User:         user,
+		Type:         AccessToken,
+		Impersonator: &impersonator,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionId,
+			Issuer:    tokenIssuer(),
+			Subject:   user.UserId,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+
+	return signToken(claims)
+}
+
+// ValidateToken validates an access token
 func ValidateToken(token string) (*SignedParams, error) {
-	if SecretKey != "" {
-		SecretKey = "xxyyzzaa"
+	claims, err := parseToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	// refresh tokens can not be used to access resources
+	if claims.Type != AccessToken || claims.ID == "" || claims.IssuedAt == nil {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// ValidateRefreshToken validates a refresh token
+func ValidateRefreshToken(token string) (*SignedParams, error) {
+	claims, err := parseToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	// make sure it is a refresh token bound to a user and a family
+	if claims.Type != RefreshToken || claims.Subject == "" || claims.Family == "" || claims.IssuedAt == nil {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// GetActionToken - creates a short lived token allowing a single kind of action
+// (e.g. email verification) for a user
+func GetActionToken(tokenType string, user model.TokenizedUserParams, ttl time.Duration) (string, error) {
+	now := time.Now().Local()
+
+	claims := &SignedParams{
+		User: user,
+		Type: tokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer(),
+			Subject:   user.UserId,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+
+	return signToken(claims)
+}
+
+// ValidateActionToken validates a token created by GetActionToken
+func ValidateActionToken(tokenType, token string) (*SignedParams, error) {
+	claims, err := parseToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	// make sure the token allows the action
+	if claims.Type != tokenType || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// TokenFamily - gets the family of a token issued by the server without verifying it
+func TokenFamily(token string) string {
+	if token == "" {
+		return ""
+	}
+
+	claims := &SignedParams{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		return ""
+	}
+
+	return claims.Family
+}
+
+// signToken - signs the claims with the current signing key
+func signToken(claims jwt.Claims) (string, error) {
+	loaded, err := keys()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(loaded.signing.method, claims)
+	if loaded.signing.id != "" {
+		token.Header["kid"] = loaded.signing.id
+	}
+
+	return token.SignedString(loaded.signing.private)
+}
+
+// parseToken - parses and verifies a token signed by signToken with any of the
+// verification keys
+func parseToken(token string) (*SignedParams, error) {
+	loaded, err := keys()
+	if err != nil {
+		return nil, err
 	}
 
 	// parse token
@@ -66,8 +237,21 @@ func ValidateToken(token string) (*SignedParams, error) {
 		token,
 		&SignedParams{},
 		func(token *jwt.Token) (interface{}, error) {
-			return []byte(SecretKey), nil
+			kid, _ := token.Header["kid"].(string)
+
+			// the key must exist and match the algorithm of the token
+			key, ok := loaded.keys[kid]
+			if !ok || key.method.Alg() != token.Method.Alg() {
+				return nil, ErrInvalidToken
+			}
+
+			return key.public, nil
 		},
+		jwt.WithValidMethods([]string{
+			jwt.SigningMethodRS256.Alg(),
+			jwt.SigningMethodEdDSA.Alg(),
+			jwt.SigningMethodHS256.Alg(),
+		}),
 	)
 
 	if err != nil {
@@ -75,14 +259,19 @@ func ValidateToken(token string) (*SignedParams, error) {
 	}
 
 	claims, ok := tokenClaims.Claims.(*SignedParams)
-	if !ok {
-		return nil, err
+	if !ok || !tokenClaims.Valid {
+		return nil, ErrInvalidToken
 	}
 
-	// Ensure token is valid not expired
-	if claims.VerifyExpiresAt(time.Now().Local(), true) == false {
-		return nil, err
+	// Ensure token is valid not expired and issued by us
+	if !claims.VerifyExpiresAt(time.Now().Local(), true) || !claims.VerifyIssuer(tokenIssuer(), true) {
+		return nil, ErrInvalidToken
 	}
 
 	return claims, nil
 }
+
+// tokenIssuer - the issuer (`iss`) of tokens, set with `JWT_ISSUER`
+func tokenIssuer() string {
+	return GetEnv("JWT_ISSUER", "axxxe")
+}
@@ -0,0 +1,153 @@
+// Package lockout protects logins against brute-force attacks.
+//
+// Failed attempts are counted per account and per ip address. After
+// `LOGIN_BACKOFF_AFTER` failures every new attempt has to wait exponentially
+// longer (`LOGIN_BACKOFF_BASE` doubled on every failure up to
+// `LOGIN_BACKOFF_MAX`) and after `LOGIN_MAX_ATTEMPTS` failures for an account,
+// or `LOGIN_IP_MAX_ATTEMPTS` for an ip address, it is locked for
+// `LOGIN_LOCKOUT_DURATION`. Counters are forgotten `LOGIN_ATTEMPT_WINDOW` after
+// the last failure.
+package lockout
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/braswelljr/axxxe/database"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/model"
+)
+
+var collection = database.OpenCollection(database.Client, "login_attempts")
+
+func init() {
+	database.CreateIndexes(collection,
+		mongo.IndexModel{Keys: bson.D{{Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)},
+		mongo.IndexModel{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	)
+}
+
+// AccountKey - key of the attempts on an account
+func AccountKey(email string) string {
+	return "account:" + helper.NormalizeEmail(email)
+}
+
+// IPKey - key of the attempts from an ip address
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check - gets how long to wait before the next attempt is allowed for all the keys,
+// zero when an attempt can be made now
+func Check(ctx context.Context, keys ...string) (time.Duration, error) {
+	cursor, err := collection.Find(ctx, bson.M{"key": bson.M{"$in": keys}})
+	if err != nil {
+		return 0, err
+	}
+
+	var attempts []model.LoginAttempts
+	if err := cursor.All(ctx, &attempts); err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	wait := time.Duration(0)
+	for _, attempt := range attempts {
+		// locked
+		if until := attempt.LockedUntil.Time(); attempt.LockedUntil != 0 && until.After(now) && until.Sub(now) > wait {
+			wait = until.Sub(now)
+		}
+
+		// backing off
+		if until := attempt.LastFailureAt.Time().Add(backoff(attempt.Failures)); until.After(now) && until.Sub(now) > wait {
+			wait = until.Sub(now)
+		}
+	}
+
+	return wait, nil
+}
+
+// Fail - records a failed attempt for every key
+func Fail(ctx context.Context, keys ...string) error {
+	now := time.Now()
+	window := helper.GetEnvDuration("LOGIN_ATTEMPT_WINDOW", time.Hour)
+
+	for _, key := range keys {
+		attempt := &model.LoginAttempts{}
+		err := collection.FindOneAndUpdate(
+			ctx,
+			bson.M{"key": key},
+			bson.M{
+				"$inc": bson.M{"failures": 1},
+				"$set": bson.M{
+					"last_failure_at": primitive.NewDateTimeFromTime(now),
+					"expires_at":      primitive.NewDateTimeFromTime(now.Add(window)),
+				},
+			},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(attempt)
+		if err != nil {
+			return err
+		}
+
+		// lock once the maximum number of attempts is reached
+		if attempt.Failures >= maxAttempts(key) {
+			lockedUntil := now.Add(helper.GetEnvDuration("LOGIN_LOCKOUT_DURATION", 30*time.Minute))
+			if _, err := collection.UpdateOne(
+				ctx,
+				bson.M{"key": key},
+				bson.M{
+					"$set": bson.M{
+						"locked_until": primitive.NewDateTimeFromTime(lockedUntil),
+						"expires_at":   primitive.NewDateTimeFromTime(lockedUntil.Add(window)),
+					},
+				},
+			); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Reset - forgets the failed attempts of the keys, used after a successful login
+// and to unlock accounts
+func Reset(ctx context.Context, keys ...string) error {
+	_, err := collection.DeleteMany(ctx, bson.M{"key": bson.M{"$in": keys}})
+	return err
+}
+
+// maxAttempts - number of failures after which a key is locked
+func maxAttempts(key string) int {
+	if strings.HasPrefix(key, "ip:") {
+		return helper.GetEnvInt("LOGIN_IP_MAX_ATTEMPTS", 50)
+	}
+
+	return helper.GetEnvInt("LOGIN_MAX_ATTEMPTS", 10)
+}
+
+// backoff - how long to wait after a number of failures
+func backoff(failures int) time.Duration {
+	after := helper.GetEnvInt("LOGIN_BACKOFF_AFTER", 3)
+	if failures < after {
+		return 0
+	}
+
+	maximum := helper.GetEnvDuration("LOGIN_BACKOFF_MAX", 15*time.Minute)
+	delay := helper.GetEnvDuration("LOGIN_BACKOFF_BASE", time.Second)
+	for i := after; i < failures; i++ {
+		delay *= 2
+		if delay >= maximum {
+			return maximum
+		}
+	}
+
+	return delay
+}
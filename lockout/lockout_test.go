@@ -0,0 +1,112 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/braswelljr/axxxe/database/databasetest"
+)
+
+func TestBackoff(t *testing.T) {
+	t.Setenv("LOGIN_BACKOFF_AFTER", "3")
+	t.Setenv("LOGIN_BACKOFF_BASE", "1s")
+	t.Setenv("LOGIN_BACKOFF_MAX", "5s")
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: 0},
+		{failures: 2, want: 0},
+		{failures: 3, want: time.Second},
+		{failures: 4, want: 2 * time.Second},
+		{failures: 5, want: 4 * time.Second},
+		{failures: 6, want: 5 * time.Second},
+		{failures: 100, want: 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := backoff(tt.failures); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestMaxAttempts(t *testing.T) {
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "4")
+	t.Setenv("LOGIN_IP_MAX_ATTEMPTS", "20")
+
+	if got := maxAttempts(AccountKey(" Jane@Example.com ")); got != 4 {
+		t.Errorf("account max attempts = %d, want 4", got)
+	}
+	if got := maxAttempts(IPKey("192.0.2.1")); got != 20 {
+		t.Errorf("ip max attempts = %d, want 20", got)
+	}
+	if AccountKey(" Jane@Example.com ") != AccountKey("jane@example.com") {
+		t.Errorf("expected account keys of normalized emails")
+	}
+}
+
+func TestLockout(t *testing.T) {
+	databasetest.Start(t)
+	t.Setenv("LOGIN_BACKOFF_AFTER", "2")
+	t.Setenv("LOGIN_BACKOFF_BASE", "1m")
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "3")
+	t.Setenv("LOGIN_LOCKOUT_DURATION", "30m")
+
+	ctx := context.Background()
+	account := AccountKey("jane@example.com")
+	ip := IPKey("192.0.2.1")
+
+	check := func(keys ...string) time.Duration {
+		t.Helper()
+
+		wait, err := Check(ctx, keys...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return wait
+	}
+
+	// the first failures are free
+	if err := Fail(ctx, account, ip); err != nil {
+		t.Fatal(err)
+	}
+	if wait := check(account, ip); wait != 0 {
+		t.Fatalf("wait after 1 failure = %v, want 0", wait)
+	}
+
+	// then attempts back off
+	if err := Fail(ctx, account, ip); err != nil {
+		t.Fatal(err)
+	}
+	if wait := check(account, ip); wait <= 50*time.Second || wait > time.Minute {
+		t.Fatalf("wait after 2 failures = %v, want about a minute", wait)
+	}
+
+	// and the account is locked, not the ip address
+	if err := Fail(ctx, account, ip); err != nil {
+		t.Fatal(err)
+	}
+	if wait := check(account); wait <= 29*time.Minute || wait > 30*time.Minute {
+		t.Fatalf("wait of the locked account = %v, want about 30 minutes", wait)
+	}
+	if wait := check(ip); wait > 2*time.Minute {
+		t.Fatalf("wait of the ip address = %v, want its backoff", wait)
+	}
+
+	// other accounts are not affected
+	if wait := check(AccountKey("john@example.com")); wait != 0 {
+		t.Fatalf("wait of another account = %v, want 0", wait)
+	}
+
+	// until reset
+	if err := Reset(ctx, account); err != nil {
+		t.Fatal(err)
+	}
+	if wait := check(account); wait != 0 {
+		t.Fatalf("wait after reset = %v, want 0", wait)
+	}
+}
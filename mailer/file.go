@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/braswelljr/axxxe/helper"
+)
+
+// FileMailer - writes every message to an `.eml` file in a directory
+type FileMailer struct {
+	Dir string
+}
+
+// NewFileMailer - creates a mailer writing messages to dir
+func NewFileMailer(dir string) *FileMailer {
+	return &FileMailer{Dir: dir}
+}
+
+// Send - writes the message to a new file
+func (m *FileMailer) Send(_ context.Context, message Message) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	// unique file name
+	suffix, err := helper.RandomString(6)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), suffix)
+
+	var email strings.Builder
+	fmt.Fprintf(&email, "From: %s\r\n", message.From)
+	fmt.Fprintf(&email, "To: %s\r\n", message.To)
+	fmt.Fprintf(&email, "Subject: %s\r\n", message.Subject)
+	fmt.Fprintf(&email, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&email, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	email.WriteString(message.Body)
+
+	return os.WriteFile(filepath.Join(m.Dir, name), []byte(email.String()), 0o600)
+}
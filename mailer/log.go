@@ -0,0 +1,23 @@
+package mailer
+
+import (
+	"context"
+	"log"
+	"os"
+)
+
+// LogMailer - writes messages to a logger instead of sending them
+type LogMailer struct {
+	Logger *log.Logger
+}
+
+// NewLogMailer - creates a mailer writing to the standard error
+func NewLogMailer() *LogMailer {
+	return &LogMailer{Logger: log.New(os.Stderr, "[mailer] ", log.LstdFlags)}
+}
+
+// Send - logs the message
+func (m *LogMailer) Send(_ context.Context, message Message) error {
+	m.Logger.Printf("from: %s to: %s subject: %s\n%s\n", message.From, message.To, message.Subject, message.Body)
+	return nil
+}
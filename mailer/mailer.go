@@ -0,0 +1,61 @@
+// Package mailer sends emails to users.
+//
+// The mailer used is picked with the `MAILER` environmental variable:
+//   - log  - writes emails to the application log (default)
+//   - file - writes every email to a file in `MAIL_DIR`
+package mailer
+
+import (
+	"context"
+	"sync"
+
+	"github.com/braswelljr/axxxe/helper"
+)
+
+// Message - an email message
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer - sends email messages
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+var (
+	defaultMailer Mailer
+	once          sync.Once
+)
+
+// Default - the mailer configured for the application
+func Default() Mailer {
+	once.Do(func() {
+		switch helper.GetEnv("MAILER", "log") {
+		case "file":
+			defaultMailer = NewFileMailer(helper.GetEnv("MAIL_DIR", "tmp/mail"))
+		default:
+			defaultMailer = NewLogMailer()
+		}
+	})
+
+	return defaultMailer
+}
+
+// SetDefault - replaces the mailer used by the application
+func SetDefault(mailer Mailer) {
+	once.Do(func() {})
+	defaultMailer = mailer
+}
+
+// Send - sends a message with the default mailer from the configured sender address
+func Send(ctx context.Context, to, subject, body string) error {
+	return Default().Send(ctx, Message{
+		From:    helper.GetEnv("MAIL_FROM", "no-reply@axxxe.com"),
+		To:      to,
+		Subject: subject,
+		Body:    body,
+	})
+}
@@ -0,0 +1,122 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// recorder - a mailer keeping the messages it sends
+type recorder struct {
+	messages []Message
+}
+
+func (r *recorder) Send(_ context.Context, message Message) error {
+	r.messages = append(r.messages, message)
+	return nil
+}
+
+var messages = []Message{
+	{From: "no-reply@axxxe.com", To: "jane@example.com", Subject: "Reset your password", Body: "Reset your password at https://example.com/reset?token=abc"},
+	{From: "no-reply@axxxe.com", To: "john@example.com", Subject: "Verify your email", Body: "Line one\r\nLine two\r\n"},
+	{From: "no-reply@axxxe.com", To: "joe@example.com", Subject: "Empty", Body: ""},
+}
+
+func TestSend(t *testing.T) {
+	t.Setenv("MAIL_FROM", "team@example.com")
+	sent := &recorder{}
+	SetDefault(sent)
+
+	for _, message := range messages {
+		if err := Send(context.Background(), message.To, message.Subject, message.Body); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	if len(sent.messages) != len(messages) {
+		t.Fatalf("sent %d messages, want %d", len(sent.messages), len(messages))
+	}
+	for i, message := range messages {
+		message.From = "team@example.com"
+		if sent.messages[i] != message {
+			t.Errorf("message %d = %+v, want %+v", i, sent.messages[i], message)
+		}
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	for _, message := range messages {
+		t.Run(message.Subject, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "mail")
+			if err := NewFileMailer(dir).Send(context.Background(), message); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+
+			files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+			if err != nil || len(files) != 1 {
+				t.Fatalf("found %d files, want 1 (%v)", len(files), err)
+			}
+			file, err := os.Open(files[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			email, err := mail.ReadMessage(file)
+			if err != nil {
+				t.Fatalf("ReadMessage() error = %v", err)
+			}
+			for header, want := range map[string]string{"From": message.From, "To": message.To, "Subject": message.Subject} {
+				if got := email.Header.Get(header); got != want {
+					t.Errorf("%s = %q, want %q", header, got, want)
+				}
+			}
+			if _, err := email.Header.Date(); err != nil {
+				t.Errorf("Date() error = %v", err)
+			}
+			body, _ := io.ReadAll(email.Body)
+			if string(body) != message.Body {
+				t.Errorf("body = %q, want %q", body, message.Body)
+			}
+		})
+	}
+}
+
+func TestFileMailerUniqueFiles(t *testing.T) {
+	dir := t.TempDir()
+	mailer := NewFileMailer(dir)
+	for i := 0; i < 10; i++ {
+		if err := mailer.Send(context.Background(), messages[0]); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.eml")); len(files) != 10 {
+		t.Errorf("found %d files, want 10", len(files))
+	}
+}
+
+func TestLogMailer(t *testing.T) {
+	for _, message := range messages {
+		t.Run(message.Subject, func(t *testing.T) {
+			var out bytes.Buffer
+			mailer := &LogMailer{Logger: log.New(&out, "", 0)}
+			if err := mailer.Send(context.Background(), message); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+
+			logged := out.String()
+			for _, want := range []string{"from: " + message.From, "to: " + message.To, "subject: " + message.Subject, message.Body} {
+				if !strings.Contains(logged, want) {
+					t.Errorf("logged %q, want it to contain %q", logged, want)
+				}
+			}
+		})
+	}
+}
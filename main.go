@@ -1,13 +1,21 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 
+	"github.com/braswelljr/axxxe/controllers/v1/user"
+	"github.com/braswelljr/axxxe/database"
+	"github.com/braswelljr/axxxe/hasher"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/passwordpolicy"
+	"github.com/braswelljr/axxxe/privacy"
 	"github.com/braswelljr/axxxe/routes"
 )
 
@@ -16,6 +24,39 @@ var (
 )
 
 func main() {
+	// load token signing keys, refuses to start in production without keys
+	if err := helper.LoadSigningKeys(); err != nil {
+		log.Fatal("Could not load token signing keys ", err)
+	}
+
+	// check the password hashing policy, refuses to start with invalid parameters
+	if err := hasher.Load(); err != nil {
+		log.Fatal("Invalid password hashing policy ", err)
+	}
+
+	// open the breached passwords list, refuses to start with an unusable list
+	if err := passwordpolicy.LoadBreachedList(); err != nil {
+		log.Fatal("Could not load the breached passwords list ", err)
+	}
+
+	// create the indexes of every collection, refuses to start without them
+	indexCtx, cancelIndexes := context.WithTimeout(context.Background(), time.Minute)
+	if err := database.EnsureIndexes(indexCtx); err != nil {
+		log.Fatal("Could not create the database indexes ", err)
+	}
+	cancelIndexes()
+
+	// normalize the stored emails and make them unique, refuses to start while
+	// several users share an email
+	migrateCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	if err := user.MigrateEmails(migrateCtx); err != nil {
+		log.Fatal("Could not migrate the user emails ", err)
+	}
+	cancel()
+
+	// delete the accounts whose deletion grace period has passed
+	go privacy.Run(context.Background(), helper.GetEnvDuration("ACCOUNT_DELETION_INTERVAL", time.Hour))
+
 	// Initialize app
 	app := fiber.New()
 
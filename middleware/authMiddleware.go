@@ -1,22 +1,59 @@
 package middleware
 
 import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 
+	"github.com/braswelljr/axxxe/apikey"
+	"github.com/braswelljr/axxxe/audit"
 	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/model"
+	"github.com/braswelljr/axxxe/session"
+)
+
+// ways a request can be authenticated
+const (
+	AuthMethodHeader = "header"
+	AuthMethodCookie = "cookie"
+	AuthMethodAPIKey = "api_key"
 )
 
-// Authenticate is a middleware that checks if the user is authenticated
-func Authenticate() fiber.Handler {
+// AuthConfig - configures how a route group is authenticated
+type AuthConfig struct {
+	// AllowCookie - accept tokens from the HttpOnly session cookie, use with CSRF
+	AllowCookie bool
+}
+
+// Authenticate is a middleware that checks if the user is authenticated.
+// Tokens are read from the `Authorization: Bearer` header, the legacy `token`
+// header and, when allowed by the config, the session cookie. Services can use
+// an api key in the `Authorization: Bearer` or `X-API-Key` header instead.
+func Authenticate(config ...AuthConfig) fiber.Handler {
+	cfg := AuthConfig{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
 	return func(ctx *fiber.Ctx) error {
 		// get the token from the request
-		token := ctx.Get("token")
+		token, method := requestToken(ctx, cfg)
 		if token == "" {
 			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"message": "Unauthorized",
 				"status":  fiber.StatusUnauthorized,
 			})
 		}
+
+		// api keys of services
+		if apikey.IsKey(token) {
+			return authenticateAPIKey(ctx, token)
+		}
+
 		// check if the token is valid
 		claims, err := helper.ValidateToken(token)
 		if err != nil {
@@ -25,6 +62,46 @@ func Authenticate() fiber.Handler {
 				"status":  fiber.StatusUnauthorized,
 			})
 		}
+
+		// context
+		contxt, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		// check if the session has been revoked
+		revoked, err := session.IsRevoked(contxt, claims.ID, claims.User.UserId, claims.IssuedAt.Time)
+		if err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": err.Error(),
+				"status":  fiber.StatusInternalServerError,
+			})
+		}
+		if revoked {
+			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "Unauthorized",
+				"status":  fiber.StatusUnauthorized,
+			})
+		}
+
+		// impersonations end with the session of the impersonator
+		if claims.Impersonator != nil {
+			revoked, err := session.IsRevoked(contxt, claims.Impersonator.SessionId, claims.Impersonator.UserId, claims.IssuedAt.Time)
+			if err != nil {
+				return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"message": err.Error(),
+					"status":  fiber.StatusInternalServerError,
+				})
+			}
+			if revoked {
+				return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"message": "Unauthorized",
+					"status":  fiber.StatusUnauthorized,
+				})
+			}
+		} else if err := session.Touch(contxt, claims.ID, ctx.IP()); err != nil {
+			// record the use of the session
+			log.Printf("Oops! could not record the use of session %s: %v\n", claims.ID, err)
+		}
+
 		// set the claims to the context
 		ctx.Locals("email", claims.User.Email)
 		ctx.Locals("username", claims.User.Username)
@@ -34,6 +111,105 @@ func Authenticate() fiber.Handler {
 		ctx.Locals("gender", claims.User.Gender)
 		ctx.Locals("role", claims.User.Role)
 		ctx.Locals("user_id", claims.User.UserId)
+		ctx.Locals("verified", claims.User.Verified)
+		ctx.Locals("session_id", claims.ID)
+		ctx.Locals("auth_method", method)
+
+		// every impersonated request is audited
+		if claims.Impersonator != nil {
+			ctx.Locals("impersonator", claims.Impersonator)
+			err := ctx.Next()
+			auditImpersonatedRequest(ctx, claims, err)
+			return err
+		}
+
 		return ctx.Next()
 	}
 }
+
+// auditImpersonatedRequest - records a request made while impersonating a user
+// in the audit log
+func auditImpersonatedRequest(ctx *fiber.Ctx, claims *helper.SignedParams, handlerErr error) {
+	// context
+	contxt, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// errors returned by handlers are turned into responses by the error handler
+	status := ctx.Response().StatusCode()
+	var fiberErr *fiber.Error
+	if errors.As(handlerErr, &fiberErr) {
+		status = fiberErr.Code
+	} else if handlerErr != nil {
+		status = fiber.StatusInternalServerError
+	}
+
+	if err := audit.Record(contxt, &model.AuditEntry{
+		Action:    model.AuditImpersonatedRequest,
+		ActorId:   claims.Impersonator.UserId,
+		UserId:    claims.User.UserId,
+		SessionId: claims.ID,
+		Method:    ctx.Method(),
+		Path:      ctx.Path(),
+		Status:    status,
+		IP:        ctx.IP(),
+		UserAgent: ctx.Get(fiber.HeaderUserAgent),
+	}); err != nil {
+		log.Printf("Oops! could not audit the request of impersonation %s: %v\n", claims.ID, err)
+	}
+}
+
+// authenticateAPIKey - authenticates a service with an api key, the key acts
+// with the permissions it is scoped to
+func authenticateAPIKey(ctx *fiber.Ctx, key string) error {
+	// context
+	contxt, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	apiKey, err := apikey.Authenticate(contxt, key)
+	if errors.Is(err, apikey.ErrInvalidKey) {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Unauthorized",
+			"status":  fiber.StatusUnauthorized,
+		})
+	}
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": err.Error(),
+			"status":  fiber.StatusInternalServerError,
+		})
+	}
+
+	// set the key to the context
+	ctx.Locals("api_key_id", apiKey.Id.Hex())
+	ctx.Locals("permissions", apikey.Permissions(apiKey))
+	ctx.Locals("verified", true)
+	ctx.Locals("auth_method", AuthMethodAPIKey)
+	return ctx.Next()
+}
+
+// requestToken - gets the access token of a request and how it was sent
+func requestToken(ctx *fiber.Ctx, cfg AuthConfig) (string, string) {
+	// Authorization: Bearer <token>
+	if scheme, token, found := strings.Cut(ctx.Get(fiber.HeaderAuthorization), " "); found && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token), AuthMethodHeader
+	}
+
+	// api key header
+	if key := ctx.Get("X-API-Key"); key != "" {
+		return key, AuthMethodAPIKey
+	}
+
+	// legacy token header
+	if token := ctx.Get("token"); token != "" {
+		return token, AuthMethodHeader
+	}
+
+	// session cookie
+	if cfg.AllowCookie {
+		if token := ctx.Cookies(helper.AccessTokenCookie); token != "" {
+			return token, AuthMethodCookie
+		}
+	}
+
+	return "", ""
+}
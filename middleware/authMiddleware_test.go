@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/braswelljr/axxxe/apikey"
+	"github.com/braswelljr/axxxe/database/databasetest"
+	"github.com/braswelljr/axxxe/model"
+)
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	databasetest.Start(t)
+	ctx := context.Background()
+
+	// keys created before a scope became unscopable keep it stored
+	key, _, err := apikey.Create(ctx, "billing", []string{model.PermissionUsersRead, model.PermissionUsersManageRoles}, time.Hour, ownerId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedKey, revoked, err := apikey.Create(ctx, "revoked", []string{model.PermissionUsersRead}, time.Hour, ownerId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := apikey.Revoke(ctx, revoked.Id.Hex()); err != nil {
+		t.Fatal(err)
+	}
+
+	ok := func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(fiber.StatusOK)
+	}
+	app := fiber.New()
+	app.Get("/users/:user_id", Authenticate(), RequirePermission(model.PermissionUsersRead), ok)
+	app.Patch("/users/:user_id", Authenticate(), RequireOwnerOrPermission("user_id", model.PermissionUsersUpdate), ok)
+	app.Patch("/users/:user_id/role", Authenticate(), RequirePermission(model.PermissionUsersManageRoles), ok)
+	app.Post("/logout", Authenticate(), RequireUser(), ok)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header string
+		key    string
+		status int
+	}{
+		{name: "scoped", method: fiber.MethodGet, path: "/users/" + ownerId, header: fiber.HeaderAuthorization, key: key, status: fiber.StatusOK},
+		{name: "scoped in the api key header", method: fiber.MethodGet, path: "/users/" + ownerId, header: "X-API-Key", key: key, status: fiber.StatusOK},
+		{name: "unscoped", method: fiber.MethodPatch, path: "/users/" + ownerId, header: fiber.HeaderAuthorization, key: key, status: fiber.StatusForbidden},
+		{name: "unscopable", method: fiber.MethodPatch, path: "/users/" + ownerId + "/role", header: fiber.HeaderAuthorization, key: key, status: fiber.StatusForbidden},
+		{name: "session route", method: fiber.MethodPost, path: "/logout", header: fiber.HeaderAuthorization, key: key, status: fiber.StatusForbidden},
+		{name: "wrong secret", method: fiber.MethodGet, path: "/users/" + ownerId, header: fiber.HeaderAuthorization, key: key + "x", status: fiber.StatusUnauthorized},
+		{name: "unknown", method: fiber.MethodGet, path: "/users/" + ownerId, header: "X-API-Key", key: apikey.KeyPrefix + "00000000_secret", status: fiber.StatusUnauthorized},
+		{name: "revoked", method: fiber.MethodGet, path: "/users/" + ownerId, header: fiber.HeaderAuthorization, key: revokedKey, status: fiber.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.header == fiber.HeaderAuthorization {
+				req.Header.Set(tt.header, "Bearer "+tt.key)
+			} else {
+				req.Header.Set(tt.header, tt.key)
+			}
+			res, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", res.StatusCode, tt.status)
+			}
+		})
+	}
+}
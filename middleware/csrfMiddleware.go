@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/braswelljr/axxxe/helper"
+)
+
+// CSRF is a middleware protecting cookie sessions with double submitted csrf
+// tokens: state-changing requests authenticated with a cookie must send the
+// value of the csrf token cookie in the `X-CSRF-Token` header. Requests with
+// tokens in headers can not be forged by other sites and are let through.
+// It must be used after Authenticate.
+func CSRF() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if method, _ := ctx.Locals("auth_method").(string); method != AuthMethodCookie {
+			return ctx.Next()
+		}
+
+		switch ctx.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions, fiber.MethodTrace:
+			return ctx.Next()
+		}
+
+		if !helper.ValidCSRFToken(ctx) {
+			return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "Invalid CSRF token",
+				"status":  fiber.StatusForbidden,
+			})
+		}
+
+		return ctx.Next()
+	}
+}
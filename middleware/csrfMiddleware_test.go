@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/braswelljr/axxxe/database/databasetest"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/model"
+)
+
+func TestCSRF(t *testing.T) {
+	const csrfToken = "csrf-token"
+
+	tests := []struct {
+		name   string
+		method string
+		auth   string
+		header string
+		status int
+	}{
+		{name: "cookie post with token", method: fiber.MethodPost, auth: AuthMethodCookie, header: csrfToken, status: fiber.StatusOK},
+		{name: "cookie post without token", method: fiber.MethodPost, auth: AuthMethodCookie, status: fiber.StatusForbidden},
+		{name: "cookie post with wrong token", method: fiber.MethodPost, auth: AuthMethodCookie, header: "forged", status: fiber.StatusForbidden},
+		{name: "cookie delete without token", method: fiber.MethodDelete, auth: AuthMethodCookie, status: fiber.StatusForbidden},
+		{name: "cookie patch without token", method: fiber.MethodPatch, auth: AuthMethodCookie, status: fiber.StatusForbidden},
+		{name: "cookie get without token", method: fiber.MethodGet, auth: AuthMethodCookie, status: fiber.StatusOK},
+		{name: "header post without token", method: fiber.MethodPost, auth: AuthMethodHeader, status: fiber.StatusOK},
+		{name: "api key post without token", method: fiber.MethodPost, auth: AuthMethodAPIKey, status: fiber.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.All("/", func(ctx *fiber.Ctx) error {
+				ctx.Locals("auth_method", tt.auth)
+				return ctx.Next()
+			}, CSRF(), func(ctx *fiber.Ctx) error {
+				return ctx.SendStatus(fiber.StatusOK)
+			})
+
+			req := httptest.NewRequest(tt.method, "/", nil)
+			req.AddCookie(&http.Cookie{Name: helper.CSRFTokenCookie, Value: csrfToken})
+			if tt.header != "" {
+				req.Header.Set(helper.CSRFTokenHeader, tt.header)
+			}
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", res.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestCSRFCookieSession(t *testing.T) {
+	databasetest.Start(t)
+
+	token, _, err := helper.GetFamilyTokens(model.TokenizedUserParams{UserId: ownerId, Role: model.RoleUser, Verified: true}, "csrf-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		cookie bool
+		header string
+		status int
+	}{
+		{name: "forged cookie request", cookie: true, status: fiber.StatusForbidden},
+		{name: "cookie request", cookie: true, header: "csrf-token", status: fiber.StatusOK},
+		{name: "bearer request", status: fiber.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Post("/", Authenticate(AuthConfig{AllowCookie: true}), CSRF(), func(ctx *fiber.Ctx) error {
+				return ctx.SendStatus(fiber.StatusOK)
+			})
+
+			req := httptest.NewRequest(fiber.MethodPost, "/", nil)
+			if tt.cookie {
+				req.AddCookie(&http.Cookie{Name: helper.AccessTokenCookie, Value: token})
+				req.AddCookie(&http.Cookie{Name: helper.CSRFTokenCookie, Value: "csrf-token"})
+			} else {
+				req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+			}
+			if tt.header != "" {
+				req.Header.Set(helper.CSRFTokenHeader, tt.header)
+			}
+			res, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", res.StatusCode, tt.status)
+			}
+		})
+	}
+}
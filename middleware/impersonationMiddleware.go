@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/braswelljr/axxxe/helper"
+)
+
+// DefaultImpersonationBlockedRoutes - sensitive routes that can not be used
+// while impersonating a user
+var DefaultImpersonationBlockedRoutes = []string{
+	"PATCH /api/v1/users/:user_id/update-password",
+	"POST /api/v1/users/:user_id/email",
+	"POST /api/v1/users/:user_id/impersonate",
+	"GET /api/v1/users/:user_id/export",
+	"* /api/v1/users/:user_id/deletion",
+	"POST /api/v1/users/logout-all",
+	"POST /api/v1/users/invitations",
+	"* /api/v1/users/2fa/*",
+	"* /api/v1/users/sessions/*",
+	"* /api/v1/api-keys/*",
+	"* /api/v1/audit/*",
+}
+
+// ImpersonationPolicy - controls which routes can not be used while impersonating a user
+type ImpersonationPolicy struct {
+	// BlockedRoutes - routes as `METHOD /path`, matched like the routes of a VerificationPolicy
+	BlockedRoutes []string
+}
+
+// Blocks - checks if the policy blocks a route while impersonating
+func (p ImpersonationPolicy) Blocks(method, path string) bool {
+	return matchRoutes(p.BlockedRoutes, method, path)
+}
+
+// BlockImpersonation is a middleware that stops impersonated requests to the
+// routes blocked by the policy, e.g. password and email changes. Without a
+// policy the routes are read from `IMPERSONATION_BLOCKED_ROUTES` (comma separated).
+// It must be used after Authenticate.
+func BlockImpersonation(policy ...ImpersonationPolicy) fiber.Handler {
+	config := ImpersonationPolicy{}
+	if len(policy) > 0 {
+		config = policy[0]
+	} else {
+		config.BlockedRoutes = helper.GetEnvList("IMPERSONATION_BLOCKED_ROUTES", DefaultImpersonationBlockedRoutes)
+	}
+
+	return func(ctx *fiber.Ctx) error {
+		if !helper.IsImpersonating(ctx) || !config.Blocks(ctx.Method(), ctx.Path()) {
+			return ctx.Next()
+		}
+
+		return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "This action is not allowed while impersonating a user",
+			"status":  fiber.StatusForbidden,
+		})
+	}
+}
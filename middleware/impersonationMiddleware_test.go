@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/braswelljr/axxxe/model"
+)
+
+func TestBlockImpersonation(t *testing.T) {
+	impersonator := &model.Impersonator{UserId: otherId, Role: model.RoleAdmin}
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		impersonator *model.Impersonator
+		status       int
+	}{
+		{name: "profile", method: fiber.MethodGet, path: "/api/v1/users/" + ownerId, impersonator: impersonator, status: fiber.StatusOK},
+		{name: "profile update", method: fiber.MethodPatch, path: "/api/v1/users/" + ownerId, impersonator: impersonator, status: fiber.StatusOK},
+		{name: "password", method: fiber.MethodPatch, path: "/api/v1/users/" + ownerId + "/update-password", impersonator: impersonator, status: fiber.StatusForbidden},
+		{name: "email", method: fiber.MethodPost, path: "/api/v1/users/" + ownerId + "/email", impersonator: impersonator, status: fiber.StatusForbidden},
+		{name: "deletion", method: fiber.MethodDelete, path: "/api/v1/users/" + ownerId + "/deletion", impersonator: impersonator, status: fiber.StatusForbidden},
+		{name: "two-factor", method: fiber.MethodPost, path: "/api/v1/users/2fa/disable", impersonator: impersonator, status: fiber.StatusForbidden},
+		{name: "sessions", method: fiber.MethodDelete, path: "/api/v1/users/sessions/abc", impersonator: impersonator, status: fiber.StatusForbidden},
+		{name: "api keys", method: fiber.MethodPost, path: "/api/v1/api-keys", impersonator: impersonator, status: fiber.StatusForbidden},
+		{name: "password without impersonation", method: fiber.MethodPatch, path: "/api/v1/users/" + ownerId + "/update-password", status: fiber.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.All("/*", func(ctx *fiber.Ctx) error {
+				ctx.Locals("user_id", ownerId)
+				if tt.impersonator != nil {
+					ctx.Locals("impersonator", tt.impersonator)
+				}
+				return ctx.Next()
+			}, BlockImpersonation(ImpersonationPolicy{BlockedRoutes: DefaultImpersonationBlockedRoutes}), func(ctx *fiber.Ctx) error {
+				return ctx.SendStatus(fiber.StatusOK)
+			})
+
+			res, err := app.Test(httptest.NewRequest(tt.method, tt.path, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", res.StatusCode, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/braswelljr/axxxe/helper"
+)
+
+// RequirePermission is a middleware that only lets users whose role has every
+// permission through. It must be used after Authenticate.
+func RequirePermission(permissions ...string) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		for _, permission := range permissions {
+			if !helper.Can(ctx, permission) {
+				return forbidden(ctx)
+			}
+		}
+
+		return ctx.Next()
+	}
+}
+
+// RequireOwner is a middleware that only lets the user identified by the route
+// param through. It must be used after Authenticate.
+func RequireOwner(param string) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if !helper.IsOwner(ctx, ctx.Params(param)) {
+			return forbidden(ctx)
+		}
+
+		return ctx.Next()
+	}
+}
+
+// RequireOwnerOrPermission is a middleware that lets the user identified by the
+// route param, or users whose role has the permission, through.
+// It must be used after Authenticate.
+func RequireOwnerOrPermission(param, permission string) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if !helper.IsOwner(ctx, ctx.Params(param)) && !helper.Can(ctx, permission) {
+			return forbidden(ctx)
+		}
+
+		return ctx.Next()
+	}
+}
+
+// RequireUser is a middleware that refuses requests made with api keys, for
+// routes acting on the session or the account of the caller, which keys do not
+// have. It must be used after Authenticate.
+func RequireUser() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if helper.IsAPIKey(ctx) || helper.CurrentUserId(ctx) == "" {
+			return forbidden(ctx)
+		}
+
+		return ctx.Next()
+	}
+}
+
+// forbidden - responds that the user is not allowed to access the resource
+func forbidden(ctx *fiber.Ctx) error {
+	return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"message": "Unauthorised to access this resource",
+		"status":  fiber.StatusForbidden,
+	})
+}
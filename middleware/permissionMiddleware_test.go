@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/braswelljr/axxxe/model"
+)
+
+const (
+	ownerId = "637f1b2c9a1e4b3d2c1a0f9e"
+	otherId = "637f1b2c9a1e4b3d2c1a0f9f"
+)
+
+var (
+	other  = map[string]interface{}{"user_id": otherId, "role": model.RoleUser}
+	apiKey = map[string]interface{}{"api_key_id": "637f1b2c9a1e4b3d2c1a0fa0", "permissions": []string{model.PermissionUsersRead}}
+)
+
+// testGuard - the status of a request to /users/<ownerId> guarded by a middleware
+func testGuard(t *testing.T, guard fiber.Handler, locals map[string]interface{}) int {
+	t.Helper()
+
+	app := fiber.New()
+	app.Get("/users/:user_id", func(ctx *fiber.Ctx) error {
+		for key, value := range locals {
+			ctx.Locals(key, value)
+		}
+		return ctx.Next()
+	}, guard, func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(fiber.StatusOK)
+	})
+
+	res, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/users/"+ownerId, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res.StatusCode
+}
+
+func TestRequireUser(t *testing.T) {
+	tests := []struct {
+		name   string
+		guard  fiber.Handler
+		locals map[string]interface{}
+		status int
+	}{
+		{name: "user", guard: RequireUser(), locals: other, status: fiber.StatusOK},
+		{name: "user with key", guard: RequireUser(), locals: apiKey, status: fiber.StatusForbidden},
+		{name: "user anonymous", guard: RequireUser(), status: fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := testGuard(t, tt.guard, tt.locals); status != tt.status {
+				t.Errorf("status = %d, want %d", status, tt.status)
+			}
+		})
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	tests := []struct {
+		name   string
+		locals map[string]interface{}
+		status int
+	}{
+		{name: "admin", locals: map[string]interface{}{"user_id": otherId, "role": model.RoleAdmin}, status: fiber.StatusOK},
+		{name: "support", locals: map[string]interface{}{"user_id": otherId, "role": model.RoleSupport}, status: fiber.StatusOK},
+		{name: "merchant", locals: map[string]interface{}{"user_id": otherId, "role": model.RoleMerchant}, status: fiber.StatusForbidden},
+		{name: "user", locals: other, status: fiber.StatusForbidden},
+		{name: "unknown role", locals: map[string]interface{}{"user_id": otherId, "role": "ROOT"}, status: fiber.StatusForbidden},
+		{name: "anonymous", status: fiber.StatusForbidden},
+		{name: "scoped key", locals: apiKey, status: fiber.StatusOK},
+		{name: "unscoped key", locals: map[string]interface{}{"api_key_id": "637f1b2c9a1e4b3d2c1a0fa0", "role": model.RoleAdmin, "permissions": []string{}}, status: fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := testGuard(t, RequirePermission(model.PermissionUsersRead), tt.locals); status != tt.status {
+				t.Errorf("status = %d, want %d", status, tt.status)
+			}
+		})
+	}
+}
+
+func TestRequireOwner(t *testing.T) {
+	tests := []struct {
+		name   string
+		guard  fiber.Handler
+		locals map[string]interface{}
+		status int
+	}{
+		{name: "owner", guard: RequireOwner("user_id"), locals: map[string]interface{}{"user_id": ownerId, "role": model.RoleUser}, status: fiber.StatusOK},
+		{name: "other user", guard: RequireOwner("user_id"), locals: other, status: fiber.StatusForbidden},
+		{name: "admin", guard: RequireOwner("user_id"), locals: map[string]interface{}{"user_id": otherId, "role": model.RoleAdmin}, status: fiber.StatusForbidden},
+		{name: "anonymous", guard: RequireOwner("user_id"), status: fiber.StatusForbidden},
+		{name: "owner or permission owner", guard: RequireOwnerOrPermission("user_id", model.PermissionUsersRead), locals: map[string]interface{}{"user_id": ownerId, "role": model.RoleUser}, status: fiber.StatusOK},
+		{name: "owner or permission other user", guard: RequireOwnerOrPermission("user_id", model.PermissionUsersRead), locals: other, status: fiber.StatusForbidden},
+		{name: "owner or permission support", guard: RequireOwnerOrPermission("user_id", model.PermissionUsersRead), locals: map[string]interface{}{"user_id": otherId, "role": model.RoleSupport}, status: fiber.StatusOK},
+		{name: "owner or permission support without it", guard: RequireOwnerOrPermission("user_id", model.PermissionUsersUpdate), locals: map[string]interface{}{"user_id": otherId, "role": model.RoleSupport}, status: fiber.StatusForbidden},
+		{name: "owner or permission key", guard: RequireOwnerOrPermission("user_id", model.PermissionUsersRead), locals: apiKey, status: fiber.StatusOK},
+		{name: "owner or permission anonymous", guard: RequireOwnerOrPermission("user_id", model.PermissionUsersRead), status: fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := testGuard(t, tt.guard, tt.locals); status != tt.status {
+				t.Errorf("status = %d, want %d", status, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/braswelljr/axxxe/helper"
+)
+
+// DefaultUnverifiedRoutes - routes users can use before verifying their email
+var DefaultUnverifiedRoutes = []string{
+	"GET /api/v1/users/:user_id",
+	"POST /api/v1/users/logout",
+	"POST /api/v1/users/logout-all",
+	"POST /api/v1/users/verify-email/resend",
+	"GET /api/v1/products",
+	"GET /api/v1/products/:product_id",
+}
+
+// DefaultUnverifiedBlockedRoutes - routes users can not use before verifying
+// their email although an allowed route matches them, `/users/sessions` is
+// matched by `/users/:user_id`
+var DefaultUnverifiedBlockedRoutes = []string{
+	"* /api/v1/users/sessions",
+}
+
+// VerificationPolicy - controls which routes users with unverified emails may use
+type VerificationPolicy struct {
+	// AllowedRoutes - routes as `METHOD /path`, path segments starting with `:`
+	// match any value and a trailing `*` matches the rest of the path.
+	// The method can be `*` to match any method.
+	AllowedRoutes []string
+	// BlockedRoutes - routes refused even when they match AllowedRoutes, in the
+	// same format
+	BlockedRoutes []string
+}
+
+// Allows - checks if the policy allows unverified users to use a route
+func (p VerificationPolicy) Allows(method, path string) bool {
+	return !matchRoutes(p.BlockedRoutes, method, path) && matchRoutes(p.AllowedRoutes, method, path)
+}
+
+// RequireVerified is a middleware that only lets users with verified emails
+// through, except on the routes allowed by the policy. Without a policy the
+// routes are read from `UNVERIFIED_ALLOWED_ROUTES` and `UNVERIFIED_BLOCKED_ROUTES`
+// (comma separated).
+// It must be used after Authenticate.
+func RequireVerified(policy ...VerificationPolicy) fiber.Handler {
+	config := VerificationPolicy{}
+	if len(policy) > 0 {
+		config = policy[0]
+	} else {
+		config.AllowedRoutes = helper.GetEnvList("UNVERIFIED_ALLOWED_ROUTES", DefaultUnverifiedRoutes)
+		config.BlockedRoutes = helper.GetEnvList("UNVERIFIED_BLOCKED_ROUTES", DefaultUnverifiedBlockedRoutes)
+	}
+
+	return func(ctx *fiber.Ctx) error {
+		if verified, _ := ctx.Locals("verified").(bool); verified {
+			return ctx.Next()
+		}
+
+		if config.Allows(ctx.Method(), ctx.Path()) {
+			return ctx.Next()
+		}
+
+		return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "Please verify your email to access this resource",
+			"status":  fiber.StatusForbidden,
+		})
+	}
+}
+
+// matchRoutes - checks if a request matches any of the routes, given as
+// `METHOD /path` like the routes of a VerificationPolicy
+func matchRoutes(routes []string, method, path string) bool {
+	for _, route := range routes {
+		routeMethod, routePath, found := strings.Cut(route, " ")
+		if !found {
+			continue
+		}
+
+		if (routeMethod == "*" || strings.EqualFold(routeMethod, method)) && matchPath(strings.TrimSpace(routePath), path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchPath - matches a path against a route pattern
+func matchPath(pattern, path string) bool {
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+
+	for i, segment := range patternSegments {
+		// match the rest of the path
+		if segment == "*" {
+			return true
+		}
+
+		if i >= len(pathSegments) {
+			return false
+		}
+
+		if !strings.HasPrefix(segment, ":") && segment != pathSegments[i] {
+			return false
+		}
+	}
+
+	return len(patternSegments) == len(pathSegments)
+}
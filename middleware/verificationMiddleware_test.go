@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestVerificationPolicy(t *testing.T) {
+	policy := VerificationPolicy{AllowedRoutes: DefaultUnverifiedRoutes, BlockedRoutes: DefaultUnverifiedBlockedRoutes}
+
+	tests := []struct {
+		method string
+		path   string
+		want   bool
+	}{
+		{method: fiber.MethodGet, path: "/api/v1/users/637f1b2c9a1e4b3d2c1a0f9e", want: true},
+		{method: fiber.MethodGet, path: "/api/v1/users/637f1b2c9a1e4b3d2c1a0f9e/", want: true},
+		{method: fiber.MethodPost, path: "/api/v1/users/logout", want: true},
+		{method: fiber.MethodPost, path: "/api/v1/users/verify-email/resend", want: true},
+		{method: fiber.MethodGet, path: "/api/v1/products/42", want: true},
+		{method: fiber.MethodGet, path: "/api/v1/users/sessions"},
+		{method: fiber.MethodDelete, path: "/api/v1/users/sessions"},
+		{method: fiber.MethodPatch, path: "/api/v1/users/637f1b2c9a1e4b3d2c1a0f9e"},
+		{method: fiber.MethodGet, path: "/api/v1/users/637f1b2c9a1e4b3d2c1a0f9e/addresses"},
+		{method: fiber.MethodGet, path: "/api/v1/users"},
+	}
+
+	for _, tt := range tests {
+		if got := policy.Allows(tt.method, tt.path); got != tt.want {
+			t.Errorf("Allows(%s %s) = %v, want %v", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{pattern: "/api/v1/users/:user_id", path: "/api/v1/users/1", want: true},
+		{pattern: "/api/v1/users/:user_id", path: "/api/v1/users/1/email"},
+		{pattern: "/api/v1/users/:user_id", path: "/api/v1/users"},
+		{pattern: "/api/v1/users/*", path: "/api/v1/users/1/email", want: true},
+		{pattern: "/api/v1/products", path: "/api/v1/products", want: true},
+		{pattern: "/api/v1/products", path: "/api/v1/orders"},
+	}
+
+	for _, tt := range tests {
+		if got := matchPath(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchPath(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRequireVerified(t *testing.T) {
+	tests := []struct {
+		name     string
+		verified bool
+		method   string
+		path     string
+		status   int
+	}{
+		{name: "verified", verified: true, method: fiber.MethodGet, path: "/api/v1/users/sessions", status: fiber.StatusOK},
+		{name: "allowed", method: fiber.MethodGet, path: "/api/v1/users/1", status: fiber.StatusOK},
+		{name: "sessions", method: fiber.MethodGet, path: "/api/v1/users/sessions", status: fiber.StatusForbidden},
+		{name: "not allowed", method: fiber.MethodPatch, path: "/api/v1/users/1", status: fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Use(func(ctx *fiber.Ctx) error {
+				ctx.Locals("verified", tt.verified)
+				return ctx.Next()
+			}, RequireVerified(VerificationPolicy{AllowedRoutes: DefaultUnverifiedRoutes, BlockedRoutes: DefaultUnverifiedBlockedRoutes}))
+			app.All("/*", func(ctx *fiber.Ctx) error {
+				return ctx.SendStatus(fiber.StatusOK)
+			})
+
+			res, err := app.Test(httptest.NewRequest(tt.method, tt.path, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", res.StatusCode, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package model
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Address - a postal address of a user, used for shipping and billing
+type Address struct {
+	Id     primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserId string             `json:"user_id" bson:"user_id"`
+	// Label - name the user gives the address, e.g. `Home`
+	Label      string `json:"label" bson:"label"`
+	Name       string `json:"name" bson:"name"`
+	Line1      string `json:"line1" bson:"line1"`
+	Line2      string `json:"line2,omitempty" bson:"line2,omitempty"`
+	City       string `json:"city" bson:"city"`
+	Region     string `json:"region,omitempty" bson:"region,omitempty"`
+	PostalCode string `json:"postal_code,omitempty" bson:"postal_code,omitempty"`
+	// Country - ISO 3166-1 alpha-2 code of the country, e.g. `GH`
+	Country         string             `json:"country" bson:"country"`
+	Phone           string             `json:"phone,omitempty" bson:"phone,omitempty"`
+	DefaultShipping bool               `json:"default_shipping" bson:"default_shipping"`
+	DefaultBilling  bool               `json:"default_billing" bson:"default_billing"`
+	CreatedAt       primitive.DateTime `json:"created_at" bson:"created_at"`
+	UpdatedAt       primitive.DateTime `json:"updated_at" bson:"updated_at"`
+}
+
+// AddressParams - fields of a new or replaced address, normalized and checked
+// against the rules of its country by the address package
+type AddressParams struct {
+	Label           string `json:"label" validate:"max=50"`
+	Name            string `json:"name" validate:"required,max=100"`
+	Line1           string `json:"line1" validate:"required,max=200"`
+	Line2           string `json:"line2" validate:"max=200"`
+	City            string `json:"city" validate:"required,max=100"`
+	Region          string `json:"region" validate:"max=100"`
+	PostalCode      string `json:"postal_code" validate:"max=20"`
+	Country         string `json:"country" validate:"required,iso3166_1_alpha2"`
+	Phone           string `json:"phone" validate:"max=30"`
+	DefaultShipping bool   `json:"default_shipping"`
+	DefaultBilling  bool   `json:"default_billing"`
+}
@@ -0,0 +1,26 @@
+package model
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// APIKey - a key used by services to call the api, only the hash of the secret is stored
+type APIKey struct {
+	Id   primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name string             `json:"name" bson:"name"`
+	// Prefix - public part of the key identifying it, e.g. `axk_1a2b3c4d`
+	Prefix     string             `json:"prefix" bson:"prefix"`
+	Hash       string             `json:"-" bson:"hash"`
+	Scopes     []string           `json:"scopes" bson:"scopes"`
+	CreatedBy  string             `json:"created_by" bson:"created_by"`
+	CreatedAt  primitive.DateTime `json:"created_at" bson:"created_at"`
+	ExpiresAt  primitive.DateTime `json:"expires_at" bson:"expires_at"`
+	LastUsedAt primitive.DateTime `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+	RevokedAt  primitive.DateTime `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
+
+// APIKeyParams - params of a new api key
+type APIKeyParams struct {
+	Name   string   `json:"name" validate:"required,max=100"`
+	Scopes []string `json:"scopes" validate:"required,min=1,dive,required"`
+	// ExpiresInDays - days until the key expires
+	ExpiresInDays int `json:"expires_in_days" validate:"omitempty,min=1,max=730"`
+}
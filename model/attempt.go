@@ -0,0 +1,12 @@
+package model
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// LoginAttempts - failed login attempts of an account or an ip address
+type LoginAttempts struct {
+	Key           string             `json:"key" bson:"key"`
+	Failures      int                `json:"failures" bson:"failures"`
+	LastFailureAt primitive.DateTime `json:"last_failure_at" bson:"last_failure_at"`
+	LockedUntil   primitive.DateTime `json:"locked_until,omitempty" bson:"locked_until,omitempty"`
+	ExpiresAt     primitive.DateTime `json:"expires_at" bson:"expires_at"`
+}
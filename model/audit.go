@@ -0,0 +1,83 @@
+package model
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// audit log actions
+const (
+	// AuditSignup - a user signed up
+	AuditSignup = "user.signup"
+	// AuditLoginSucceeded - a user logged in, with any login method
+	AuditLoginSucceeded = "login.success"
+	// AuditLoginFailed - a login failed, the reason is in the details
+	AuditLoginFailed = "login.failure"
+	// AuditLogout - a user logged out of a session
+	AuditLogout = "logout"
+	// AuditLogoutAll - a user logged out of every session
+	AuditLogoutAll = "logout.all"
+	// AuditSessionRevoked - a user revoked one or more of their sessions
+	AuditSessionRevoked = "session.revoke"
+	// AuditTokenRefreshed - a refresh token was exchanged for new tokens
+	AuditTokenRefreshed = "token.refresh"
+	// AuditTokenReused - an already used refresh token was presented, its session was revoked
+	AuditTokenReused = "token.reuse"
+	// AuditPasswordChanged - a user changed their password
+	AuditPasswordChanged = "password.change"
+	// AuditPasswordReset - a user reset their password with a reset link
+	AuditPasswordReset = "password.reset"
+	// AuditEmailChangeRequested - a user asked to change their email
+	AuditEmailChangeRequested = "email.change_request"
+	// AuditEmailChanged - a user confirmed the change of their email from the new address
+	AuditEmailChanged = "email.change"
+	// AuditEmailReverted - a changed email was reverted from the previous address
+	AuditEmailReverted = "email.revert"
+	// AuditTwoFactorEnabled - a user enabled two-factor authentication
+	AuditTwoFactorEnabled = "two_factor.enable"
+	// AuditTwoFactorDisabled - a user disabled two-factor authentication
+	AuditTwoFactorDisabled = "two_factor.disable"
+	// AuditUserUpdated - a user was updated by someone else
+	AuditUserUpdated = "user.update"
+	// AuditRoleChanged - the role of a user changed
+	AuditRoleChanged = "user.role_change"
+	// AuditUserUnlocked - a user locked out after failed logins was unlocked
+	AuditUserUnlocked = "user.unlock"
+	// AuditInvitationSent - someone was invited to create an account
+	AuditInvitationSent = "invitation.send"
+	// AuditInvitationAccepted - an account was created from an invitation
+	AuditInvitationAccepted = "invitation.accept"
+	// AuditAPIKeyCreated - an api key was created
+	AuditAPIKeyCreated = "api_key.create"
+	// AuditAPIKeyRevoked - an api key was revoked
+	AuditAPIKeyRevoked = "api_key.revoke"
+	// AuditLogExport - the audit log was exported
+	AuditLogExport = "audit.export"
+	// AuditImpersonationStart - a user started impersonating another user
+	AuditImpersonationStart = "impersonation.start"
+	// AuditImpersonatedRequest - a request made while impersonating a user
+	AuditImpersonatedRequest = "impersonation.request"
+	// AuditDataExport - a user exported their personal data
+	AuditDataExport = "user.export"
+	// AuditDeletionScheduled - a user asked for their account to be deleted
+	AuditDeletionScheduled = "user.deletion_scheduled"
+	// AuditDeletionCancelled - a user cancelled the deletion of their account
+	AuditDeletionCancelled = "user.deletion_cancelled"
+	// AuditUserDeleted - an account was deleted at the end of its grace period
+	AuditUserDeleted = "user.deleted"
+)
+
+// AuditEntry - an entry of the audit log
+type AuditEntry struct {
+	Id     primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Action string             `json:"action" bson:"action"`
+	// ActorId - the user who really acted, the impersonator of impersonated requests
+	ActorId string `json:"actor_id" bson:"actor_id"`
+	// UserId - the user acted upon or on behalf of
+	UserId    string             `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	SessionId string             `json:"session_id,omitempty" bson:"session_id,omitempty"`
+	Method    string             `json:"method,omitempty" bson:"method,omitempty"`
+	Path      string             `json:"path,omitempty" bson:"path,omitempty"`
+	Status    int                `json:"status,omitempty" bson:"status,omitempty"`
+	IP        string             `json:"ip,omitempty" bson:"ip,omitempty"`
+	UserAgent string             `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	Details   map[string]string  `json:"details,omitempty" bson:"details,omitempty"`
+	CreatedAt primitive.DateTime `json:"created_at" bson:"created_at"`
+}
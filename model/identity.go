@@ -0,0 +1,22 @@
+package model
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Identity - an account of an external identity provider linked to a user
+type Identity struct {
+	Provider string             `json:"provider" bson:"provider"`
+	Subject  string             `json:"subject" bson:"subject"`
+	Email    string             `json:"email,omitempty" bson:"email,omitempty"`
+	LinkedAt primitive.DateTime `json:"linked_at" bson:"linked_at"`
+}
+
+// AuthorizationState - an OpenID Connect login in progress, only the hash of
+// the state is stored
+type AuthorizationState struct {
+	Hash         string             `json:"-" bson:"hash"`
+	Provider     string             `json:"provider" bson:"provider"`
+	Nonce        string             `json:"-" bson:"nonce"`
+	CodeVerifier string             `json:"-" bson:"code_verifier"`
+	CreatedAt    primitive.DateTime `json:"created_at" bson:"created_at"`
+	ExpiresAt    primitive.DateTime `json:"expires_at" bson:"expires_at"`
+}
@@ -0,0 +1,16 @@
+package model
+
+// Impersonator - the user acting as another user with an impersonation token
+type Impersonator struct {
+	UserId string `json:"user_id"`
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+	// SessionId - session the impersonation was started from, revoking it ends the impersonation
+	SessionId string `json:"session_id"`
+}
+
+// ImpersonationParams - params of an impersonation
+type ImpersonationParams struct {
+	// Reason - why the user is impersonated, e.g. a support ticket, kept in the audit log
+	Reason string `json:"reason" validate:"max=500"`
+}
@@ -0,0 +1,33 @@
+package model
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Invitation - an invitation to create an account with a role
+type Invitation struct {
+	Id         primitive.ObjectID `json:"id" bson:"_id"`
+	Email      string             `json:"email" bson:"email"`
+	Role       string             `json:"role" bson:"role"`
+	InvitedBy  string             `json:"invited_by" bson:"invited_by"`
+	CreatedAt  primitive.DateTime `json:"created_at" bson:"created_at"`
+	ExpiresAt  primitive.DateTime `json:"expires_at" bson:"expires_at"`
+	AcceptedAt primitive.DateTime `json:"accepted_at,omitempty" bson:"accepted_at,omitempty"`
+	RevokedAt  primitive.DateTime `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+	UserId     string             `json:"user_id,omitempty" bson:"user_id,omitempty"`
+}
+
+// InvitationParams - email and role of the person to invite
+type InvitationParams struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"required,oneof=ADMIN USER SUPPORT MERCHANT"`
+}
+
+// AcceptInvitationParams - invitation token and details of the account to create
+type AcceptInvitationParams struct {
+	Token     string `json:"token" validate:"required"`
+	Username  string `json:"username" validate:"required"`
+	Password  string `json:"password" validate:"required"`
+	Firstname string `json:"firstname,omitempty"`
+	Lastname  string `json:"lastname,omitempty"`
+	Phone     string `json:"phone" validate:"required"`
+	Gender    string `json:"gender" validate:"required,eq=FEMALE|eq=MALE"`
+}
@@ -0,0 +1,55 @@
+package model
+
+// user roles
+const (
+	RoleAdmin    = "ADMIN"
+	RoleUser     = "USER"
+	RoleSupport  = "SUPPORT"
+	RoleMerchant = "MERCHANT"
+)
+
+// permissions granted to roles
+const (
+	// PermissionAll - every permission
+	PermissionAll = "*"
+	// PermissionUsersList - list every user
+	PermissionUsersList = "users:list"
+	// PermissionUsersRead - read any user
+	PermissionUsersRead = "users:read"
+	// PermissionUsersUpdate - update any user
+	PermissionUsersUpdate = "users:update"
+	// PermissionUsersUnlock - unlock users locked out after failed logins
+	PermissionUsersUnlock = "users:unlock"
+	// PermissionUsersInvite - invite people to create an account with a role
+	PermissionUsersInvite = "users:invite"
+	// PermissionUsersImpersonate - act as other users with a short lived token
+	PermissionUsersImpersonate = "users:impersonate"
+	// PermissionUsersManageRoles - change the role of users
+	PermissionUsersManageRoles = "users:manage-roles"
+	// PermissionProductsWrite - create and update products
+	PermissionProductsWrite = "products:write"
+	// PermissionOrdersRead - read any order
+	PermissionOrdersRead = "orders:read"
+	// PermissionOrdersUpdate - update any order
+	PermissionOrdersUpdate = "orders:update"
+	// PermissionAPIKeysManage - create, list and revoke api keys
+	PermissionAPIKeysManage = "apikeys:manage"
+	// PermissionAuditRead - query and export the audit log
+	PermissionAuditRead = "audit:read"
+)
+
+// Permissions - every permission that can be granted
+var Permissions = []string{
+	PermissionUsersList,
+	PermissionUsersRead,
+	PermissionUsersUpdate,
+	PermissionUsersUnlock,
+	PermissionUsersInvite,
+	PermissionUsersImpersonate,
+	PermissionUsersManageRoles,
+	PermissionProductsWrite,
+	PermissionOrdersRead,
+	PermissionOrdersUpdate,
+	PermissionAPIKeysManage,
+	PermissionAuditRead,
+}
@@ -0,0 +1,20 @@
+package model
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Session - a login of a user on a device, its id is the family of its tokens.
+// Only the hash of the current refresh token is stored.
+type Session struct {
+	SessionId        string             `json:"id" bson:"session_id"`
+	UserId           string             `json:"user_id" bson:"user_id"`
+	RefreshTokenHash string             `json:"-" bson:"refresh_token_hash"`
+	DeviceName       string             `json:"device_name" bson:"device_name"`
+	IP               string             `json:"ip" bson:"ip"`
+	UserAgent        string             `json:"user_agent" bson:"user_agent"`
+	CreatedAt        primitive.DateTime `json:"created_at" bson:"created_at"`
+	LastSeenAt       primitive.DateTime `json:"last_seen_at" bson:"last_seen_at"`
+	ExpiresAt        primitive.DateTime `json:"expires_at" bson:"expires_at"`
+	RevokedAt        primitive.DateTime `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+	// Current - whether the session is the one making the request
+	Current bool `json:"current" bson:"-"`
+}
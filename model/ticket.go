@@ -0,0 +1,15 @@
+package model
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Ticket - a single-use expiring token, only the hash of the token is stored
+type Ticket struct {
+	Id        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Hash      string             `json:"-" bson:"hash"`
+	Purpose   string             `json:"purpose" bson:"purpose"`
+	UserId    string             `json:"user_id" bson:"user_id"`
+	Data      map[string]string  `json:"data,omitempty" bson:"data,omitempty"`
+	CreatedAt primitive.DateTime `json:"created_at" bson:"created_at"`
+	ExpiresAt primitive.DateTime `json:"expires_at" bson:"expires_at"`
+	UsedAt    primitive.DateTime `json:"used_at,omitempty" bson:"used_at,omitempty"`
+}
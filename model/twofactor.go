@@ -0,0 +1,36 @@
+package model
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// TwoFactor - TOTP two-factor authentication settings of a user
+type TwoFactor struct {
+	Enabled bool `json:"enabled" bson:"enabled"`
+	// Secret - base32 TOTP secret in use
+	Secret string `json:"-" bson:"secret,omitempty"`
+	// PendingSecret - secret generated on enrollment waiting for a confirmation code
+	PendingSecret string `json:"-" bson:"pending_secret,omitempty"`
+	// RecoveryCodes - hashes of the unused recovery codes
+	RecoveryCodes []string `json:"-" bson:"recovery_codes,omitempty"`
+	// LastStep - time step of the last accepted code, codes can not be reused
+	LastStep  int64              `json:"-" bson:"last_step,omitempty"`
+	EnabledAt primitive.DateTime `json:"enabled_at,omitempty" bson:"enabled_at,omitempty"`
+}
+
+// TwoFactorCodeParams - a TOTP code
+type TwoFactorCodeParams struct {
+	Code string `json:"code" validate:"required,numeric,len=6"`
+}
+
+// TwoFactorDisableParams - password and TOTP code of a user disabling two-factor authentication
+type TwoFactorDisableParams struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required,numeric,len=6"`
+}
+
+// TwoFactorChallengeParams - the challenge token of a login and the code completing it,
+// a recovery code can be used instead of a TOTP code
+type TwoFactorChallengeParams struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required_without=RecoveryCode,omitempty,numeric,len=6"`
+	RecoveryCode   string `json:"recovery_code" validate:"required_without=Code"`
+}
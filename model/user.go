@@ -6,21 +6,60 @@ import (
 
 // User - for user params
 type User struct {
-	Id           primitive.ObjectID `json:"id" bson:"id"`
-	Username     string             `json:"username" bson:"username" validate:"required" minlength:"3"`
-	Firstname    string             `json:"firstname,omitempty" bson:"firstname,omitempty"`
-	Lastname     string             `json:"lastname,omitempty" bson:"lastname,omitempty"`
-	Email        string             `json:"email" bson:"email" validate:"required,email"`
-	Password     string             `json:"password" bson:"password" validate:"required" min:"8"`
-	Phone        string             `json:"phone,omitempty" bson:"phone,omitempty" validate:"required"`
-	Gender       string             `json:"gender,omitempty" bson:"gender" validate:"required,eq=FEMALE|eq=MALE"`
-	LastLogin    primitive.DateTime `json:"last_login" bson:"last_login"`
-	CreatedAt    primitive.DateTime `json:"created_at" bson:"created_at"`
-	UpdatedAt    primitive.DateTime `json:"updated_at" bson:"updated_at"`
-	Token        string             `json:"token" bson:"token"`
-	RefreshToken string             `json:"refresh_token" bson:"refresh_token"`
-	Role         string             `json:"role" bson:"role" validate:"required,eq=ADMIN|eq=USER"`
-	UserId       string             `json:"user_id" bson:"user_id"`
+	Id         primitive.ObjectID `json:"id" bson:"id"`
+	Username   string             `json:"username" bson:"username" validate:"required" minlength:"3"`
+	Firstname  string             `json:"firstname,omitempty" bson:"firstname,omitempty"`
+	Lastname   string             `json:"lastname,omitempty" bson:"lastname,omitempty"`
+	Email      string             `json:"email" bson:"email" validate:"required,email"`
+	Password   string             `json:"-" bson:"password" validate:"required"`
+	Phone      string             `json:"phone,omitempty" bson:"phone,omitempty" validate:"required"`
+	Gender     string             `json:"gender,omitempty" bson:"gender" validate:"required,eq=FEMALE|eq=MALE"`
+	LastLogin  primitive.DateTime `json:"last_login" bson:"last_login"`
+	CreatedAt  primitive.DateTime `json:"created_at" bson:"created_at"`
+	UpdatedAt  primitive.DateTime `json:"updated_at" bson:"updated_at"`
+	Role       string             `json:"role" bson:"role" validate:"required,oneof=ADMIN USER SUPPORT MERCHANT"`
+	UserId     string             `json:"user_id" bson:"user_id"`
+	Status     string             `json:"status,omitempty" bson:"status,omitempty"`
+	VerifiedAt primitive.DateTime `json:"verified_at,omitempty" bson:"verified_at,omitempty"`
+	// VerificationSentAt - when the last verification email was sent
+	VerificationSentAt primitive.DateTime `json:"-" bson:"verification_sent_at,omitempty"`
+	TwoFactor          TwoFactor          `json:"two_factor" bson:"two_factor,omitempty"`
+	// PasswordHistory - hashes of the previous passwords, newest first
+	PasswordHistory []string `json:"-" bson:"password_history,omitempty"`
+	// Identities - accounts of identity providers the user can login with
+	Identities []Identity `json:"identities,omitempty" bson:"identities,omitempty"`
+	// Avatar - version of the profile image, empty without one
+	Avatar string `json:"avatar,omitempty" bson:"avatar,omitempty"`
+	// DeletionScheduledAt - when the account will be deleted, the user can cancel until then
+	DeletionScheduledAt primitive.DateTime `json:"deletion_scheduled_at,omitempty" bson:"deletion_scheduled_at,omitempty"`
+	DeletedAt           primitive.DateTime `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+}
+
+// user statuses
+const (
+	// UserStatusUnverified - the user has not verified their email yet
+	UserStatusUnverified = "UNVERIFIED"
+	// UserStatusActive - the user has verified their email
+	UserStatusActive = "ACTIVE"
+	// UserStatusDeleted - the account has been deleted and its personal data anonymized
+	UserStatusDeleted = "DELETED"
+)
+
+// IsVerified - checks if the user has verified their email.
+// Users created before email verification have no status and are verified.
+func (u *User) IsVerified() bool {
+	return u.Status != UserStatusUnverified
+}
+
+// SignupParams - details of a new user
+type SignupParams struct {
+	Username  string `json:"username" validate:"required"`
+	Firstname string `json:"firstname"`
+	Lastname  string `json:"lastname"`
+	Email     string `json:"email" validate:"required,email"`
+	Password  string `json:"password" validate:"required"`
+	Phone     string `json:"phone" validate:"required"`
+	Gender    string `json:"gender" validate:"required,eq=FEMALE|eq=MALE"`
 }
 
 // LoginDetails - email and password for user login
@@ -39,10 +78,50 @@ type TokenizedUserParams struct {
 	Gender    string
 	Role      string
 	UserId    string
+	Verified  bool
 }
 
 // PasswordUpdateParams - password update params
 type PasswordUpdateParams struct {
 	OldPassword string `json:"old_password" validate:"required"`
-	NewPassword string `json:"new_password" bson:"password" validate:"required" min:"8"`
+	NewPassword string `json:"new_password" bson:"password" validate:"required"`
+}
+
+// ForgotPasswordParams - email of the user requesting a password reset
+type ForgotPasswordParams struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// PasswordResetParams - password reset token and the new password
+type PasswordResetParams struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" bson:"password" validate:"required"`
+}
+
+// DeletionParams - password of a user asking for their account to be deleted,
+// users without a password only need to be logged in
+type DeletionParams struct {
+	Password string `json:"password"`
+}
+
+// EmailChangeParams - new email of a user and their password, required when the
+// user has one
+type EmailChangeParams struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password"`
+}
+
+// EmailChangeTokenParams - token of an email change or revert link
+type EmailChangeTokenParams struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// MagicLinkParams - email of the user requesting a sign-in link
+type MagicLinkParams struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// MagicLinkLoginParams - token of a sign-in link
+type MagicLinkLoginParams struct {
+	Token string `json:"token" validate:"required"`
 }
@@ -0,0 +1,225 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/braswelljr/axxxe/database"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/model"
+)
+
+var (
+	collection = database.OpenCollection(database.Client, "authorization_states")
+
+	ErrInvalidState   = errors.New("invalid or expired login state")
+	ErrInvalidIDToken = errors.New("invalid id token")
+)
+
+func init() {
+	database.CreateIndexes(collection,
+		mongo.IndexModel{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		mongo.IndexModel{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	)
+}
+
+// Claims - the claims of an ID token
+type Claims struct {
+	Email             string `json:"email"`
+	EmailVerified     Bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	GivenName         string `json:"given_name"`
+	FamilyName        string `json:"family_name"`
+	PreferredUsername string `json:"preferred_username"`
+	Nonce             string `json:"nonce"`
+	AuthorizedParty   string `json:"azp"`
+	jwt.RegisteredClaims
+}
+
+// Bool - a boolean claim, some providers send booleans as strings
+type Bool bool
+
+// UnmarshalJSON - decodes `true` and `"true"`
+func (b *Bool) UnmarshalJSON(data []byte) error {
+	*b = Bool(strings.Trim(string(data), `"`) == "true")
+	return nil
+}
+
+// StateTTL - how long a login can take, set with `OIDC_STATE_TTL`
+func StateTTL() time.Duration {
+	return helper.GetEnvDuration("OIDC_STATE_TTL", 10*time.Minute)
+}
+
+// Begin - starts a login with the provider and returns the authorization URL the
+// user must be redirected to along with the state of the login
+func Begin(ctx context.Context, provider *Provider) (string, string, error) {
+	if err := provider.discover(ctx); err != nil {
+		return "", "", err
+	}
+
+	// state, nonce and PKCE code verifier
+	state, err := helper.RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := helper.RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := helper.RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	now := time.Now()
+	if _, err := collection.InsertOne(ctx, &model.AuthorizationState{
+		Hash:         helper.HashToken(state),
+		Provider:     provider.Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		CreatedAt:    primitive.NewDateTimeFromTime(now),
+		ExpiresAt:    primitive.NewDateTimeFromTime(now.Add(StateTTL())),
+	}); err != nil {
+		return "", "", err
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {provider.ClientId},
+		"redirect_uri":          {provider.RedirectURL},
+		"scope":                 {strings.Join(provider.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(provider.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return provider.AuthorizationEndpoint + separator + query.Encode(), state, nil
+}
+
+// Finish - completes a login with the state and the code the provider redirected
+// back with, returns the verified claims of the ID token. A state can only be used once.
+func Finish(ctx context.Context, provider *Provider, state, code string) (*Claims, error) {
+	// redeem the state
+	authState := &model.AuthorizationState{}
+	err := collection.FindOneAndDelete(ctx, bson.M{
+		"hash":       helper.HashToken(state),
+		"provider":   provider.Name,
+		"expires_at": bson.M{"$gt": primitive.NewDateTimeFromTime(time.Now())},
+	}).Decode(authState)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrInvalidState
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := provider.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	// exchange the code
+	idToken, err := provider.exchange(ctx, code, authState.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+
+	return provider.verify(ctx, idToken, authState.Nonce)
+}
+
+// exchange - exchanges an authorization code for an ID token
+func (p *Provider) exchange(ctx context.Context, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"client_id":     {p.ClientId},
+		"code_verifier": {verifier},
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(p.ClientId), url.QueryEscape(p.ClientSecret))
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	var body struct {
+		IdToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return "", err
+	}
+
+	if response.StatusCode != http.StatusOK || body.IdToken == "" {
+		return "", fmt.Errorf("%s token exchange failed: %s %s", p.Name, body.Error, body.ErrorDescription)
+	}
+
+	return body.IdToken, nil
+}
+
+// verify - verifies the signature and the claims of an ID token
+func (p *Provider) verify(ctx context.Context, idToken, nonce string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(
+		idToken,
+		&Claims{},
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return p.publicKey(ctx, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidIDToken
+	}
+
+	// issued by the provider for us, for this login
+	switch {
+	case claims.Issuer != p.Issuer,
+		!claims.VerifyAudience(p.ClientId, true),
+		len(claims.Audience) > 1 && claims.AuthorizedParty != p.ClientId,
+		!claims.VerifyExpiresAt(time.Now(), true),
+		claims.Subject == "",
+		subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return nil, ErrInvalidIDToken
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,249 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/braswelljr/axxxe/oidc/oidctest"
+)
+
+const redirectURL = "http://localhost:5050/api/v1/auth/oidc/test/callback"
+
+// newProvider - a provider logging in with a mock identity provider
+func newProvider(t *testing.T, user oidctest.User) (*Provider, *oidctest.Server) {
+	t.Helper()
+
+	server, err := oidctest.NewServer("client", "secret", user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+
+	return &Provider{
+		Name:         "test",
+		Issuer:       server.Issuer,
+		ClientId:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"openid", "email", "profile"},
+	}, server
+}
+
+// authorize - follows the authorization endpoint as a browser would and returns
+// the code the provider redirects back with
+func authorize(t *testing.T, provider *Provider, nonce, verifier string) string {
+	t.Helper()
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {provider.ClientId},
+		"redirect_uri":          {provider.RedirectURL},
+		"state":                 {"state"},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	browser := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	response, err := browser.Get(provider.AuthorizationEndpoint + "?" + query.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusFound {
+		t.Fatalf("authorization status = %d, want %d", response.StatusCode, http.StatusFound)
+	}
+
+	location, err := url.Parse(response.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := location.Query().Get("state"); got != "state" {
+		t.Fatalf("redirect state = %q, want %q", got, "state")
+	}
+
+	return location.Query().Get("code")
+}
+
+// login - the secrets of a login in progress
+type login struct {
+	code     string
+	nonce    string
+	verifier string
+}
+
+func TestFlow(t *testing.T) {
+	user := oidctest.User{Subject: "subject", Email: "jane@example.com", EmailVerified: true, Name: "Jane Doe", GivenName: "Jane", FamilyName: "Doe"}
+
+	tests := []struct {
+		name string
+		// change - alters the provider or the login before the code is exchanged
+		change     func(provider *Provider, login *login)
+		exchangeOK bool
+		verifyErr  error
+	}{
+		{name: "valid login", exchangeOK: true},
+		{
+			name:   "wrong code verifier",
+			change: func(_ *Provider, l *login) { l.verifier = "another verifier" },
+		},
+		{
+			name:   "wrong client secret",
+			change: func(p *Provider, _ *login) { p.ClientSecret = "wrong" },
+		},
+		{
+			name:   "unknown code",
+			change: func(_ *Provider, l *login) { l.code = "unknown" },
+		},
+		{
+			name:   "other redirect url",
+			change: func(p *Provider, _ *login) { p.RedirectURL = "http://localhost/other" },
+		},
+		{
+			name:       "wrong nonce",
+			change:     func(_ *Provider, l *login) { l.nonce = "another nonce" },
+			exchangeOK: true,
+			verifyErr:  ErrInvalidIDToken,
+		},
+		{
+			name:   "other client id",
+			change: func(p *Provider, _ *login) { p.ClientId, p.ClientSecret = "other", "" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			provider, _ := newProvider(t, user)
+			if err := provider.discover(ctx); err != nil {
+				t.Fatalf("discover() error = %v", err)
+			}
+
+			l := &login{nonce: "nonce", verifier: "verifier"}
+			l.code = authorize(t, provider, l.nonce, l.verifier)
+			if tt.change != nil {
+				tt.change(provider, l)
+			}
+
+			idToken, err := provider.exchange(ctx, l.code, l.verifier)
+			if (err == nil) != tt.exchangeOK {
+				t.Fatalf("exchange() error = %v, want success %v", err, tt.exchangeOK)
+			}
+			if err != nil {
+				return
+			}
+
+			claims, err := provider.verify(ctx, idToken, l.nonce)
+			if !errors.Is(err, tt.verifyErr) {
+				t.Fatalf("verify() error = %v, want %v", err, tt.verifyErr)
+			}
+			if err != nil {
+				return
+			}
+			if claims.Subject != user.Subject || claims.Email != user.Email || !bool(claims.EmailVerified) ||
+				claims.Name != user.Name || claims.GivenName != user.GivenName || claims.FamilyName != user.FamilyName {
+				t.Errorf("verify() claims = %+v, want the claims of %+v", claims, user)
+			}
+		})
+	}
+}
+
+func TestCodesAreSingleUse(t *testing.T) {
+	ctx := context.Background()
+	provider, _ := newProvider(t, oidctest.User{Subject: "subject", Email: "jane@example.com", EmailVerified: true})
+	if err := provider.discover(ctx); err != nil {
+		t.Fatalf("discover() error = %v", err)
+	}
+
+	code := authorize(t, provider, "nonce", "verifier")
+	if _, err := provider.exchange(ctx, code, "verifier"); err != nil {
+		t.Fatalf("first exchange() error = %v", err)
+	}
+	if _, err := provider.exchange(ctx, code, "verifier"); err == nil {
+		t.Error("second exchange() succeeded, want an error")
+	}
+}
+
+func TestVerifyRejectsOtherProviders(t *testing.T) {
+	ctx := context.Background()
+	user := oidctest.User{Subject: "subject", Email: "jane@example.com", EmailVerified: true}
+	provider, _ := newProvider(t, user)
+	other, _ := newProvider(t, user)
+	for _, p := range []*Provider{provider, other} {
+		if err := p.discover(ctx); err != nil {
+			t.Fatalf("discover() error = %v", err)
+		}
+	}
+
+	// a token of another provider, signed with another key
+	code := authorize(t, other, "nonce", "verifier")
+	idToken, err := other.exchange(ctx, code, "verifier")
+	if err != nil {
+		t.Fatalf("exchange() error = %v", err)
+	}
+	if _, err := provider.verify(ctx, idToken, "nonce"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("verify() error = %v, want %v", err, ErrInvalidIDToken)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	tests := []struct {
+		name   string
+		issuer func(server *oidctest.Server) string
+		ok     bool
+	}{
+		{name: "issuer", issuer: func(s *oidctest.Server) string { return s.Issuer }, ok: true},
+		{name: "issuer differing from the document", issuer: func(s *oidctest.Server) string { return s.Issuer + "/" }},
+		{name: "unknown path", issuer: func(s *oidctest.Server) string { return s.Issuer + "/other" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, server := newProvider(t, oidctest.User{Subject: "subject"})
+			provider.Issuer = tt.issuer(server)
+
+			err := provider.discover(context.Background())
+			if (err == nil) != tt.ok {
+				t.Fatalf("discover() error = %v, want success %v", err, tt.ok)
+			}
+			if tt.ok && (provider.AuthorizationEndpoint != server.Issuer+"/authorize" ||
+				provider.TokenEndpoint != server.Issuer+"/token" || provider.JWKSURI != server.Issuer+"/jwks") {
+				t.Errorf("discover() endpoints = %q, %q, %q", provider.AuthorizationEndpoint, provider.TokenEndpoint, provider.JWKSURI)
+			}
+		})
+	}
+}
+
+func TestBool(t *testing.T) {
+	tests := []struct {
+		json string
+		want Bool
+	}{
+		{json: `true`, want: true},
+		{json: `"true"`, want: true},
+		{json: `false`, want: false},
+		{json: `"false"`, want: false},
+		{json: `null`, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.json, func(t *testing.T) {
+			var claims struct {
+				EmailVerified Bool `json:"email_verified"`
+			}
+			if err := json.Unmarshal([]byte(`{"email_verified":`+tt.json+`}`), &claims); err != nil {
+				t.Fatal(err)
+			}
+			if claims.EmailVerified != tt.want {
+				t.Errorf("Bool = %v, want %v", claims.EmailVerified, tt.want)
+			}
+		})
+	}
+}
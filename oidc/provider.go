@@ -0,0 +1,152 @@
+// Package oidc logs users in with OpenID Connect identity providers.
+//
+// Logins use the authorization code flow with PKCE (RFC 7636): Begin stores a
+// state, a nonce and a code verifier and returns the authorization URL of the
+// provider, Finish redeems the state, exchanges the code and verifies the ID
+// token against the keys published by the provider.
+//
+// Providers are configured with `OIDC_PROVIDERS`, a comma separated list of
+// names, and for every name `OIDC_<NAME>_ISSUER`, `OIDC_<NAME>_CLIENT_ID`,
+// `OIDC_<NAME>_CLIENT_SECRET`, `OIDC_<NAME>_REDIRECT_URL` and optionally
+// `OIDC_<NAME>_SCOPES`. Endpoints are discovered from the issuer.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/braswelljr/axxxe/helper"
+)
+
+// Provider - an OpenID Connect identity provider
+type Provider struct {
+	Name         string
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	// endpoints, discovered from the issuer when not set
+	AuthorizationEndpoint string
+	TokenEndpoint         string
+	JWKSURI               string
+
+	discovery sync.Mutex
+	keys      keySet
+}
+
+var (
+	registry     = map[string]*Provider{}
+	registryLock sync.RWMutex
+	registryOnce sync.Once
+
+	// client - http client used to call providers
+	client = &http.Client{Timeout: 10 * time.Second}
+
+	ErrUnknownProvider = errors.New("unknown identity provider")
+)
+
+// Register - adds a provider to the registry, replacing a provider with the same name
+func Register(provider *Provider) {
+	loadProviders()
+
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	registry[strings.ToLower(provider.Name)] = provider
+}
+
+// Lookup - gets a registered provider by name
+func Lookup(name string) (*Provider, error) {
+	loadProviders()
+
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	provider, ok := registry[strings.ToLower(name)]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	return provider, nil
+}
+
+// loadProviders - registers the providers configured in the environment, once
+func loadProviders() {
+	registryOnce.Do(func() {
+		registryLock.Lock()
+		defer registryLock.Unlock()
+
+		for _, name := range helper.GetEnvList("OIDC_PROVIDERS", nil) {
+			prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+			registry[strings.ToLower(name)] = &Provider{
+				Name:         strings.ToLower(name),
+				Issuer:       os.Getenv(prefix + "ISSUER"),
+				ClientId:     os.Getenv(prefix + "CLIENT_ID"),
+				ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+				RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+				Scopes:       helper.GetEnvList(prefix+"SCOPES", []string{"openid", "email", "profile"}),
+			}
+		}
+	})
+}
+
+// discover - fills the endpoints of the provider from its discovery document
+func (p *Provider) discover(ctx context.Context) error {
+	p.discovery.Lock()
+	defer p.discovery.Unlock()
+
+	if p.AuthorizationEndpoint != "" && p.TokenEndpoint != "" && p.JWKSURI != "" {
+		return nil
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s discovery: unexpected status %d", p.Name, response.StatusCode)
+	}
+
+	var document struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&document); err != nil {
+		return err
+	}
+
+	// the document must describe the configured issuer
+	if document.Issuer != p.Issuer {
+		return fmt.Errorf("%s discovery: issuer %q does not match %q", p.Name, document.Issuer, p.Issuer)
+	}
+
+	if p.AuthorizationEndpoint == "" {
+		p.AuthorizationEndpoint = document.AuthorizationEndpoint
+	}
+	if p.TokenEndpoint == "" {
+		p.TokenEndpoint = document.TokenEndpoint
+	}
+	if p.JWKSURI == "" {
+		p.JWKSURI = document.JWKSURI
+	}
+
+	return nil
+}
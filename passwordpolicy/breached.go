@@ -0,0 +1,200 @@
+package passwordpolicy
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// lineChunk - bytes read at once when looking for a line, longer than a line
+// of the Pwned Passwords downloads
+const lineChunk = 128
+
+// BreachedList - a file of SHA-1 hashes of breached passwords sorted by hash.
+//
+// The file has the uppercase or lowercase hex SHA-1 hash of a password on every
+// line, optionally followed by `:<count>`, as in the Pwned Passwords downloads
+// ordered by hash. It is not read into memory: a password is looked up with a
+// binary search over the lines of the file.
+type BreachedList struct {
+	file *os.File
+	size int64
+}
+
+var (
+	breachedLists = map[string]*BreachedList{}
+	breachedLock  sync.Mutex
+
+	ErrUnsortedBreachedList = errors.New("breached passwords list is not sorted by hash")
+)
+
+// OpenBreachedList - opens a list file and checks that its first lines are sorted
+func OpenBreachedList(file string) (*BreachedList, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	list := &BreachedList{file: f, size: info.Size()}
+
+	// a list in another order would silently miss hashes
+	previous, offset := "", int64(0)
+	for i := 0; i < 100 && offset < list.size; i++ {
+		hash, next, err := list.lineAt(offset)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if hash < previous {
+			f.Close()
+			return nil, ErrUnsortedBreachedList
+		}
+		previous, offset = hash, next
+	}
+
+	return list, nil
+}
+
+// LoadBreachedList - opens the list file of the current policy, if any, so
+// misconfigured lists are reported at startup instead of on the first signup
+func LoadBreachedList() error {
+	if file := Current().BreachedFile; file != "" {
+		_, err := breachedList(file)
+		return err
+	}
+
+	return nil
+}
+
+// Breached - checks if a password is in a list file of breached passwords
+func Breached(file, password string) (bool, error) {
+	list, err := breachedList(file)
+	if err != nil {
+		return false, err
+	}
+
+	return list.Contains(password)
+}
+
+// Contains - checks if a password is in the list
+func (l *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	target := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	// binary search over byte offsets, the line starting at or after the middle
+	// offset is compared each time
+	low, high := int64(0), l.size
+	for low < high {
+		middle := low + (high-low)/2
+		start, err := l.lineStart(middle)
+		if err != nil {
+			return false, err
+		}
+		if start >= high {
+			high = middle
+			continue
+		}
+
+		hash, next, err := l.lineAt(start)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case hash == target:
+			return true, nil
+		case hash < target:
+			low = next
+		default:
+			high = middle
+		}
+	}
+
+	return false, nil
+}
+
+// Close - closes the list file
+func (l *BreachedList) Close() error {
+	return l.file.Close()
+}
+
+// lineStart - offset of the first line starting at or after offset
+func (l *BreachedList) lineStart(offset int64) (int64, error) {
+	if offset == 0 {
+		return 0, nil
+	}
+
+	// the line starts after the previous newline
+	position := offset - 1
+	for position < l.size {
+		chunk, err := l.read(position, lineChunk)
+		if err != nil {
+			return 0, err
+		}
+		if i := bytes.IndexByte(chunk, '\n'); i >= 0 {
+			return position + int64(i) + 1, nil
+		}
+		position += int64(len(chunk))
+	}
+
+	return l.size, nil
+}
+
+// lineAt - the uppercase hash of the line starting at offset and the offset of the next line
+func (l *BreachedList) lineAt(offset int64) (string, int64, error) {
+	line := []byte{}
+	position := offset
+	for position < l.size {
+		chunk, err := l.read(position, lineChunk)
+		if err != nil {
+			return "", 0, err
+		}
+		if i := bytes.IndexByte(chunk, '\n'); i >= 0 {
+			line = append(line, chunk[:i]...)
+			position += int64(i) + 1
+			break
+		}
+		line = append(line, chunk...)
+		position += int64(len(chunk))
+	}
+
+	hash := strings.SplitN(string(line), ":", 2)[0]
+	return strings.ToUpper(strings.TrimSpace(hash)), position, nil
+}
+
+// read - reads up to n bytes at offset
+func (l *BreachedList) read(offset int64, n int) ([]byte, error) {
+	chunk := make([]byte, n)
+	read, err := l.file.ReadAt(chunk, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	return chunk[:read], nil
+}
+
+// breachedList - the opened list of a file, opened once
+func breachedList(file string) (*BreachedList, error) {
+	breachedLock.Lock()
+	defer breachedLock.Unlock()
+
+	if list, ok := breachedLists[file]; ok {
+		return list, nil
+	}
+
+	list, err := OpenBreachedList(file)
+	if err != nil {
+		return nil, err
+	}
+	breachedLists[file] = list
+
+	return list, nil
+}
@@ -0,0 +1,155 @@
+package passwordpolicy
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// sha1Hex - the uppercase SHA-1 hash of a password, as in the Pwned Passwords downloads
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// writeList - writes lines to a new file
+func writeList(t *testing.T, lines []string) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+// breachedFile - a sorted list of the hashes of passwords, with counts
+func breachedFile(t *testing.T, passwords ...string) string {
+	t.Helper()
+
+	lines := []string{}
+	for i, password := range passwords {
+		lines = append(lines, fmt.Sprintf("%s:%d", sha1Hex(password), i+1))
+	}
+	sort.Strings(lines)
+
+	return writeList(t, lines)
+}
+
+func TestBreachedListContains(t *testing.T) {
+	passwords := []string{}
+	for i := 0; i < 1000; i++ {
+		passwords = append(passwords, fmt.Sprintf("password%d", i))
+	}
+	hashes := []string{}
+	for _, password := range passwords {
+		hashes = append(hashes, sha1Hex(password))
+	}
+	sort.Strings(hashes)
+
+	lowercase := []string{}
+	for _, hash := range hashes {
+		lowercase = append(lowercase, strings.ToLower(hash))
+	}
+
+	crlf := []string{}
+	for i, hash := range hashes {
+		crlf = append(crlf, fmt.Sprintf("%s:%d\r", hash, i))
+	}
+
+	tests := []struct {
+		name  string
+		lines []string
+	}{
+		{name: "hashes", lines: hashes},
+		{name: "lowercase hashes", lines: lowercase},
+		{name: "hashes with counts and CRLF", lines: crlf},
+		{name: "trailing newline", lines: append(append([]string{}, hashes...), "")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := OpenBreachedList(writeList(t, tt.lines))
+			if err != nil {
+				t.Fatalf("OpenBreachedList() error = %v", err)
+			}
+			defer list.Close()
+
+			for _, password := range passwords {
+				if found, err := list.Contains(password); err != nil || !found {
+					t.Fatalf("Contains(%q) = %v, %v, want true", password, found, err)
+				}
+			}
+			for _, password := range []string{"password1000", "", "Password1", "correct horse battery staple"} {
+				if found, err := list.Contains(password); err != nil || found {
+					t.Errorf("Contains(%q) = %v, %v, want false", password, found, err)
+				}
+			}
+		})
+	}
+}
+
+func TestBreachedListEdges(t *testing.T) {
+	tests := []struct {
+		name     string
+		lines    []string
+		password string
+		found    bool
+	}{
+		{name: "empty file", lines: []string{}, password: "password"},
+		{name: "single line", lines: []string{sha1Hex("password")}, password: "password", found: true},
+		{name: "single other line", lines: []string{sha1Hex("password")}, password: "other"},
+		{name: "first line", lines: []string{"0000000000000000000000000000000000000000", sha1Hex("password"), "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF"}, password: "password", found: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := OpenBreachedList(writeList(t, tt.lines))
+			if err != nil {
+				t.Fatalf("OpenBreachedList() error = %v", err)
+			}
+			defer list.Close()
+
+			if found, err := list.Contains(tt.password); err != nil || found != tt.found {
+				t.Errorf("Contains() = %v, %v, want %v", found, err, tt.found)
+			}
+		})
+	}
+}
+
+func TestOpenBreachedListUnsorted(t *testing.T) {
+	hashes := []string{sha1Hex("a"), sha1Hex("b"), sha1Hex("c")}
+	sort.Sort(sort.Reverse(sort.StringSlice(hashes)))
+	file := writeList(t, hashes)
+
+	if _, err := OpenBreachedList(file); !errors.Is(err, ErrUnsortedBreachedList) {
+		t.Errorf("OpenBreachedList() error = %v, want %v", err, ErrUnsortedBreachedList)
+	}
+	if _, err := OpenBreachedList(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("OpenBreachedList() of a missing file succeeded, want an error")
+	}
+}
+
+func TestLoadBreachedList(t *testing.T) {
+	t.Setenv("PASSWORD_BREACHED_FILE", "")
+	if err := LoadBreachedList(); err != nil {
+		t.Errorf("LoadBreachedList() without a list error = %v", err)
+	}
+
+	t.Setenv("PASSWORD_BREACHED_FILE", filepath.Join(t.TempDir(), "missing.txt"))
+	if err := LoadBreachedList(); err == nil {
+		t.Error("LoadBreachedList() of a missing file succeeded, want an error")
+	}
+
+	t.Setenv("PASSWORD_BREACHED_FILE", breachedFile(t, "password"))
+	if err := LoadBreachedList(); err != nil {
+		t.Errorf("LoadBreachedList() error = %v", err)
+	}
+}
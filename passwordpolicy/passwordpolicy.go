@@ -0,0 +1,177 @@
+// Package passwordpolicy checks new passwords against the password policy.
+//
+// Passwords must be `PASSWORD_MIN_LENGTH` to `PASSWORD_MAX_LENGTH` characters
+// long, use `PASSWORD_MIN_CLASSES` of lowercase letters, uppercase letters,
+// digits and symbols, not contain the username or email of the user, not be one
+// of the last `PASSWORD_HISTORY` passwords of the user and not be a breached
+// password listed in `PASSWORD_BREACHED_FILE`.
+package passwordpolicy
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/braswelljr/axxxe/hasher"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/model"
+)
+
+// Policy - rules new passwords must follow
+type Policy struct {
+	MinLength    int
+	MaxLength    int
+	MinClasses   int
+	History      int
+	BreachedFile string
+}
+
+// Error - the rules a password breaks
+type Error struct {
+	Violations []string
+}
+
+// Error - describes the violations
+func (e *Error) Error() string {
+	return "password " + strings.Join(e.Violations, ", ")
+}
+
+// Current - the policy configured in the environment
+func Current() Policy {
+	return Policy{
+		MinLength:    helper.GetEnvInt("PASSWORD_MIN_LENGTH", 8),
+		MaxLength:    helper.GetEnvInt("PASSWORD_MAX_LENGTH", 72),
+		MinClasses:   helper.GetEnvInt("PASSWORD_MIN_CLASSES", 3),
+		History:      helper.GetEnvInt("PASSWORD_HISTORY", 5),
+		BreachedFile: helper.GetEnv("PASSWORD_BREACHED_FILE", ""),
+	}
+}
+
+// Check - checks a new password of a user against the current policy
+func Check(password string, user *model.User) error {
+	return Current().Check(password, user)
+}
+
+// Remember - adds the hash of a replaced password to a password history
+func Remember(history []string, hash string) []string {
+	return Current().Remember(history, hash)
+}
+
+// Check - checks a new password of a user, returns an *Error listing every broken rule
+func (p Policy) Check(password string, user *model.User) error {
+	violations := []string{}
+
+	// length
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, "must be at least "+strconv.Itoa(p.MinLength)+" characters long")
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		violations = append(violations, "must be at most "+strconv.Itoa(p.MaxLength)+" bytes long")
+	}
+
+	// character classes
+	if classes(password) < p.MinClasses {
+		violations = append(violations, "must contain "+strconv.Itoa(p.MinClasses)+" of lowercase letters, uppercase letters, digits and symbols")
+	}
+
+	// personal information
+	if containsPersonal(password, user) {
+		violations = append(violations, "must not contain your username or email")
+	}
+
+	// reuse
+	if p.reused(password, user) {
+		violations = append(violations, "must not be one of your last "+strconv.Itoa(p.History)+" passwords")
+	}
+
+	// breached passwords
+	if p.BreachedFile != "" {
+		breached, err := Breached(p.BreachedFile, password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			violations = append(violations, "has appeared in a data breach, choose another one")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &Error{Violations: violations}
+	}
+
+	return nil
+}
+
+// Remember - adds the hash of a replaced password to a password history, keeping
+// the most recent hashes the policy checks
+func (p Policy) Remember(history []string, hash string) []string {
+	if hash == "" || p.History <= 0 {
+		return nil
+	}
+
+	remembered := append([]string{hash}, history...)
+	if len(remembered) > p.History {
+		remembered = remembered[:p.History]
+	}
+
+	return remembered
+}
+
+// reused - checks if the password is the current or one of the previous passwords of the user
+func (p Policy) reused(password string, user *model.User) bool {
+	if p.History <= 0 || user == nil {
+		return false
+	}
+
+	hashes := append([]string{user.Password}, user.PasswordHistory...)
+	if len(hashes) > p.History {
+		hashes = hashes[:p.History]
+	}
+
+	for _, hash := range hashes {
+		if hash != "" && hasher.Verify(password, hash) == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// classes - number of character classes used in a password
+func classes(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+
+	return lower + upper + digit + symbol
+}
+
+// containsPersonal - checks if a password contains the username or the local part of the email
+func containsPersonal(password string, user *model.User) bool {
+	if user == nil {
+		return false
+	}
+
+	password = strings.ToLower(password)
+	local := strings.SplitN(user.Email, "@", 2)[0]
+	for _, personal := range []string{user.Username, local} {
+		// very short names are too likely to appear by chance
+		if personal = strings.ToLower(personal); utf8.RuneCountInString(personal) >= 3 && strings.Contains(password, personal) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,149 @@
+package passwordpolicy
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/braswelljr/axxxe/hasher"
+	"github.com/braswelljr/axxxe/model"
+)
+
+// hash - a cheap bcrypt hash of a password
+func hash(t *testing.T, password string) string {
+	t.Helper()
+
+	encoded, err := hasher.BcryptParams{Cost: bcrypt.MinCost}.Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return encoded
+}
+
+func TestCheck(t *testing.T) {
+	policy := Policy{MinLength: 8, MaxLength: 72, MinClasses: 3, History: 3}
+	user := &model.User{
+		Username:        "janedoe",
+		Email:           "jane.smith@example.com",
+		Password:        hash(t, "Current-Passw0rd"),
+		PasswordHistory: []string{hash(t, "Previous-Passw0rd"), hash(t, "Older-Passw0rd"), hash(t, "Forgotten-Passw0rd")},
+	}
+
+	tests := []struct {
+		name       string
+		password   string
+		user       *model.User
+		violations []string
+	}{
+		{name: "valid", password: "Tr0ub4dor&3", user: user},
+		{name: "valid without a user", password: "Tr0ub4dor&3"},
+		{name: "multibyte characters count once", password: "Пароль-Пароль1", user: user},
+		{name: "too short", password: "Ab1!", user: user, violations: []string{"must be at least 8 characters long"}},
+		{
+			name:       "too long",
+			password:   "Aa1!aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+			violations: []string{"must be at most 72 bytes long"},
+		},
+		{
+			name:       "too few classes",
+			password:   "alllowercase",
+			violations: []string{"must contain 3 of lowercase letters, uppercase letters, digits and symbols"},
+		},
+		{name: "contains the username", password: "My-JaneDoe-1", user: user, violations: []string{"must not contain your username or email"}},
+		{name: "contains the email", password: "Jane.Smith!99", user: user, violations: []string{"must not contain your username or email"}},
+		{name: "current password", password: "Current-Passw0rd", user: user, violations: []string{"must not be one of your last 3 passwords"}},
+		{name: "previous password", password: "Older-Passw0rd", user: user, violations: []string{"must not be one of your last 3 passwords"}},
+		{name: "password older than the history", password: "Forgotten-Passw0rd", user: user},
+		{
+			name:     "every violation",
+			password: "janedoe",
+			user:     user,
+			violations: []string{
+				"must be at least 8 characters long",
+				"must contain 3 of lowercase letters, uppercase letters, digits and symbols",
+				"must not contain your username or email",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.password, tt.user)
+			if tt.violations == nil {
+				if err != nil {
+					t.Errorf("Check() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var policyErr *Error
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("Check() error = %v, want an *Error", err)
+			}
+			if !reflect.DeepEqual(policyErr.Violations, tt.violations) {
+				t.Errorf("Check() violations = %q, want %q", policyErr.Violations, tt.violations)
+			}
+		})
+	}
+}
+
+func TestCheckShortNames(t *testing.T) {
+	// names shorter than 3 characters are too likely to appear by chance
+	user := &model.User{Username: "jo", Email: "al@example.com"}
+	if err := (Policy{MinLength: 8, MinClasses: 3}).Check("Jo-and-Al-2024", user); err != nil {
+		t.Errorf("Check() error = %v, want nil", err)
+	}
+}
+
+func TestCheckBreached(t *testing.T) {
+	policy := Policy{MinLength: 8, MinClasses: 1, BreachedFile: breachedFile(t, "P@ssw0rd!", "Summer2024!")}
+
+	for _, tt := range []struct {
+		password string
+		breached bool
+	}{
+		{password: "P@ssw0rd!", breached: true},
+		{password: "Summer2024!", breached: true},
+		{password: "Tr0ub4dor&3"},
+	} {
+		t.Run(tt.password, func(t *testing.T) {
+			err := policy.Check(tt.password, nil)
+			var policyErr *Error
+			if got := errors.As(err, &policyErr); got != tt.breached {
+				t.Errorf("Check() error = %v, want breached %v", err, tt.breached)
+			}
+		})
+	}
+
+	policy.BreachedFile = "missing.txt"
+	if err := policy.Check("Tr0ub4dor&3", nil); err == nil {
+		t.Error("Check() with a missing breached list succeeded, want an error")
+	}
+}
+
+func TestRemember(t *testing.T) {
+	tests := []struct {
+		name    string
+		history []string
+		hash    string
+		limit   int
+		want    []string
+	}{
+		{name: "first password", hash: "a", limit: 3, want: []string{"a"}},
+		{name: "newest first", history: []string{"b", "c"}, hash: "a", limit: 3, want: []string{"a", "b", "c"}},
+		{name: "oldest dropped", history: []string{"b", "c", "d"}, hash: "a", limit: 3, want: []string{"a", "b", "c"}},
+		{name: "history disabled", history: []string{"b"}, hash: "a", limit: 0, want: nil},
+		{name: "no password", history: []string{"b"}, hash: "", limit: 3, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Policy{History: tt.limit}).Remember(tt.history, tt.hash); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Remember() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+// Package patch applies JSON Merge Patch (RFC 7396) and JSON Patch (RFC 6902)
+// documents to JSON objects decoded as maps.
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// patch media types
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+var (
+	ErrInvalidPatch = errors.New("invalid patch")
+	ErrTestFailed   = errors.New("patch test failed")
+)
+
+// Operation - an operation of a JSON Patch
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Merge - applies a JSON Merge Patch to a copy of the document
+func Merge(document map[string]interface{}, patch []byte) (map[string]interface{}, error) {
+	var decoded interface{}
+	if err := json.Unmarshal(patch, &decoded); err != nil {
+		return nil, ErrInvalidPatch
+	}
+
+	// only objects can patch an object
+	patchObject, ok := decoded.(map[string]interface{})
+	if !ok {
+		return nil, ErrInvalidPatch
+	}
+
+	merged, _ := merge(clone(document), patchObject).(map[string]interface{})
+
+	return merged, nil
+}
+
+// Apply - applies a JSON Patch to a copy of the document, either every
+// operation applies or the patch fails
+func Apply(document map[string]interface{}, patch []byte) (map[string]interface{}, error) {
+	var operations []Operation
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, ErrInvalidPatch
+	}
+
+	var patched interface{} = clone(document)
+	for _, operation := range operations {
+		var err error
+		if patched, err = apply(patched, operation); err != nil {
+			return nil, err
+		}
+	}
+
+	result, ok := patched.(map[string]interface{})
+	if !ok {
+		return nil, ErrInvalidPatch
+	}
+
+	return result, nil
+}
+
+// Changes - the sorted top level fields whose values differ between two documents
+func Changes(before, after map[string]interface{}) []string {
+	changes := []string{}
+	for field, value := range before {
+		if other, ok := after[field]; !ok || !reflect.DeepEqual(value, other) {
+			changes = append(changes, field)
+		}
+	}
+	for field := range after {
+		if _, ok := before[field]; !ok {
+			changes = append(changes, field)
+		}
+	}
+	sort.Strings(changes)
+
+	return changes
+}
+
+// merge - merges a patch into a target as described by RFC 7396
+func merge(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = merge(targetObject[key], value)
+	}
+
+	return targetObject
+}
+
+// apply - applies a single JSON Patch operation
+func apply(document interface{}, operation Operation) (interface{}, error) {
+	path, err := parsePointer(operation.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch operation.Op {
+	case "add", "replace", "test":
+		var value interface{}
+		if len(operation.Value) == 0 || json.Unmarshal(operation.Value, &value) != nil {
+			return nil, ErrInvalidPatch
+		}
+
+		switch operation.Op {
+		case "add":
+			return add(document, path, value)
+		case "replace":
+			if document, err = remove(document, path); err != nil {
+				return nil, err
+			}
+			return add(document, path, value)
+		}
+
+		current, err := get(document, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, ErrTestFailed
+		}
+		return document, nil
+	case "remove":
+		return remove(document, path)
+	case "move", "copy":
+		from, err := parsePointer(operation.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(document, from)
+		if err != nil {
+			return nil, err
+		}
+
+		if operation.Op == "move" {
+			// a value can not be moved into itself
+			if len(path) > len(from) && reflect.DeepEqual(path[:len(from)], from) {
+				return nil, ErrInvalidPatch
+			}
+			if document, err = remove(document, from); err != nil {
+				return nil, err
+			}
+		}
+		return add(document, path, clone(value))
+	}
+
+	return nil, ErrInvalidPatch
+}
+
+// parsePointer - splits a JSON Pointer (RFC 6901) into its unescaped tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, ErrInvalidPatch
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+// get - gets the value at a path
+func get(document interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := document.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, ErrInvalidPatch
+			}
+			document = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			document = node[index]
+		default:
+			return nil, ErrInvalidPatch
+		}
+	}
+
+	return document, nil
+}
+
+// add - adds a value at a path, replacing object members and inserting into arrays
+func add(document interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := get(document, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+		return document, nil
+	case []interface{}:
+		index := len(node)
+		if last != "-" {
+			if index, err = arrayIndex(last, len(node)); err != nil {
+				return nil, err
+			}
+		}
+		node = append(node, nil)
+		copy(node[index+1:], node[index:])
+		node[index] = value
+		return set(document, path[:len(path)-1], node)
+	}
+
+	return nil, ErrInvalidPatch
+}
+
+// remove - removes the value at a path
+func remove(document interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, ErrInvalidPatch
+	}
+
+	parent, err := get(document, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := node[last]; !ok {
+			return nil, ErrInvalidPatch
+		}
+		delete(node, last)
+		return document, nil
+	case []interface{}:
+		index, err := arrayIndex(last, len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		return set(document, path[:len(path)-1], append(node[:index], node[index+1:]...))
+	}
+
+	return nil, ErrInvalidPatch
+}
+
+// set - replaces the value at an existing path, used for arrays whose slice changed
+func set(document interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := get(document, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+	case []interface{}:
+		index, err := arrayIndex(last, len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		node[index] = value
+	default:
+		return nil, ErrInvalidPatch
+	}
+
+	return document, nil
+}
+
+// arrayIndex - parses an array index of a pointer, at most max
+func arrayIndex(token string, max int) (int, error) {
+	// leading zeros are not allowed
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, ErrInvalidPatch
+	}
+
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > max {
+		return 0, ErrInvalidPatch
+	}
+
+	return index, nil
+}
+
+// clone - deep copies a decoded JSON value
+func clone(value interface{}) interface{} {
+	switch node := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(node))
+		for key, item := range node {
+			copied[key] = clone(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(node))
+		for i, item := range node {
+			copied[i] = clone(item)
+		}
+		return copied
+	}
+
+	return value
+}
@@ -0,0 +1,150 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// decode - a JSON object decoded as a map
+func decode(t *testing.T, document string) map[string]interface{} {
+	t.Helper()
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(document), &decoded); err != nil {
+		t.Fatalf("invalid document %s: %v", document, err)
+	}
+
+	return decoded
+}
+
+func TestMerge(t *testing.T) {
+	// the examples of RFC 7396 appendix A with an object target and patch
+	tests := []struct {
+		name     string
+		document string
+		patch    string
+		want     string
+		err      error
+	}{
+		{name: "replace member", document: `{"a":"b"}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{name: "add member", document: `{"a":"b"}`, patch: `{"b":"c"}`, want: `{"a":"b","b":"c"}`},
+		{name: "remove member", document: `{"a":"b"}`, patch: `{"a":null}`, want: `{}`},
+		{name: "remove one of two", document: `{"a":"b","b":"c"}`, patch: `{"a":null}`, want: `{"b":"c"}`},
+		{name: "array replaces array", document: `{"a":["b"]}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{name: "value replaces array", document: `{"a":"c"}`, patch: `{"a":["b"]}`, want: `{"a":["b"]}`},
+		{name: "nested merge", document: `{"a":{"b":"c"}}`, patch: `{"a":{"b":"d","c":null}}`, want: `{"a":{"b":"d"}}`},
+		{name: "arrays are not merged", document: `{"a":[{"b":"c"}]}`, patch: `{"a":[1]}`, want: `{"a":[1]}`},
+		{name: "existing nulls are kept", document: `{"e":null}`, patch: `{"a":1}`, want: `{"e":null,"a":1}`},
+		{name: "object created for nested patch", document: `{}`, patch: `{"a":{"bb":{"ccc":null}}}`, want: `{"a":{"bb":{}}}`},
+		{name: "empty patch", document: `{"a":"b"}`, patch: `{}`, want: `{"a":"b"}`},
+		{name: "array patch", document: `{"a":"b"}`, patch: `["c"]`, err: ErrInvalidPatch},
+		{name: "scalar patch", document: `{"a":"b"}`, patch: `"c"`, err: ErrInvalidPatch},
+		{name: "null patch", document: `{"a":"b"}`, patch: `null`, err: ErrInvalidPatch},
+		{name: "malformed patch", document: `{"a":"b"}`, patch: `{"a":`, err: ErrInvalidPatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document := decode(t, tt.document)
+			merged, err := Merge(document, []byte(tt.patch))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Merge() error = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+
+			if want := decode(t, tt.want); !reflect.DeepEqual(merged, want) {
+				t.Errorf("Merge() = %v, want %v", merged, want)
+			}
+			if original := decode(t, tt.document); !reflect.DeepEqual(document, original) {
+				t.Errorf("Merge() changed the document to %v", document)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	// mostly the examples of RFC 6902 appendix A
+	tests := []struct {
+		name     string
+		document string
+		patch    string
+		want     string
+		err      error
+	}{
+		{name: "add member", document: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/baz","value":"qux"}]`, want: `{"baz":"qux","foo":"bar"}`},
+		{name: "add array element", document: `{"foo":["bar","baz"]}`, patch: `[{"op":"add","path":"/foo/1","value":"qux"}]`, want: `{"foo":["bar","qux","baz"]}`},
+		{name: "append array element", document: `{"foo":["bar"]}`, patch: `[{"op":"add","path":"/foo/-","value":"qux"}]`, want: `{"foo":["bar","qux"]}`},
+		{name: "add nested member", document: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, want: `{"foo":"bar","child":{"grandchild":{}}}`},
+		{name: "add array value", document: `{"foo":["bar"]}`, patch: `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, want: `{"foo":["bar",["abc","def"]]}`},
+		{name: "add null", document: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/baz","value":null}]`, want: `{"foo":"bar","baz":null}`},
+		{name: "remove member", document: `{"baz":"qux","foo":"bar"}`, patch: `[{"op":"remove","path":"/baz"}]`, want: `{"foo":"bar"}`},
+		{name: "remove array element", document: `{"foo":["bar","qux","baz"]}`, patch: `[{"op":"remove","path":"/foo/1"}]`, want: `{"foo":["bar","baz"]}`},
+		{name: "replace value", document: `{"baz":"qux","foo":"bar"}`, patch: `[{"op":"replace","path":"/baz","value":"boo"}]`, want: `{"baz":"boo","foo":"bar"}`},
+		{name: "replace array element", document: `{"foo":["a","b","c"]}`, patch: `[{"op":"replace","path":"/foo/1","value":"x"}]`, want: `{"foo":["a","x","c"]}`},
+		{name: "move value", document: `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, patch: `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, want: `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{name: "move array element", document: `{"foo":["all","grass","cows","eat"]}`, patch: `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, want: `{"foo":["all","cows","eat","grass"]}`},
+		{name: "copy value", document: `{"a":{"b":1}}`, patch: `[{"op":"copy","from":"/a","path":"/c"}]`, want: `{"a":{"b":1},"c":{"b":1}}`},
+		{name: "test success", document: `{"baz":"qux","foo":["a",2,"c"]}`, patch: `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, want: `{"baz":"qux","foo":["a",2,"c"]}`},
+		{name: "escaped pointer", document: `{"a/b":1,"m~n":2}`, patch: `[{"op":"replace","path":"/a~1b","value":3},{"op":"remove","path":"/m~0n"}]`, want: `{"a/b":3}`},
+		{name: "empty patch", document: `{"a":1}`, patch: `[]`, want: `{"a":1}`},
+		{name: "test failure", document: `{"baz":"qux"}`, patch: `[{"op":"test","path":"/baz","value":"bar"}]`, err: ErrTestFailed},
+		{name: "failed test undoes earlier operations", document: `{"a":1}`, patch: `[{"op":"add","path":"/b","value":2},{"op":"test","path":"/a","value":2}]`, err: ErrTestFailed},
+		{name: "add to missing parent", document: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/baz/bat","value":"qux"}]`, err: ErrInvalidPatch},
+		{name: "remove missing member", document: `{"foo":"bar"}`, patch: `[{"op":"remove","path":"/baz"}]`, err: ErrInvalidPatch},
+		{name: "replace missing member", document: `{"foo":"bar"}`, patch: `[{"op":"replace","path":"/baz","value":1}]`, err: ErrInvalidPatch},
+		{name: "array index out of bounds", document: `{"foo":["bar"]}`, patch: `[{"op":"add","path":"/foo/2","value":"qux"}]`, err: ErrInvalidPatch},
+		{name: "array index with leading zero", document: `{"foo":["a","b"]}`, patch: `[{"op":"remove","path":"/foo/01"}]`, err: ErrInvalidPatch},
+		{name: "move into itself", document: `{"a":{"b":1}}`, patch: `[{"op":"move","from":"/a","path":"/a/c"}]`, err: ErrInvalidPatch},
+		{name: "missing value", document: `{"a":1}`, patch: `[{"op":"add","path":"/b"}]`, err: ErrInvalidPatch},
+		{name: "unknown operation", document: `{"a":1}`, patch: `[{"op":"merge","path":"/a","value":1}]`, err: ErrInvalidPatch},
+		{name: "pointer without slash", document: `{"a":1}`, patch: `[{"op":"remove","path":"a"}]`, err: ErrInvalidPatch},
+		{name: "replace whole document with a scalar", document: `{"a":1}`, patch: `[{"op":"replace","path":"","value":1}]`, err: ErrInvalidPatch},
+		{name: "object patch", document: `{"a":1}`, patch: `{"op":"remove","path":"/a"}`, err: ErrInvalidPatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document := decode(t, tt.document)
+			patched, err := Apply(document, []byte(tt.patch))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Apply() error = %v, want %v", err, tt.err)
+			}
+			if original := decode(t, tt.document); !reflect.DeepEqual(document, original) {
+				t.Errorf("Apply() changed the document to %v", document)
+			}
+			if tt.err != nil {
+				return
+			}
+
+			if want := decode(t, tt.want); !reflect.DeepEqual(patched, want) {
+				t.Errorf("Apply() = %v, want %v", patched, want)
+			}
+		})
+	}
+}
+
+func TestChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		before string
+		after  string
+		want   []string
+	}{
+		{name: "no changes", before: `{"a":1,"b":[1,2]}`, after: `{"a":1,"b":[1,2]}`, want: []string{}},
+		{name: "changed value", before: `{"a":1,"b":2}`, after: `{"a":1,"b":3}`, want: []string{"b"}},
+		{name: "added and removed", before: `{"a":1,"c":1}`, after: `{"b":1,"c":1}`, want: []string{"a", "b"}},
+		{name: "nested change", before: `{"z":{"x":1},"a":[1]}`, after: `{"z":{"x":2},"a":[2]}`, want: []string{"a", "z"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Changes(decode(t, tt.before), decode(t, tt.after)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Changes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
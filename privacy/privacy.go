@@ -0,0 +1,297 @@
+// Package privacy exports and erases the personal data of users.
+//
+// Users can export a copy of their data and ask for their account to be
+// deleted. Deletion happens once the grace period (`ACCOUNT_DELETION_GRACE_PERIOD`)
+// has passed, until then the user can cancel it. Deleted accounts are not
+// removed: the personal data of the user is anonymized in place, so orders keep
+// referencing the same user id and stay intact for accounting, while sessions,
+// avatars, addresses, carts and pending tickets are deleted.
+package privacy
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/braswelljr/axxxe/address"
+	"github.com/braswelljr/axxxe/audit"
+	"github.com/braswelljr/axxxe/avatar"
+	"github.com/braswelljr/axxxe/database"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/lockout"
+	"github.com/braswelljr/axxxe/model"
+	"github.com/braswelljr/axxxe/session"
+	"github.com/braswelljr/axxxe/ticket"
+	"github.com/braswelljr/axxxe/view"
+)
+
+var (
+	users       = database.OpenCollection(database.Client, "users")
+	carts       = database.OpenCollection(database.Client, "carts")
+	orders      = database.OpenCollection(database.Client, "orders")
+	invitations = database.OpenCollection(database.Client, "invitations")
+
+	ErrNotScheduled = errors.New("account deletion is not scheduled")
+)
+
+func init() {
+	database.CreateIndexes(users,
+		mongo.IndexModel{Keys: bson.D{{Key: "deletion_scheduled_at", Value: 1}}, Options: options.Index().SetSparse(true)},
+	)
+}
+
+// GracePeriod - how long after asking for it an account is deleted
+func GracePeriod() time.Duration {
+	return helper.GetEnvDuration("ACCOUNT_DELETION_GRACE_PERIOD", 30*24*time.Hour)
+}
+
+// Export - collects the personal data of a user
+func Export(ctx context.Context, user *model.User) (*view.DataExport, error) {
+	sessions, err := session.History(ctx, user.UserId)
+	if err != nil {
+		return nil, err
+	}
+	addresses, err := address.List(ctx, user.UserId)
+	if err != nil {
+		return nil, err
+	}
+	userCarts, err := documents(ctx, carts, user.UserId)
+	if err != nil {
+		return nil, err
+	}
+	userOrders, err := documents(ctx, orders, user.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &view.DataExport{
+		ExportedAt: primitive.NewDateTimeFromTime(time.Now()),
+		User:       view.Self(user),
+		Sessions:   sessions,
+		Addresses:  addresses,
+		Carts:      userCarts,
+		Orders:     userOrders,
+	}, nil
+}
+
+// ScheduleDeletion - schedules the deletion of an account at the end of the grace
+// period, returns when it will be deleted
+func ScheduleDeletion(ctx context.Context, userId string) (time.Time, error) {
+	now := time.Now()
+	deleteAt := now.Add(GracePeriod())
+
+	result, err := users.UpdateOne(
+		ctx,
+		bson.M{"user_id": userId, "status": bson.M{"$ne": model.UserStatusDeleted}},
+		bson.M{
+			"$set": bson.M{
+				"deletion_scheduled_at": primitive.NewDateTimeFromTime(deleteAt),
+				"updated_at":            primitive.NewDateTimeFromTime(now),
+			},
+		},
+	)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if result.MatchedCount == 0 {
+		return time.Time{}, mongo.ErrNoDocuments
+	}
+
+	return deleteAt, nil
+}
+
+// CancelDeletion - cancels the scheduled deletion of an account
+func CancelDeletion(ctx context.Context, userId string) error {
+	result, err := users.UpdateOne(
+		ctx,
+		bson.M{"user_id": userId, "deletion_scheduled_at": bson.M{"$exists": true}, "status": bson.M{"$ne": model.UserStatusDeleted}},
+		bson.M{
+			"$unset": bson.M{"deletion_scheduled_at": ""},
+			"$set":   bson.M{"updated_at": primitive.NewDateTimeFromTime(time.Now())},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotScheduled
+	}
+
+	return nil
+}
+
+// DeleteDue - deletes the accounts whose grace period has passed, returns the
+// number of deleted accounts
+func DeleteDue(ctx context.Context) (int, error) {
+	now := time.Now()
+
+	cursor, err := users.Find(ctx, bson.M{
+		"deletion_scheduled_at": bson.M{"$lte": primitive.NewDateTimeFromTime(now)},
+		"status":                bson.M{"$ne": model.UserStatusDeleted},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	due := []model.User{}
+	if err := cursor.All(ctx, &due); err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for i := range due {
+		erased, err := erase(ctx, &due[i], now)
+		if err != nil {
+			return deleted, err
+		}
+		if erased {
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// Run - deletes the due accounts every interval until the context is done
+func Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if deleted, err := DeleteDue(ctx); err != nil {
+			log.Printf("Oops! could not delete the accounts due for deletion: %v\n", err)
+		} else if deleted > 0 {
+			log.Printf("Deleted %d accounts\n", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// erase - anonymizes a user whose deletion is still due and deletes their other
+// personal data. Returns false when the deletion was cancelled in the meantime.
+func erase(ctx context.Context, user *model.User, now time.Time) (bool, error) {
+	// anonymize the user, unless the deletion was cancelled
+	result, err := users.UpdateOne(
+		ctx,
+		bson.M{
+			"user_id":               user.UserId,
+			"deletion_scheduled_at": bson.M{"$lte": primitive.NewDateTimeFromTime(now)},
+			"status":                bson.M{"$ne": model.UserStatusDeleted},
+		},
+		bson.M{
+			"$set": bson.M{
+				"username":   "deleted-" + user.UserId,
+				"email":      anonymizedEmail(user.UserId),
+				"password":   "",
+				"status":     model.UserStatusDeleted,
+				"deleted_at": primitive.NewDateTimeFromTime(now),
+				"updated_at": primitive.NewDateTimeFromTime(now),
+			},
+			"$unset": bson.M{
+				"firstname":             "",
+				"lastname":              "",
+				"phone":                 "",
+				"gender":                "",
+				"two_factor":            "",
+				"identities":            "",
+				"avatar":                "",
+				"password_history":      "",
+				"verification_sent_at":  "",
+				"deletion_scheduled_at": "",
+			},
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	if result.MatchedCount == 0 {
+		return false, nil
+	}
+
+	// log out everywhere and forget the devices
+	if err := session.Forget(ctx, user.UserId); err != nil {
+		return true, err
+	}
+
+	// pending password resets and sign-in links
+	if err := ticket.DeleteAll(ctx, user.UserId); err != nil {
+		return true, err
+	}
+
+	// failed logins are kept by email
+	if err := lockout.Reset(ctx, lockout.AccountKey(user.Email)); err != nil {
+		return true, err
+	}
+
+	// the profile image
+	if user.Avatar != "" {
+		if err := avatar.Delete(ctx, user.UserId, user.Avatar); err != nil {
+			return true, err
+		}
+	}
+
+	// the address book, orders keep their own copy of the addresses
+	if err := address.DeleteAll(ctx, user.UserId); err != nil {
+		return true, err
+	}
+
+	// carts have no value once the user is gone, orders are kept
+	if _, err := carts.DeleteMany(ctx, bson.M{"user_id": user.UserId}); err != nil {
+		return true, err
+	}
+
+	// the invitation the account was created from
+	if _, err := invitations.UpdateMany(
+		ctx,
+		bson.M{"user_id": user.UserId},
+		bson.M{"$set": bson.M{"email": anonymizedEmail(user.UserId)}},
+	); err != nil {
+		return true, err
+	}
+
+	// the audit log keeps what happened, not who it happened to
+	if err := audit.Anonymize(ctx, user.UserId); err != nil {
+		return true, err
+	}
+
+	if err := audit.Record(ctx, &model.AuditEntry{
+		Action:  model.AuditUserDeleted,
+		ActorId: user.UserId,
+		UserId:  user.UserId,
+	}); err != nil {
+		log.Printf("Oops! could not audit the deletion of %s: %v\n", user.UserId, err)
+	}
+
+	return true, nil
+}
+
+// documents - gets the documents of a collection referencing a user
+func documents(ctx context.Context, collection *mongo.Collection, userId string) ([]bson.M, error) {
+	cursor, err := collection.Find(ctx, bson.M{"user_id": userId})
+	if err != nil {
+		return nil, err
+	}
+
+	list := []bson.M{}
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// anonymizedEmail - email of a deleted user, unique but not deliverable
+func anonymizedEmail(userId string) string {
+	return "deleted-" + userId + "@deleted.invalid"
+}
@@ -3,43 +3,108 @@ package routes
 import (
 	"github.com/gofiber/fiber/v2"
 
+	"github.com/braswelljr/axxxe/controllers/v1/address"
+	"github.com/braswelljr/axxxe/controllers/v1/apikey"
+	"github.com/braswelljr/axxxe/controllers/v1/audit"
 	"github.com/braswelljr/axxxe/controllers/v1/authentication"
 	"github.com/braswelljr/axxxe/controllers/v1/product"
 	"github.com/braswelljr/axxxe/controllers/v1/user"
 	"github.com/braswelljr/axxxe/middleware"
+	"github.com/braswelljr/axxxe/model"
 )
 
 // Routes handles application routes.
 // - APIs are prefixed with `api`.
 // - Versions are prefixed with `v(number)`. Example `v1`, `v2`.
 func Routes(app *fiber.App) {
+	// Token verification keys
+	app.Get("/.well-known/jwks.json", authentication.JWKS())
+
 	// API Routes with /api
 	api := app.Group("/api")
 	// Versioning
 	// Version 1 (prefix - v1)
 	v1 := api.Group("/v1")
+	// Authentication is configured per route group, storefront groups used by
+	// browsers also accept cookie sessions protected by csrf tokens
+	storefront := middleware.AuthConfig{AllowCookie: true}
 	// User prefixed routes
 	// Authentication
 	{
 		auth := v1.Group("/users")
 		{
-			auth.Post("/signup", authentication.Signup()) // Signup new users
-			auth.Post("/login", authentication.Login())   // Login users
-			auth.Post("/logout", authentication.Logout()) // Logout users
+			auth.Post("/signup", authentication.Signup())                                  // Signup new users
+			auth.Post("/login", authentication.Login())                                    // Login users
+			auth.Post("/refresh", authentication.Refresh())                                // Refresh tokens
+			auth.Post("/forgot-password", authentication.ForgotPassword())                 // Request a password reset
+			auth.Post("/reset-password", authentication.ResetPassword())                   // Reset password with a reset token
+			auth.Get("/verify-email", authentication.VerifyEmail())                        // Verify email from the verification link
+			auth.Post("/login/2fa", authentication.LoginTwoFactor())                       // Complete login with a two-factor code
+			auth.Post("/login/2fa/enroll", authentication.LoginEnrollTwoFactor())          // Enroll in two-factor authentication on login
+			auth.Post("/login/2fa/enroll/confirm", authentication.LoginConfirmTwoFactor()) // Confirm two-factor enrollment and login
+			auth.Post("/login/magic-link", authentication.RequestMagicLink())              // Request a sign-in link
+			auth.Post("/login/magic-link/verify", authentication.LoginMagicLink())         // Login with a sign-in link
+			auth.Post("/email/confirm", authentication.ConfirmEmailChange())               // Change the email with the link sent to it
+			auth.Post("/email/revert", authentication.RevertEmailChange())                 // Restore the previous email
+			auth.Post("/accept-invite", authentication.AcceptInvitation())                 // Create an invited account
+			auth.Get("/oidc/:provider/login", authentication.OIDCLogin())                  // Login with an identity provider
+			auth.Get("/oidc/:provider/callback", authentication.OIDCCallback())            // Complete login with an identity provider
 		}
 		// Protected routes
-		usr := v1.Use(middleware.Authenticate()).Group("/users")
+		usr := v1.Group("/users", middleware.Authenticate(storefront), middleware.CSRF(), middleware.RequireVerified(), middleware.BlockImpersonation())
+		{
+			usr.Post("/verify-email/resend", middleware.RequireUser(), authentication.ResendVerification())                                                     // Resend verification email
+			usr.Post("/logout", middleware.RequireUser(), authentication.Logout())                                                                              // Logout users
+			usr.Post("/logout-all", middleware.RequireUser(), authentication.LogoutAll())                                                                       // Logout users everywhere
+			usr.Post("/2fa/enroll", middleware.RequireUser(), authentication.EnrollTwoFactor())                                                                 // Start two-factor enrollment
+			usr.Post("/2fa/confirm", middleware.RequireUser(), authentication.ConfirmTwoFactor())                                                               // Enable two-factor authentication
+			usr.Post("/2fa/disable", middleware.RequireUser(), authentication.DisableTwoFactor())                                                               // Disable two-factor authentication
+			usr.Post("/2fa/recovery-codes", middleware.RequireUser(), authentication.RegenerateRecoveryCodes())                                                 // Regenerate recovery codes
+			usr.Get("/sessions", middleware.RequireUser(), authentication.ListSessions())                                                                       // Get the sessions of the user
+			usr.Delete("/sessions", middleware.RequireUser(), authentication.RevokeOtherSessions())                                                             // Revoke the other sessions of the user
+			usr.Delete("/sessions/:session_id", middleware.RequireUser(), authentication.RevokeSession())                                                       // Revoke a session of the user
+			usr.Post("/invitations", middleware.RequirePermission(model.PermissionUsersInvite), authentication.InviteUser())                                    // Invite a user with a role
+			usr.Get("/", middleware.RequirePermission(model.PermissionUsersList), user.GetAllUsers())                                                           // Get all users
+			usr.Get("/:user_id", middleware.RequireOwnerOrPermission("user_id", model.PermissionUsersRead), user.GetUser())                                     // Get user by id
+			usr.Patch("/:user_id", middleware.RequireOwnerOrPermission("user_id", model.PermissionUsersUpdate), user.UpdateUser())                              // Update user by id
+			usr.Patch("/:user_id/update-password", middleware.RequireOwner("user_id"), authentication.UpdatePassword())                                         // Update password
+			usr.Post("/:user_id/email", middleware.RequireOwner("user_id"), authentication.RequestEmailChange())                                                // Request an email change
+			usr.Get("/:user_id/addresses", middleware.RequireOwnerOrPermission("user_id", model.PermissionUsersRead), address.GetAddresses())                   // Get the addresses of the user
+			usr.Post("/:user_id/addresses", middleware.RequireOwnerOrPermission("user_id", model.PermissionUsersUpdate), address.CreateAddress())               // Add an address of the user
+			usr.Get("/:user_id/addresses/:address_id", middleware.RequireOwnerOrPermission("user_id", model.PermissionUsersRead), address.GetAddress())         // Get an address of the user
+			usr.Put("/:user_id/addresses/:address_id", middleware.RequireOwnerOrPermission("user_id", model.PermissionUsersUpdate), address.UpdateAddress())    // Replace an address of the user
+			usr.Delete("/:user_id/addresses/:address_id", middleware.RequireOwnerOrPermission("user_id", model.PermissionUsersUpdate), address.DeleteAddress()) // Delete an address of the user
+			usr.Put("/:user_id/avatar", middleware.RequireOwnerOrPermission("user_id", model.PermissionUsersUpdate), user.UploadAvatar())                       // Upload the avatar of the user
+			usr.Delete("/:user_id/avatar", middleware.RequireOwnerOrPermission("user_id", model.PermissionUsersUpdate), user.DeleteAvatar())                    // Delete the avatar of the user
+			usr.Get("/:user_id/export", middleware.RequireOwner("user_id"), user.ExportUser())                                                                  // Export the personal data of the user
+			usr.Post("/:user_id/deletion", middleware.RequireOwner("user_id"), user.RequestDeletion())                                                          // Schedule the deletion of the user
+			usr.Delete("/:user_id/deletion", middleware.RequireOwner("user_id"), user.CancelDeletion())                                                         // Cancel the deletion of the user
+			usr.Post("/:user_id/impersonate", middleware.RequirePermission(model.PermissionUsersImpersonate), authentication.Impersonate())                     // Impersonate a user
+			usr.Post("/:user_id/unlock", middleware.RequirePermission(model.PermissionUsersUnlock), authentication.UnlockUser())                                // Unlock user locked out after failed logins
+		}
+	}
+	// Avatar images, public and cached
+	v1.Get("/avatars/:user_id/:version/:size.jpg", user.GetAvatar())
+	// API key routes, for admins managing the keys of services
+	{
+		apiKeys := v1.Group("/api-keys", middleware.Authenticate(), middleware.RequireVerified(), middleware.BlockImpersonation(), middleware.RequirePermission(model.PermissionAPIKeysManage))
+		{
+			apiKeys.Post("/", apikey.CreateAPIKey())          // Create an api key
+			apiKeys.Get("/", apikey.GetAllAPIKeys())          // Get all api keys
+			apiKeys.Delete("/:key_id", apikey.RevokeAPIKey()) // Revoke an api key
+		}
+	}
+	// Audit log routes, for admins investigating account events
+	{
+		auditLog := v1.Group("/audit", middleware.Authenticate(), middleware.RequireVerified(), middleware.BlockImpersonation(), middleware.RequirePermission(model.PermissionAuditRead))
 		{
-			usr.Get("/", user.GetAllUsers())                                        // Get all users
-			usr.Get("/:user_id", user.GetUser())                                    // Get user by id
-			usr.Patch("/:user_id", user.UpdateUser())                               // Update user by id
-			usr.Patch("/:user_id/update-password", authentication.UpdatePassword()) // Update password
-			usr.Patch("/:user_id/forgot-password", authentication.ForgotPassword()) // Update password
+			auditLog.Get("/", audit.GetAuditLog())          // Get a page of the audit log
+			auditLog.Get("/export", audit.ExportAuditLog()) // Export the audit log as NDJSON
 		}
 	}
 	// Product routes
 	{
-		products := v1.Group("/products")
+		products := v1.Group("/products", middleware.Authenticate(storefront), middleware.CSRF(), middleware.RequireVerified(), middleware.BlockImpersonation())
 		{
 			products.Get("/", product.GetAllProducts())        // Get all products
 			products.Get("/:product_id", product.GetProduct()) // Get product by id
@@ -0,0 +1,65 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+// maxCacheEntries - number of entries after which expired entries are swept
+const maxCacheEntries = 10000
+
+// cache - in memory cache of revocation lookups
+type cache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[string]cacheEntry
+}
+
+// cacheEntry - a cached revocation time, zero when not revoked
+type cacheEntry struct {
+	revokedAt time.Time
+	expiresAt time.Time
+}
+
+// newCache - creates a cache keeping entries for ttl
+func newCache(ttl time.Duration) *cache {
+	return &cache{
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// get - gets a cached revocation time
+func (c *cache) get(key string) (time.Time, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return time.Time{}, false
+	}
+
+	return entry.revokedAt, true
+}
+
+// set - caches a revocation time
+func (c *cache) set(key string, revokedAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	// sweep expired entries
+	if len(c.entries) >= maxCacheEntries {
+		for k, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+	}
+
+	c.entries[key] = cacheEntry{
+		revokedAt: revokedAt,
+		expiresAt: now.Add(c.ttl),
+	}
+}
@@ -0,0 +1,169 @@
+// Package session keeps track of the sessions of users and of revoked sessions.
+//
+// Every login starts a session, its id is carried in the `jti` claim of the
+// access tokens and as the family of the refresh tokens. Sessions are stored
+// with the device they were started on and the hash of their current refresh
+// token, so users can have a session on every device. Revoked sessions and
+// "log out everywhere" cut-off times are stored in MongoDB with TTL indexes, so
+// they are dropped once every token they could affect has expired, and are
+// cached in memory in front of the database.
+package session
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/braswelljr/axxxe/database"
+	"github.com/braswelljr/axxxe/helper"
+)
+
+var (
+	revokedSessions = database.OpenCollection(database.Client, "revoked_sessions")
+	revokedUsers    = database.OpenCollection(database.Client, "revoked_users")
+
+	// CacheTTL - how long a revocation lookup is cached, revocations made by
+	// other instances are seen after at most this duration
+	CacheTTL = 30 * time.Second
+
+	revocations = newCache(CacheTTL)
+)
+
+func init() {
+	database.CreateIndexes(revokedSessions,
+		mongo.IndexModel{Keys: bson.D{{Key: "session_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		mongo.IndexModel{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	)
+	database.CreateIndexes(revokedUsers,
+		mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		mongo.IndexModel{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	)
+}
+
+// NewSessionId - generates a new session id
+func NewSessionId() (string, error) {
+	return helper.RandomString(16)
+}
+
+// Revoke - revokes a single session of a user
+func Revoke(ctx context.Context, sessionId, userId string) error {
+	now := time.Now()
+
+	_, err := revokedSessions.UpdateOne(
+		ctx,
+		bson.M{"session_id": sessionId},
+		bson.M{
+			"$set": bson.M{
+				"user_id":    userId,
+				"revoked_at": now,
+				"expires_at": now.Add(helper.RefreshTokenTTL),
+			},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return err
+	}
+	if err := markRevoked(ctx, bson.M{"session_id": sessionId, "user_id": userId}, now); err != nil {
+		return err
+	}
+
+	revocations.set(sessionKey(sessionId), now)
+
+	return nil
+}
+
+// RevokeAll - revokes every session of a user issued until now. The cut-off is
+// rounded up to the millisecond MongoDB stores times with, RevokeAll only
+// returns once it has passed so tokens issued afterwards stay valid.
+func RevokeAll(ctx context.Context, userId string) error {
+	now := time.Now()
+	cutoff := now.Truncate(time.Millisecond).Add(time.Millisecond)
+
+	_, err := revokedUsers.UpdateOne(
+		ctx,
+		bson.M{"user_id": userId},
+		bson.M{
+			"$set": bson.M{
+				"revoked_before": cutoff,
+				"expires_at":     now.Add(helper.RefreshTokenTTL),
+			},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return err
+	}
+	if err := markRevoked(ctx, bson.M{"user_id": userId}, now); err != nil {
+		return err
+	}
+
+	revocations.set(userKey(userId), cutoff)
+
+	// token timestamps lose up to a microsecond when parsed, wait a millisecond
+	// past the cut-off before tokens can be issued again
+	time.Sleep(time.Until(cutoff.Add(time.Millisecond)))
+
+	return nil
+}
+
+// IsRevoked - checks if a session has been revoked, or every session of the
+// user issued until issuedAt
+func IsRevoked(ctx context.Context, sessionId, userId string, issuedAt time.Time) (bool, error) {
+	// the session itself
+	revokedAt, err := lookup(ctx, revokedSessions, sessionKey(sessionId), bson.M{"session_id": sessionId}, "revoked_at")
+	if err != nil {
+		return false, err
+	}
+	if !revokedAt.IsZero() {
+		return true, nil
+	}
+
+	// log out everywhere
+	revokedBefore, err := lookup(ctx, revokedUsers, userKey(userId), bson.M{"user_id": userId}, "revoked_before")
+	if err != nil {
+		return false, err
+	}
+
+	// tokens issued at the cut-off are revoked
+	return !revokedBefore.IsZero() && !issuedAt.After(revokedBefore), nil
+}
+
+// lookup - gets a revocation time from the cache or the database
+func lookup(ctx context.Context, collection *mongo.Collection, key string, filter bson.M, field string) (time.Time, error) {
+	if revokedAt, ok := revocations.get(key); ok {
+		return revokedAt, nil
+	}
+
+	// get the revocation from the database
+	result := bson.M{}
+	err := collection.FindOne(ctx, filter).Decode(&result)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return time.Time{}, err
+	}
+
+	revokedAt := time.Time{}
+	if value, ok := result[field]; ok {
+		if dateTime, ok := value.(interface{ Time() time.Time }); ok {
+			revokedAt = dateTime.Time()
+		}
+	}
+
+	revocations.set(key, revokedAt)
+
+	return revokedAt, nil
+}
+
+// sessionKey - cache key of a session
+func sessionKey(sessionId string) string {
+	return "session:" + sessionId
+}
+
+// userKey - cache key of a user
+func userKey(userId string) string {
+	return "user:" + userId
+}
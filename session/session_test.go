@@ -0,0 +1,103 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// issued - the issue time of a token as parsed from its claims
+func issued(t *testing.T, at time.Time) time.Time {
+	t.Helper()
+
+	raw, err := json.Marshal(jwt.NewNumericDate(at))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := &jwt.NumericDate{}
+	if err := json.Unmarshal(raw, parsed); err != nil {
+		t.Fatal(err)
+	}
+
+	return parsed.Time
+}
+
+func TestIsRevoked(t *testing.T) {
+	// revocations are looked up in the cache before the database
+	cutoff := time.Date(2022, 11, 5, 10, 30, 0, 124000000, time.UTC)
+	revocations.set(sessionKey("active"), time.Time{})
+	revocations.set(sessionKey("revoked"), cutoff)
+	revocations.set(userKey("user"), cutoff)
+	revocations.set(userKey("other"), time.Time{})
+
+	tests := []struct {
+		name      string
+		sessionId string
+		userId    string
+		issuedAt  time.Time
+		want      bool
+	}{
+		{name: "revoked session", sessionId: "revoked", userId: "other", issuedAt: cutoff.Add(time.Hour), want: true},
+		{name: "user without cut-off", sessionId: "active", userId: "other", issuedAt: cutoff, want: false},
+		{name: "issued before the cut-off", sessionId: "active", userId: "user", issuedAt: cutoff.Add(-time.Minute), want: true},
+		{name: "issued in the same second before the cut-off", sessionId: "active", userId: "user", issuedAt: cutoff.Add(-time.Microsecond), want: true},
+		{name: "issued in the same second with whole seconds", sessionId: "active", userId: "user", issuedAt: cutoff.Truncate(time.Second), want: true},
+		{name: "issued at the cut-off", sessionId: "active", userId: "user", issuedAt: cutoff, want: true},
+		{name: "issued after the cut-off", sessionId: "active", userId: "user", issuedAt: cutoff.Add(time.Millisecond), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revoked, err := IsRevoked(context.Background(), tt.sessionId, tt.userId, issued(t, tt.issuedAt))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if revoked != tt.want {
+				t.Errorf("IsRevoked() = %v, want %v", revoked, tt.want)
+			}
+		})
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := newCache(time.Minute)
+	revokedAt := time.Now()
+
+	if _, ok := c.get("session:1"); ok {
+		t.Error("get() found an entry that was never set")
+	}
+	c.set("session:1", revokedAt)
+	if got, ok := c.get("session:1"); !ok || !got.Equal(revokedAt) {
+		t.Errorf("get() = %v, %v, want %v, true", got, ok, revokedAt)
+	}
+
+	expired := newCache(-time.Second)
+	expired.set("session:1", revokedAt)
+	if _, ok := expired.get("session:1"); ok {
+		t.Error("get() found an expired entry")
+	}
+}
+
+func TestDeviceName(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      string
+	}{
+		{userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36 Edg/119.0.0.0", want: "Edge on Windows"},
+		{userAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36", want: "Chrome on macOS"},
+		{userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Version/17.0 Mobile/15E148 Safari/604.1", want: "Safari on iPhone"},
+		{userAgent: "Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 Chrome/119.0.0.0 Mobile Safari/537.36", want: "Chrome on Android"},
+		{userAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/119.0", want: "Firefox on Linux"},
+		{userAgent: "curl/8.0", want: "Unknown device"},
+		{userAgent: "", want: "Unknown device"},
+	}
+
+	for _, tt := range tests {
+		if got := DeviceName(tt.userAgent); got != tt.want {
+			t.Errorf("DeviceName(%q) = %q, want %q", tt.userAgent, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/braswelljr/axxxe/database"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/model"
+)
+
+// lastSeenPrecision - the last use of a session is only written when older than this
+const lastSeenPrecision = time.Minute
+
+var (
+	sessions = database.OpenCollection(database.Client, "sessions")
+
+	// seen - sessions whose last use was written recently
+	seen = newCache(lastSeenPrecision)
+
+	ErrNotFound = errors.New("session not found")
+)
+
+func init() {
+	database.CreateIndexes(sessions,
+		mongo.IndexModel{Keys: bson.D{{Key: "session_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "last_seen_at", Value: -1}}},
+		mongo.IndexModel{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	)
+}
+
+// Start - stores a new session of a user with its first refresh token
+func Start(ctx context.Context, sessionId, userId, refreshToken, ip, userAgent, deviceName string) (*model.Session, error) {
+	now := time.Now()
+	if deviceName == "" {
+		deviceName = DeviceName(userAgent)
+	}
+
+	s := &model.Session{
+		SessionId:        sessionId,
+		UserId:           userId,
+		RefreshTokenHash: helper.HashToken(refreshToken),
+		DeviceName:       deviceName,
+		IP:               ip,
+		UserAgent:        userAgent,
+		CreatedAt:        primitive.NewDateTimeFromTime(now),
+		LastSeenAt:       primitive.NewDateTimeFromTime(now),
+		ExpiresAt:        primitive.NewDateTimeFromTime(now.Add(helper.RefreshTokenTTL)),
+	}
+
+	if _, err := sessions.InsertOne(ctx, s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Find - gets a session by id
+func Find(ctx context.Context, sessionId string) (*model.Session, error) {
+	s := &model.Session{}
+	err := sessions.FindOne(ctx, bson.M{"session_id": sessionId}).Decode(s)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Rotate - replaces the refresh token of an active session, only if the current
+// refresh token is the one presented. Returns false when it is not.
+func Rotate(ctx context.Context, sessionId, refreshToken, newRefreshToken, ip string) (bool, error) {
+	now := time.Now()
+
+	result, err := sessions.UpdateOne(
+		ctx,
+		bson.M{
+			"session_id":         sessionId,
+			"refresh_token_hash": helper.HashToken(refreshToken),
+			"revoked_at":         bson.M{"$exists": false},
+		},
+		bson.M{
+			"$set": bson.M{
+				"refresh_token_hash": helper.HashToken(newRefreshToken),
+				"ip":                 ip,
+				"last_seen_at":       primitive.NewDateTimeFromTime(now),
+				"expires_at":         primitive.NewDateTimeFromTime(now.Add(helper.RefreshTokenTTL)),
+			},
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount > 0, nil
+}
+
+// Touch - records the use of a session, at most once per minute
+func Touch(ctx context.Context, sessionId, ip string) error {
+	if _, ok := seen.get(sessionId); ok {
+		return nil
+	}
+
+	now := time.Now()
+	if _, err := sessions.UpdateOne(
+		ctx,
+		bson.M{"session_id": sessionId},
+		bson.M{"$set": bson.M{"ip": ip, "last_seen_at": primitive.NewDateTimeFromTime(now)}},
+	); err != nil {
+		return err
+	}
+
+	seen.set(sessionId, now)
+
+	return nil
+}
+
+// List - gets the active sessions of a user, most recently used first
+func List(ctx context.Context, userId string) ([]model.Session, error) {
+	cursor, err := sessions.Find(
+		ctx,
+		bson.M{
+			"user_id":    userId,
+			"revoked_at": bson.M{"$exists": false},
+			"expires_at": bson.M{"$gt": primitive.NewDateTimeFromTime(time.Now())},
+		},
+		options.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	list := []model.Session{}
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// History - gets every stored session of a user, including revoked and expired
+// sessions not dropped yet
+func History(ctx context.Context, userId string) ([]model.Session, error) {
+	cursor, err := sessions.Find(ctx, bson.M{"user_id": userId}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	list := []model.Session{}
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// Forget - revokes every session of a user and deletes the stored sessions
+func Forget(ctx context.Context, userId string) error {
+	if err := RevokeAll(ctx, userId); err != nil {
+		return err
+	}
+
+	_, err := sessions.DeleteMany(ctx, bson.M{"user_id": userId})
+
+	return err
+}
+
+// RevokeOthers - revokes every active session of a user except one, returns the
+// number of revoked sessions
+func RevokeOthers(ctx context.Context, userId, sessionId string) (int, error) {
+	list, err := List(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for _, s := range list {
+		if s.SessionId == sessionId {
+			continue
+		}
+		if err := Revoke(ctx, s.SessionId, userId); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+
+	return revoked, nil
+}
+
+// markRevoked - marks the stored sessions matching the filter as revoked
+func markRevoked(ctx context.Context, filter bson.M, now time.Time) error {
+	filter["revoked_at"] = bson.M{"$exists": false}
+
+	_, err := sessions.UpdateMany(
+		ctx,
+		filter,
+		bson.M{"$set": bson.M{"revoked_at": primitive.NewDateTimeFromTime(now)}},
+	)
+
+	return err
+}
+
+// DeviceName - a readable name of the device of a user agent, e.g. `Firefox on Windows`
+func DeviceName(userAgent string) string {
+	browser := ""
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	system := ""
+	for _, s := range []struct{ token, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+
+	return "Unknown device"
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewLocalStore(t.TempDir())
+
+	tests := []struct {
+		name        string
+		key         string
+		data        []byte
+		contentType string
+	}{
+		{name: "jpeg", key: "avatars/user/1/128.jpg", data: []byte("jpeg"), contentType: "image/jpeg"},
+		{name: "png", key: "avatars/user/1/64.png", data: []byte("png"), contentType: "image/png"},
+		{name: "unknown extension", key: "files/data", data: []byte("data"), contentType: "application/octet-stream"},
+		{name: "empty", key: "files/empty.txt", data: []byte{}, contentType: "text/plain; charset=utf-8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := store.Put(ctx, tt.key, "", tt.data); err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+
+			blob, err := store.Get(ctx, tt.key)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if !bytes.Equal(blob.Data, tt.data) {
+				t.Errorf("Get() data = %q, want %q", blob.Data, tt.data)
+			}
+			if blob.ContentType != tt.contentType {
+				t.Errorf("Get() content type = %q, want %q", blob.ContentType, tt.contentType)
+			}
+			if blob.ModTime.IsZero() {
+				t.Error("Get() mod time is zero")
+			}
+
+			if err := store.Delete(ctx, tt.key); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			if _, err := store.Get(ctx, tt.key); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get() after Delete() error = %v, want %v", err, ErrNotFound)
+			}
+			if err := store.Delete(ctx, tt.key); err != nil {
+				t.Errorf("Delete() of a missing blob error = %v", err)
+			}
+		})
+	}
+}
+
+func TestLocalStoreReplaces(t *testing.T) {
+	ctx := context.Background()
+	store := NewLocalStore(t.TempDir())
+
+	for _, data := range []string{"first", "second"} {
+		if err := store.Put(ctx, "files/a.txt", "", []byte(data)); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	blob, err := store.Get(ctx, "files/a.txt")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if string(blob.Data) != "second" {
+		t.Errorf("Get() data = %q, want %q", blob.Data, "second")
+	}
+}
+
+func TestLocalStoreInvalidKeys(t *testing.T) {
+	ctx := context.Background()
+	store := NewLocalStore(t.TempDir())
+
+	for _, key := range []string{"", "/absolute", "a//b", "../escape", "a/../../b", "a/./b", `a\b`, "a/"} {
+		t.Run(key, func(t *testing.T) {
+			if err := store.Put(ctx, key, "", []byte("data")); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("Put() error = %v, want %v", err, ErrInvalidKey)
+			}
+			if _, err := store.Get(ctx, key); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("Get() error = %v, want %v", err, ErrInvalidKey)
+			}
+			if err := store.Delete(ctx, key); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("Delete() error = %v, want %v", err, ErrInvalidKey)
+			}
+		})
+	}
+}
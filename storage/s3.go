@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3Config - connection settings of an S3-compatible object store
+type S3Config struct {
+	// Endpoint - base url of the store, `https://s3.<region>.amazonaws.com` when empty
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyId     string
+	SecretAccessKey string
+	// PathStyle - address the bucket in the path (`<endpoint>/<bucket>/<key>`)
+	// instead of the host (`<bucket>.<endpoint host>/<key>`), as most local
+	// stand-ins such as MinIO need
+	PathStyle bool
+}
+
+// S3Store - stores blobs as objects of an S3-compatible bucket, requests are
+// signed with AWS Signature Version 4
+type S3Store struct {
+	Config S3Config
+	Client *http.Client
+}
+
+// NewS3Store - creates a store writing objects to the bucket of config
+func NewS3Store(config S3Config) *S3Store {
+	if config.Endpoint == "" {
+		config.Endpoint = "https://s3." + config.Region + ".amazonaws.com"
+	}
+
+	return &S3Store{Config: config, Client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Put - uploads an object
+func (s *S3Store) Put(ctx context.Context, key, contentType string, data []byte) error {
+	response, err := s.do(ctx, http.MethodPut, key, contentType, data)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return s3Error(response)
+	}
+
+	return nil
+}
+
+// Get - downloads an object
+func (s *S3Store) Get(ctx context.Context, key string) (*Blob, error) {
+	response, err := s.do(ctx, http.MethodGet, key, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, s3Error(response)
+	}
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	modTime, _ := http.ParseTime(response.Header.Get("Last-Modified"))
+
+	return &Blob{Data: data, ContentType: response.Header.Get("Content-Type"), ModTime: modTime}, nil
+}
+
+// Delete - removes an object, missing objects are not an error
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	response, err := s.do(ctx, http.MethodDelete, key, "", nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNotFound {
+		return s3Error(response)
+	}
+
+	return nil
+}
+
+// do - sends a signed request for an object
+func (s *S3Store) do(ctx context.Context, method, key, contentType string, body []byte) (*http.Response, error) {
+	if !validKey(key) {
+		return nil, ErrInvalidKey
+	}
+
+	endpoint, err := url.Parse(s.Config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	objectPath := "/" + key
+	if s.Config.PathStyle {
+		objectPath = "/" + s.Config.Bucket + objectPath
+	} else {
+		endpoint.Host = s.Config.Bucket + "." + endpoint.Host
+	}
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + objectPath
+
+	request, err := http.NewRequestWithContext(ctx, method, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	s.sign(request, body, time.Now().UTC())
+
+	return s.Client.Do(request)
+}
+
+// sign - adds the AWS Signature Version 4 authorization headers to a request
+func (s *S3Store) sign(request *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// canonical request, signing the host, the content type when set and the amz headers
+	headers := map[string]string{
+		"host":                 request.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	names := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if contentType := request.Header.Get("Content-Type"); contentType != "" {
+		headers["content-type"] = contentType
+		names = append([]string{"content-type"}, names...)
+	}
+	canonicalHeaders := ""
+	for _, name := range names {
+		canonicalHeaders += name + ":" + strings.TrimSpace(headers[name]) + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	// string to sign and signing key of the day, region and service
+	scope := date + "/" + s.Config.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.Config.SecretAccessKey), date)
+	key = hmacSHA256(key, s.Config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.Config.AccessKeyId, scope, signedHeaders, signature,
+	))
+}
+
+// s3Error - the error of a failed request
+func s3Error(response *http.Response) error {
+	message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+	return fmt.Errorf("s3: %s: %s", response.Status, strings.TrimSpace(string(message)))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,81 @@
+// Package storage stores files such as avatars in a blob store.
+//
+// The store used is picked with the `BLOB_STORE` environmental variable:
+//   - local - writes files to the `BLOB_DIR` directory (default)
+//   - s3    - writes files to the `S3_BUCKET` bucket of an S3-compatible object
+//     store at `S3_ENDPOINT`, e.g. AWS S3 or a local MinIO
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/braswelljr/axxxe/helper"
+)
+
+// Blob - a stored file
+type Blob struct {
+	Data        []byte
+	ContentType string
+	ModTime     time.Time
+}
+
+// BlobStore - stores files by key, keys are slash separated paths such as
+// `avatars/<user_id>/128.jpg`
+type BlobStore interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	Get(ctx context.Context, key string) (*Blob, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var (
+	defaultStore BlobStore
+	once         sync.Once
+
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// Default - the blob store configured for the application
+func Default() BlobStore {
+	once.Do(func() {
+		switch helper.GetEnv("BLOB_STORE", "local") {
+		case "s3":
+			defaultStore = NewS3Store(S3Config{
+				Endpoint:        helper.GetEnv("S3_ENDPOINT", ""),
+				Region:          helper.GetEnv("S3_REGION", "us-east-1"),
+				Bucket:          helper.GetEnv("S3_BUCKET", ""),
+				AccessKeyId:     helper.GetEnv("S3_ACCESS_KEY_ID", ""),
+				SecretAccessKey: helper.GetEnv("S3_SECRET_ACCESS_KEY", ""),
+				PathStyle:       helper.GetEnv("S3_PATH_STYLE", "false") == "true",
+			})
+		default:
+			defaultStore = NewLocalStore(helper.GetEnv("BLOB_DIR", "tmp/blobs"))
+		}
+	})
+
+	return defaultStore
+}
+
+// SetDefault - replaces the blob store used by the application
+func SetDefault(store BlobStore) {
+	once.Do(func() {})
+	defaultStore = store
+}
+
+// validKey - checks that a key is a relative path without empty, `.` or `..` parts
+func validKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." || strings.ContainsRune(part, '\\') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,140 @@
+// Package ticket issues single-use, expiring tokens such as password reset links.
+//
+// Only a SHA-256 hash of a ticket is stored, the raw value is handed to the user
+// once. Tickets are removed by a TTL index once they expire.
+package ticket
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/braswelljr/axxxe/database"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/model"
+)
+
+// ticket purposes
+const (
+	PasswordReset = "password_reset"
+	MagicLink     = "magic_link"
+	EmailChange   = "email_change"
+	EmailRevert   = "email_revert"
+)
+
+var (
+	collection = database.OpenCollection(database.Client, "tickets")
+
+	ErrInvalidTicket = errors.New("invalid or expired token")
+)
+
+func init() {
+	database.CreateIndexes(collection,
+		mongo.IndexModel{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "purpose", Value: 1}}},
+		mongo.IndexModel{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	)
+}
+
+// Issue - creates a ticket for a user and returns the raw token.
+// Outstanding tickets of the same purpose for the user are invalidated.
+func Issue(ctx context.Context, purpose, userId string, ttl time.Duration, data map[string]string) (string, error) {
+	// generate the token
+	token, err := helper.RandomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	// invalidate previous tickets
+	if err := Revoke(ctx, purpose, userId); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	ticket := &model.Ticket{
+		Hash:      Hash(token),
+		Purpose:   purpose,
+		UserId:    userId,
+		Data:      data,
+		CreatedAt: primitive.NewDateTimeFromTime(now),
+		ExpiresAt: primitive.NewDateTimeFromTime(now.Add(ttl)),
+	}
+
+	if _, err := collection.InsertOne(ctx, ticket); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Find - gets a valid ticket without using it
+func Find(ctx context.Context, purpose, token string) (*model.Ticket, error) {
+	ticket := &model.Ticket{}
+	err := collection.FindOne(ctx, bson.M{
+		"hash":       Hash(token),
+		"purpose":    purpose,
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": primitive.NewDateTimeFromTime(time.Now())},
+	}).Decode(ticket)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrInvalidTicket
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ticket, nil
+}
+
+// Redeem - uses a ticket, a ticket can only be redeemed once before it expires
+func Redeem(ctx context.Context, purpose, token string) (*model.Ticket, error) {
+	now := primitive.NewDateTimeFromTime(time.Now())
+
+	ticket := &model.Ticket{}
+	err := collection.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"hash":       Hash(token),
+			"purpose":    purpose,
+			"used_at":    bson.M{"$exists": false},
+			"expires_at": bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"used_at": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(ticket)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrInvalidTicket
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ticket, nil
+}
+
+// Revoke - invalidates the unused tickets of a purpose for a user
+func Revoke(ctx context.Context, purpose, userId string) error {
+	_, err := collection.DeleteMany(ctx, bson.M{
+		"purpose": purpose,
+		"user_id": userId,
+		"used_at": bson.M{"$exists": false},
+	})
+
+	return err
+}
+
+// DeleteAll - deletes every ticket of a user
+func DeleteAll(ctx context.Context, userId string) error {
+	_, err := collection.DeleteMany(ctx, bson.M{"user_id": userId})
+	return err
+}
+
+// Hash - hashes a raw ticket token
+func Hash(token string) string {
+	return helper.HashToken(token)
+}
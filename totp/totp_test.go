@@ -0,0 +1,126 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret - the SHA-1 secret of the test vectors of RFC 6238, "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// the RFC 6238 SHA-1 vectors, truncated to 6 digits
+	tests := []struct {
+		time int64
+		code string
+	}{
+		{time: 59, code: "287082"},
+		{time: 1111111109, code: "081804"},
+		{time: 1111111111, code: "050471"},
+		{time: 1234567890, code: "005924"},
+		{time: 2000000000, code: "279037"},
+		{time: 20000000000, code: "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			code, err := Code(rfcSecret, Step(time.Unix(tt.time, 0)))
+			if err != nil {
+				t.Fatalf("Code() error = %v", err)
+			}
+			if code != tt.code {
+				t.Errorf("Code() = %q, want %q", code, tt.code)
+			}
+		})
+	}
+}
+
+func TestCodeSecretFormats(t *testing.T) {
+	for _, secret := range []string{rfcSecret, strings.ToLower(rfcSecret), " " + rfcSecret + "\n"} {
+		code, err := Code(secret, Step(time.Unix(59, 0)))
+		if err != nil || code != "287082" {
+			t.Errorf("Code(%q) = %q, %v, want %q", secret, code, err, "287082")
+		}
+	}
+
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code() of an invalid secret succeeded, want an error")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+	code := func(step int64) string {
+		c, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name string
+		code string
+		skew int
+		step int64
+		ok   bool
+	}{
+		{name: "current code", code: code(current), skew: 0, step: current, ok: true},
+		{name: "spaces are ignored", code: " " + code(current)[:3] + " " + code(current)[3:] + " ", skew: 0, step: current, ok: true},
+		{name: "previous code within skew", code: code(current - 1), skew: 1, step: current - 1, ok: true},
+		{name: "next code within skew", code: code(current + 1), skew: 1, step: current + 1, ok: true},
+		{name: "previous code without skew", code: code(current - 1), skew: 0},
+		{name: "code outside skew", code: code(current - 2), skew: 1},
+		{name: "wrong code", code: "000000", skew: 1},
+		{name: "short code", code: code(current)[:5], skew: 1},
+		{name: "long code", code: code(current) + "0", skew: 1},
+		{name: "empty code", code: "", skew: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, tt.code, now, tt.skew)
+			if ok != tt.ok || step != tt.step {
+				t.Errorf("Validate() = %d, %v, want %d, %v", step, ok, tt.step, tt.ok)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 10; i++ {
+		secret, err := GenerateSecret()
+		if err != nil {
+			t.Fatalf("GenerateSecret() error = %v", err)
+		}
+		key, err := encoding.DecodeString(secret)
+		if err != nil || len(key) != SecretSize {
+			t.Fatalf("GenerateSecret() = %q decodes to %d bytes (%v), want %d", secret, len(key), err, SecretSize)
+		}
+		if seen[secret] {
+			t.Fatalf("GenerateSecret() repeated %q", secret)
+		}
+		seen[secret] = true
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri, err := url.Parse(URI("axxxe", "jane@example.com", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/axxxe:jane@example.com" {
+		t.Errorf("URI() = %q, want otpauth://totp/axxxe:jane@example.com", uri)
+	}
+	query := uri.Query()
+	for key, want := range map[string]string{"secret": rfcSecret, "issuer": "axxxe", "algorithm": "SHA1", "digits": "6", "period": "30"} {
+		if got := query.Get(key); got != want {
+			t.Errorf("URI() %s = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package view
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/braswelljr/axxxe/model"
+)
+
+// DataExport - a copy of the personal data of a user
+type DataExport struct {
+	ExportedAt primitive.DateTime `json:"exported_at"`
+	User       SelfUser           `json:"user"`
+	Sessions   []model.Session    `json:"sessions"`
+	Addresses  []model.Address    `json:"addresses"`
+	Carts      []bson.M           `json:"carts"`
+	Orders     []bson.M           `json:"orders"`
+}
@@ -0,0 +1,29 @@
+package view
+
+import "github.com/braswelljr/axxxe/model"
+
+// Product - a product as shown in the store
+type Product struct {
+	ProductId    string  `json:"product_id"`
+	Name         string  `json:"name"`
+	Type         string  `json:"type"`
+	Description  string  `json:"description"`
+	Image        string  `json:"image"`
+	Price        float64 `json:"price"`
+	Quantity     int     `json:"quantity"`
+	Availability bool    `json:"availability"`
+}
+
+// NewProduct - the representation of a product
+func NewProduct(product *model.Product) Product {
+	return Product{
+		ProductId:    product.ProductId,
+		Name:         product.Name,
+		Type:         product.Type,
+		Description:  product.Description,
+		Image:        product.Image,
+		Price:        product.Price,
+		Quantity:     product.Quantity,
+		Availability: product.Availability,
+	}
+}
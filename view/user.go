@@ -0,0 +1,129 @@
+package view
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/braswelljr/axxxe/avatar"
+	"github.com/braswelljr/axxxe/helper"
+	"github.com/braswelljr/axxxe/model"
+)
+
+// PublicUser - what anyone allowed to see a user can see
+type PublicUser struct {
+	UserId    string `json:"user_id"`
+	Username  string `json:"username"`
+	Firstname string `json:"firstname,omitempty"`
+	Lastname  string `json:"lastname,omitempty"`
+	// Avatar - urls of the profile image by size in pixels
+	Avatar map[string]string `json:"avatar,omitempty"`
+}
+
+// SelfUser - what users see of their own account
+type SelfUser struct {
+	PublicUser
+	Email               string             `json:"email"`
+	Phone               string             `json:"phone,omitempty"`
+	Gender              string             `json:"gender,omitempty"`
+	Role                string             `json:"role"`
+	Status              string             `json:"status,omitempty"`
+	VerifiedAt          primitive.DateTime `json:"verified_at,omitempty"`
+	TwoFactor           TwoFactor          `json:"two_factor"`
+	Identities          []Identity         `json:"identities,omitempty"`
+	LastLogin           primitive.DateTime `json:"last_login"`
+	CreatedAt           primitive.DateTime `json:"created_at"`
+	DeletionScheduledAt primitive.DateTime `json:"deletion_scheduled_at,omitempty"`
+}
+
+// AdminUser - what users managing other users see of them
+type AdminUser struct {
+	SelfUser
+	Id        primitive.ObjectID `json:"id"`
+	UpdatedAt primitive.DateTime `json:"updated_at"`
+	DeletedAt primitive.DateTime `json:"deleted_at,omitempty"`
+}
+
+// TwoFactor - the two-factor authentication settings of a user, without secrets
+type TwoFactor struct {
+	Enabled   bool               `json:"enabled"`
+	EnabledAt primitive.DateTime `json:"enabled_at,omitempty"`
+}
+
+// Identity - an account of an identity provider linked to a user
+type Identity struct {
+	Provider string             `json:"provider"`
+	Email    string             `json:"email,omitempty"`
+	LinkedAt primitive.DateTime `json:"linked_at"`
+}
+
+// Public - the public representation of a user
+func Public(user *model.User) PublicUser {
+	return PublicUser{
+		UserId:    user.UserId,
+		Username:  user.Username,
+		Firstname: user.Firstname,
+		Lastname:  user.Lastname,
+		Avatar:    avatar.URLs(user.UserId, user.Avatar),
+	}
+}
+
+// Self - the representation of a user for themselves
+func Self(user *model.User) SelfUser {
+	identities := []Identity{}
+	for _, identity := range user.Identities {
+		identities = append(identities, Identity{
+			Provider: identity.Provider,
+			Email:    identity.Email,
+			LinkedAt: identity.LinkedAt,
+		})
+	}
+
+	return SelfUser{
+		PublicUser:          Public(user),
+		Email:               user.Email,
+		Phone:               user.Phone,
+		Gender:              user.Gender,
+		Role:                user.Role,
+		Status:              user.Status,
+		VerifiedAt:          user.VerifiedAt,
+		TwoFactor:           TwoFactor{Enabled: user.TwoFactor.Enabled, EnabledAt: user.TwoFactor.EnabledAt},
+		Identities:          identities,
+		LastLogin:           user.LastLogin,
+		CreatedAt:           user.CreatedAt,
+		DeletionScheduledAt: user.DeletionScheduledAt,
+	}
+}
+
+// Admin - the representation of a user for users managing other users
+func Admin(user *model.User) AdminUser {
+	return AdminUser{
+		SelfUser:  Self(user),
+		Id:        user.Id,
+		UpdatedAt: user.UpdatedAt,
+		DeletedAt: user.DeletedAt,
+	}
+}
+
+// User - the representation of a user for the authenticated user of a request:
+// their own account, any user for users allowed to read users, or the public
+// representation
+func User(ctx *fiber.Ctx, user *model.User) interface{} {
+	switch {
+	case helper.IsOwner(ctx, user.UserId):
+		return Self(user)
+	case helper.Can(ctx, model.PermissionUsersRead):
+		return Admin(user)
+	}
+
+	return Public(user)
+}
+
+// Users - the representations of users for the authenticated user of a request
+func Users(ctx *fiber.Ctx, users []model.User) []interface{} {
+	list := make([]interface{}, 0, len(users))
+	for i := range users {
+		list = append(list, User(ctx, &users[i]))
+	}
+
+	return list
+}
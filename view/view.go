@@ -0,0 +1,7 @@
+// Package view holds the representations of models returned by the api.
+//
+// Users and products are never returned as models: their responses are built
+// from views listing the fields they expose, so fields added to a model, such as
+// password hashes or token secrets, can not be returned by accident. Users have
+// a public, a self and an admin representation.
+package view